@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Routes for the schedule maintainer, only served if serve_auth covers them
+// so that they are never public.
+const (
+	AdminRefreshPath = "/admin/refresh"
+	AdminStatusPath  = "/admin/status"
+)
+
+// ServerStatus is what AdminStatusPath and AdminRefreshPath respond with.
+type ServerStatus struct {
+	// Refreshed is when the last refresh finished, and Error why it failed
+	Refreshed time.Time `json:"refreshed"`
+	Error     string    `json:"error,omitempty"`
+
+	// Staleness is how many seconds ago the last successful refresh
+	// finished, if the last refresh failed
+	Staleness float64 `json:"staleness,omitempty"`
+
+	// Modified is when the events last changed
+	Modified time.Time `json:"modified"`
+
+	// Workouts is the number of workouts in the served calendar
+	Workouts int `json:"workouts"`
+}
+
+// status returns the status of the server.
+func (s *calendarServer) status() ServerStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := ServerStatus{
+		Refreshed: s.refreshed,
+		Staleness: s.staleness(time.Now()).Seconds(),
+		Modified:  s.modified,
+		Workouts:  s.workouts,
+	}
+	if s.err != nil {
+		status.Error = s.err.Error()
+	}
+
+	return status
+}
+
+// serveRefresh refreshes the calendar right away, e.g. right after the site
+// was edited, instead of at the next -serve-interval. Responds with the
+// status, with 502 Bad Gateway if the refresh failed.
+func (s *calendarServer) serveRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("refresh requested from %s", r.RemoteAddr)
+
+	code := http.StatusOK
+	if err := s.update(); err != nil {
+		warnf("unable to refresh calendar: %v", err)
+		code = http.StatusBadGateway
+	}
+
+	if err := runSummary.write(*summaryOut); err != nil {
+		log.Printf("unable to write summary: %v", err)
+	}
+
+	if err := runSummary.push(*pushgateway, *pushgatewayJob); err != nil {
+		log.Print(err)
+	}
+
+	writeStatus(w, code, s.status())
+}
+
+func (s *calendarServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, s.status())
+}
+
+// writeStatus writes the status as JSON.
+func writeStatus(w http.ResponseWriter, code int, status ServerStatus) {
+	b, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdmin(t *testing.T) {
+	dir := t.TempDir()
+
+	page := filepath.Join(dir, "october.html")
+	if err := os.WriteFile(page, []byte(octoberPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved string) { *testFile = saved }(*testFile)
+	*testFile = page
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ServeAuth = []AuthRule{{Path: "/admin/", Tokens: []string{"coach-token"}}}
+
+	s := &calendarServer{config: config, templates: newTemplates(config), admin: true}
+	h := requireAuth(config.ServeAuth, s)
+
+	do := func(method, path string) (int, ServerStatus) {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer coach-token")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		var status ServerStatus
+		if w.Code != http.StatusMethodNotAllowed {
+			if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+
+		return w.Code, status
+	}
+
+	if code, status := do("GET", AdminStatusPath); code != http.StatusOK || status.Workouts != 0 || !status.Refreshed.IsZero() {
+		t.Errorf("got %d %+v before the first refresh", code, status)
+	}
+
+	if code, _ := do("GET", AdminRefreshPath); code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d for GET %s", code, AdminRefreshPath)
+	}
+
+	if code, status := do("POST", AdminRefreshPath); code != http.StatusOK || status.Workouts != 2 || status.Refreshed.IsZero() || status.Error != "" {
+		t.Errorf("got %d %+v after a refresh", code, status)
+	}
+
+	// The site is down, the previous calendar is kept
+	*testFile = filepath.Join(dir, "missing.html")
+	if code, status := do("POST", AdminRefreshPath); code != http.StatusBadGateway || status.Workouts != 2 || status.Error == "" {
+		t.Errorf("got %d %+v after a failed refresh", code, status)
+	}
+
+	// Unauthenticated
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", AdminRefreshPath, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d without the token", w.Code)
+	}
+
+	// Not served without serve_auth
+	s.admin = false
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", AdminStatusPath, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d without serve_auth", w.Code)
+	}
+}
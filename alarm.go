@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Alarm is a single VALARM component attached to a workout.
+type Alarm struct {
+	// Action is the ACTION property: DISPLAY, EMAIL, or AUDIO
+	Action string
+	// Trigger is the TRIGGER property, a duration relative to DTSTART
+	Trigger string
+	// Description and Attendee are only used by DISPLAY and EMAIL actions
+	Description string
+	Attendee    string
+}
+
+// AlarmRule adds alarms to every workout with a matching type.
+type AlarmRule struct {
+	// Type to match or "*" to match all workouts
+	Type string
+
+	Alarms []Alarm
+}
+
+// parseAlarmRules compiles the alarm rules mini-DSL. Rules are separated by
+// semicolons, each rule is a selector followed by a colon and a comma
+// separated list of offset and action pairs:
+//
+//	type=swim: -45m display; type=race: -1d email, -2h display; *: -10m audio
+//
+// Offsets are relative to the start of the workout and use the units d, h,
+// and m. Unsigned offsets are before the start.
+func parseAlarmRules(s string) ([]AlarmRule, error) {
+	var rules []AlarmRule
+
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		parts := strings.SplitN(rule, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("alarm rule missing `:`: `%s`", rule)
+		}
+
+		typ := strings.TrimSpace(parts[0])
+		if typ != "*" {
+			if !strings.HasPrefix(typ, "type=") {
+				return nil, fmt.Errorf("invalid alarm selector: `%s`", typ)
+			}
+			typ = strings.TrimSpace(strings.TrimPrefix(typ, "type="))
+		}
+
+		r := AlarmRule{Type: typ}
+
+		for _, alarm := range strings.Split(parts[1], ",") {
+			fields := strings.Fields(alarm)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("expected offset and action: `%s`", alarm)
+			}
+
+			trigger, err := parseAlarmOffset(fields[0])
+			if err != nil {
+				return nil, err
+			}
+
+			action := strings.ToUpper(fields[1])
+			switch action {
+			case "DISPLAY", "EMAIL", "AUDIO":
+			default:
+				return nil, fmt.Errorf("invalid alarm action: `%s`", fields[1])
+			}
+
+			r.Alarms = append(r.Alarms, Alarm{Action: action, Trigger: trigger})
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// alarmOffset matches the offsets accepted by parseAlarmOffset, each unit at
+// most once and in order.
+var alarmOffset = regexp.MustCompile(`^([+-])?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?$`)
+
+// parseAlarmOffset converts offsets such as -1d, -2h, or -1h30m into an iCal
+// duration, see RFC 5545 Sec 3.3.6.
+func parseAlarmOffset(s string) (string, error) {
+	m := alarmOffset.FindStringSubmatch(s)
+	if m == nil || m[2] == "" && m[3] == "" && m[4] == "" {
+		return "", fmt.Errorf("invalid alarm offset: `%s`", s)
+	}
+
+	sign := "-"
+	if m[1] == "+" {
+		sign = ""
+	}
+
+	var date, time string
+	for i, unit := range []string{"D", "H", "M"} {
+		if m[i+2] == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return "", fmt.Errorf("invalid alarm offset: `%s`", s)
+		}
+
+		if unit == "D" {
+			date = fmt.Sprintf("%d%s", n, unit)
+		} else {
+			time += fmt.Sprintf("%d%s", n, unit)
+		}
+	}
+
+	res := sign + "P" + date
+	if time != "" {
+		res += "T" + time
+	}
+
+	return res, nil
+}
+
+// alarmsFor returns the alarms from all the rules that match the workout.
+func alarmsFor(rules []AlarmRule, w *Workout, attendee string) []Alarm {
+	var alarms []Alarm
+
+	for _, rule := range rules {
+		if rule.Type != "*" && rule.Type != w.Type {
+			continue
+		}
+
+		for _, a := range rule.Alarms {
+			if a.Action != "AUDIO" {
+				a.Description = w.Summary
+			}
+			if a.Action == "EMAIL" {
+				a.Attendee = attendee
+			}
+
+			alarms = append(alarms, a)
+		}
+	}
+
+	return alarms
+}
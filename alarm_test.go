@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestParseAlarmOffset(t *testing.T) {
+	for _, tc := range []struct {
+		offset, want string
+	}{
+		{"-1d", "-P1D"},
+		{"1d", "-P1D"},
+		{"+1d", "P1D"},
+		{"-2h", "-PT2H"},
+		{"-15m", "-PT15M"},
+		{"-1h30m", "-PT1H30M"},
+		{"-1d2h30m", "-P1DT2H30M"},
+		{"-1d30m", "-P1DT30M"},
+		{"-02h", "-PT2H"},
+		{"0m", "-PT0M"},
+
+		// Units repeated, out of order, or missing
+		{"1d2d", ""},
+		{"30m1h", ""},
+		{"1h2h", ""},
+		{"1m1d", ""},
+		{"", ""},
+		{"-", ""},
+		{"d", ""},
+		{"1", ""},
+		{"1w", ""},
+		{"--1h", ""},
+		{"1h 30m", ""},
+		{"1H", ""},
+	} {
+		got, err := parseAlarmOffset(tc.offset)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", tc.offset, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", tc.offset, err)
+		} else if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.offset, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Journal records which workouts the member attended or skipped, see attend,
+// skip, and report attendance.
+type Journal struct {
+	// Entries are keyed by the UID of the workout
+	Entries map[string]*JournalEntry `json:"entries"`
+}
+
+// JournalEntry is what the journal remembers about a workout, enough to
+// report on it after it is no longer on the fetched months of the calendar.
+type JournalEntry struct {
+	Start    time.Time `json:"start"`
+	Summary  string    `json:"summary"`
+	Type     string    `json:"type"`
+	Attended bool      `json:"attended"`
+	Recorded time.Time `json:"recorded"`
+}
+
+// loadJournal reads the journal from fname, an empty journal if it doesn't
+// exist yet.
+func loadJournal(fname string) (*Journal, error) {
+	j := &Journal{}
+
+	b, err := os.ReadFile(fname)
+	if err == nil {
+		if err := json.Unmarshal(b, j); err != nil {
+			return nil, fmt.Errorf("unable to parse journal %s: %v", fname, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if j.Entries == nil {
+		j.Entries = map[string]*JournalEntry{}
+	}
+
+	return j, nil
+}
+
+// save writes the journal to fname.
+func (j *Journal) save(fname string) error {
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(fname, append(b, '\n'), 0644)
+}
+
+// record marks the workout as attended or skipped, replacing what was
+// recorded for it before.
+func (j *Journal) record(w *Workout, attended bool, now time.Time) {
+	j.Entries[w.UID] = &JournalEntry{
+		Start:    w.Start,
+		Summary:  w.Summary,
+		Type:     w.Type,
+		Attended: attended,
+		Recorded: now,
+	}
+}
+
+// findWorkout returns the workout that args identify, either its UID or its
+// date, e.g. 2026-10-12, optionally followed by part of its summary when
+// there are several workouts that day.
+func findWorkout(workouts []*Workout, args []string) (*Workout, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing workout, must be a UID or a date and summary")
+	}
+
+	if len(args) == 1 {
+		for _, w := range workouts {
+			if w.UID == args[0] {
+				return w, nil
+			}
+		}
+	}
+
+	day, err := time.Parse("2006-01-02", args[0])
+	if err != nil {
+		return nil, fmt.Errorf("unknown workout, must be a UID or a date and summary: `%s`", args[0])
+	}
+	summary := strings.ToLower(strings.Join(args[1:], " "))
+
+	var matches []*Workout
+	for _, w := range workouts {
+		if w.Start.Format("2006-01-02") == day.Format("2006-01-02") && strings.Contains(strings.ToLower(w.Summary), summary) {
+			matches = append(matches, w)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no workout matches `%s`", strings.Join(args, " "))
+	case 1:
+		return matches[0], nil
+	}
+
+	var names []string
+	for _, w := range matches {
+		names = append(names, fmt.Sprintf("%s at %s", w.Summary, w.Start.Format("3:04 PM")))
+	}
+
+	return nil, fmt.Errorf("%d workouts match `%s`, add part of the summary to pick one: %s", len(matches), strings.Join(args, " "), strings.Join(names, "; "))
+}
+
+// reportAttendance counts, per workout type, the workouts that have started
+// by now and how many of them were attended, skipped, or not recorded, as a
+// CSV with a row for each type and a total. Workouts in the journal that are
+// no longer on the fetched months of the calendar are counted too. The rows
+// are ordered like the config's type rules.
+func reportAttendance(workouts []*Workout, j *Journal, config *Config, now time.Time) ([]byte, error) {
+	type counts struct {
+		planned, attended, skipped int
+	}
+
+	byType := map[string]*counts{}
+	count := func(typ string, e *JournalEntry) {
+		c := byType[typ]
+		if c == nil {
+			c = &counts{}
+			byType[typ] = c
+		}
+
+		c.planned++
+		if e != nil && e.Attended {
+			c.attended++
+		} else if e != nil {
+			c.skipped++
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, w := range workouts {
+		if w.Start.After(now) {
+			continue
+		}
+
+		seen[w.UID] = true
+		count(w.Type, j.Entries[w.UID])
+	}
+
+	for uid, e := range j.Entries {
+		if !seen[uid] {
+			count(e.Type, e)
+		}
+	}
+
+	var types []string
+	listed := map[string]bool{}
+	for _, rule := range config.Types {
+		if byType[rule.Type] != nil && !listed[rule.Type] {
+			types = append(types, rule.Type)
+			listed[rule.Type] = true
+		}
+	}
+
+	// Types that are only in the journal or have no rule, e.g. DefaultType
+	var rest []string
+	for typ := range byType {
+		if !listed[typ] {
+			rest = append(rest, typ)
+		}
+	}
+	sort.Strings(rest)
+	types = append(types, rest...)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"type", "planned", "attended", "skipped", "unrecorded", "attendance"})
+
+	var total counts
+	row := func(name string, c counts) {
+		rate := 0.0
+		if c.planned > 0 {
+			rate = float64(c.attended) / float64(c.planned) * 100
+		}
+
+		w.Write([]string{
+			name,
+			fmt.Sprint(c.planned),
+			fmt.Sprint(c.attended),
+			fmt.Sprint(c.skipped),
+			fmt.Sprint(c.planned - c.attended - c.skipped),
+			fmt.Sprintf("%.0f%%", rate),
+		})
+	}
+
+	for _, typ := range types {
+		c := byType[typ]
+		row(typ, *c)
+
+		total.planned += c.planned
+		total.attended += c.attended
+		total.skipped += c.skipped
+	}
+	row("total", total)
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
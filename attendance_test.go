@@ -0,0 +1,120 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindWorkout(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, time.October, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	workouts := []*Workout{
+		{UID: "swim-1", Summary: "Masters Swim", Start: at(12, 6)},
+		{UID: "ride-1", Summary: "Group Ride", Start: at(12, 17)},
+		{UID: "run-1", Summary: "Track Run", Start: at(13, 6)},
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+		err  string
+	}{
+		{[]string{"ride-1"}, "ride-1", ""},
+		{[]string{"2026-10-13"}, "run-1", ""},
+		{[]string{"2026-10-12", "swim"}, "swim-1", ""},
+		{[]string{"2026-10-12", "GROUP", "ride"}, "ride-1", ""},
+		{nil, "", "missing workout"},
+		{[]string{"tomorrow"}, "", "unknown workout"},
+		{[]string{"2026-10-14"}, "", "no workout matches `2026-10-14`"},
+		{[]string{"2026-10-12"}, "", "2 workouts match `2026-10-12`"},
+	} {
+		w, err := findWorkout(workouts, tc.args)
+		if tc.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("%v: got error %v, want %s", tc.args, err, tc.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+		} else if w.UID != tc.want {
+			t.Errorf("%v: got %s, want %s", tc.args, w.UID, tc.want)
+		}
+	}
+}
+
+func TestReportAttendance(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2026, time.October, d, 6, 0, 0, 0, time.UTC)
+	}
+
+	workouts := []*Workout{
+		{UID: "swim-1", Type: "swim", Start: day(10)},
+		{UID: "swim-2", Type: "swim", Start: day(11)},
+		{UID: "swim-3", Type: "swim", Start: day(12)},
+		{UID: "run-1", Type: "run", Start: day(13)},
+		// Not started yet, so not planned
+		{UID: "run-2", Type: "run", Start: day(20)},
+	}
+
+	j := &Journal{Entries: map[string]*JournalEntry{}}
+	j.record(workouts[0], true, now)
+	j.record(workouts[1], false, now)
+	j.record(workouts[3], true, now)
+
+	// Only in the journal, from a month that is no longer fetched
+	j.Entries["ride-1"] = &JournalEntry{Type: "ride", Start: day(1).AddDate(0, -1, 0), Attended: true}
+
+	config := &Config{Types: []TypeRule{{Type: "run"}, {Type: "swim"}, {Type: "run"}}}
+
+	out, err := reportAttendance(workouts, j, config, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "type,planned,attended,skipped,unrecorded,attendance\n" +
+		"run,1,1,0,0,100%\n" +
+		"swim,3,1,1,1,33%\n" +
+		"ride,1,1,0,0,100%\n" +
+		"total,5,3,1,1,60%\n"
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestJournalSave(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "journal.json")
+
+	j, err := loadJournal(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Entries) != 0 {
+		t.Fatalf("got %d entries in a new journal", len(j.Entries))
+	}
+
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	w := &Workout{UID: "swim-1", Summary: "Masters Swim", Type: "swim", Start: now.Add(-6 * time.Hour)}
+
+	j.record(w, false, now)
+	j.record(w, true, now)
+	if err := j.save(fname); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = loadJournal(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := j.Entries["swim-1"]
+	if len(j.Entries) != 1 || e == nil || !e.Attended || e.Summary != "Masters Swim" || !e.Start.Equal(w.Start) {
+		t.Errorf("got entries %+v", j.Entries)
+	}
+}
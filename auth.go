@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AuthRule requires HTTP Basic or bearer token authentication for the routes
+// of serve under Path, for clubs that don't want their schedule scraped. The
+// most specific rule that matches a route applies, routes without one are
+// public.
+type AuthRule struct {
+	// Path is the route, e.g. /tvtc.ics, or a prefix ending in a slash, e.g.
+	// / for every route
+	Path string `json:"path"`
+
+	// Passwords maps the users allowed with Basic authentication to their
+	// passwords
+	Passwords map[string]string `json:"passwords"`
+
+	// Tokens are the bearer tokens allowed
+	Tokens []string `json:"tokens"`
+}
+
+// checkAuthRules returns an error if a rule has an invalid or duplicate path,
+// or allows no one.
+func checkAuthRules(rules []AuthRule) error {
+	seen := map[string]bool{}
+
+	for _, r := range rules {
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("invalid serve_auth path: `%s`, must start with /", r.Path)
+		}
+
+		if seen[r.Path] {
+			return fmt.Errorf("duplicate serve_auth path: `%s`", r.Path)
+		}
+		seen[r.Path] = true
+
+		if len(r.Passwords) == 0 && len(r.Tokens) == 0 {
+			return fmt.Errorf("serve_auth %s: requires passwords or tokens", r.Path)
+		}
+	}
+
+	return nil
+}
+
+// authRule returns the rule for path, nil if the route is public.
+func authRule(rules []AuthRule, path string) *AuthRule {
+	var best *AuthRule
+
+	for i, r := range rules {
+		if r.Path != path && !(strings.HasSuffix(r.Path, "/") && strings.HasPrefix(path, r.Path)) {
+			continue
+		}
+
+		if best == nil || len(r.Path) > len(best.Path) {
+			best = &rules[i]
+		}
+	}
+
+	return best
+}
+
+// allows reports whether the request has credentials that the rule allows.
+func (a *AuthRule) allows(r *http.Request) bool {
+	if user, pass, ok := r.BasicAuth(); ok {
+		want, ok := a.Passwords[user]
+		return ok && subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	for _, t := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireAuth wraps h so that the routes with a rule require credentials that
+// it allows.
+func requireAuth(rules []AuthRule, h http.Handler) http.Handler {
+	if len(rules) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := authRule(rules, r.URL.Path)
+		if rule == nil || rule.allows(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// Calendar apps only prompt for Basic credentials
+		if len(rule.Passwords) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="tvtccal", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tvtccal"`)
+		}
+
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequireAuth(t *testing.T) {
+	rules := []AuthRule{
+		{Path: "/", Passwords: map[string]string{"member": "swim"}},
+		{Path: "/admin/", Tokens: []string{"coach-token"}},
+		{Path: "/public.ics", Passwords: map[string]string{"anyone": "x"}, Tokens: []string{"t"}},
+	}
+	if err := checkAuthRules(rules); err != nil {
+		t.Fatal(err)
+	}
+
+	h := requireAuth(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		path, user, pass, token string
+		want                    int
+		challenge               string
+	}{
+		{path: ServePath, want: http.StatusUnauthorized, challenge: "Basic"},
+		{path: ServePath, user: "member", pass: "swim", want: http.StatusOK},
+		{path: ServePath, user: "member", pass: "bike", want: http.StatusUnauthorized, challenge: "Basic"},
+		{path: ServePath, user: "coach", pass: "swim", want: http.StatusUnauthorized, challenge: "Basic"},
+		// The most specific rule applies
+		{path: "/admin/status", user: "member", pass: "swim", want: http.StatusUnauthorized, challenge: "Bearer"},
+		{path: "/admin/status", token: "coach-token", want: http.StatusOK},
+		{path: "/admin/status", token: "coach", want: http.StatusUnauthorized, challenge: "Bearer"},
+		{path: "/public.ics", token: "t", want: http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", tc.path, nil)
+		if tc.user != "" {
+			r.SetBasicAuth(tc.user, tc.pass)
+		}
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tc.want {
+			t.Errorf("%+v: got status %d, want %d", tc, w.Code, tc.want)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, tc.challenge) || got != "" && tc.challenge == "" {
+			t.Errorf("%+v: got challenge %q, want %s", tc, got, tc.challenge)
+		}
+	}
+
+	// Without a rule for the route, it is public
+	admin := requireAuth(rules[1:2], http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest("GET", ServePath, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for a public route", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest("GET", "/admin", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for /admin, which /admin/ doesn't cover", w.Code)
+	}
+}
+
+func TestCheckAuthRules(t *testing.T) {
+	for _, rules := range [][]AuthRule{
+		{{Path: "tvtc.ics", Tokens: []string{"t"}}},
+		{{Path: "/tvtc.ics"}},
+		{{Path: "/", Tokens: []string{"t"}}, {Path: "/", Tokens: []string{"u"}}},
+	} {
+		if err := checkAuthRules(rules); err == nil {
+			t.Errorf("%+v: got no error", rules)
+		}
+	}
+}
+
+func TestShowRedactsAuth(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "config.json")
+	conf := `{"serve_auth": [{"path": "/", "passwords": {"member": "hunter2"}, "tokens": ["s3cret"]}]}`
+	if err := os.WriteFile(fname, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := config.show(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := buf.String(); strings.Contains(out, "hunter2") || strings.Contains(out, "s3cret") || !strings.Contains(out, `"path": "/"`) {
+		t.Errorf("got:\n%s", out)
+	}
+}
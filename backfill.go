@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// runBackfill seeds the sync targets with the workouts from each page, one
+// month at a time and pausing for delay in between so that the services'
+// rate limits aren't hit. Returns the number of months that failed to publish
+// to at least one target, and the number of months.
+func runBackfill(config *Config, delay time.Duration) (int, int, error) {
+	targets, err := syncTargets(newTemplates(config))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(targets) == 0 {
+		return 0, 0, errors.New("backfill requires a sync target, see -intervals-athlete and -caldav-url")
+	}
+
+	pages, err := loadPages()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	failed := 0
+	p := newProgress("backfilled", "months", len(pages), time.Now())
+
+	for i, page := range pages {
+		if i > 0 && !*dryRun {
+			time.Sleep(delay)
+		}
+
+		groups, mtimes, months, err := fetchGroups([]fixture{page})
+		if err != nil {
+			return 0, 0, err
+		}
+
+		cals, err := buildCalendars(config, groups, mtimes, months)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		log.Printf("backfilling %d workouts from %s", len(cals[0].Workouts), page.fname)
+
+		if publish(targets, cals[0]) > 0 {
+			failed++
+		}
+
+		p.step(time.Now())
+	}
+
+	return failed, len(pages), nil
+}
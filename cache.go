@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cachedPagePath returns where the page at u is cached in dir, e.g.
+// www.trivalleytriclub.com_calendar_month_3_year_2026.html.
+func cachedPagePath(dir, u string) string {
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSuffix(u, "/"))
+
+	return filepath.Join(dir, name+".html")
+}
+
+// saveCachedPage caches the page at u. The modification time of the cached
+// file is set to mtime, if known, so that -dtstamp source-mtime is the same
+// for the cached copy.
+func saveCachedPage(dir, u string, b []byte, mtime time.Time) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	fname := cachedPagePath(dir, u)
+	if err := writeAtomic(fname, b, 0644); err != nil {
+		return err
+	}
+
+	if mtime.IsZero() {
+		return nil
+	}
+
+	return os.Chtimes(fname, mtime, mtime)
+}
+
+// loadCachedPage returns the cached copy of the page at u and its
+// modification time.
+func loadCachedPage(dir, u string) ([]byte, time.Time, error) {
+	fname := cachedPagePath(dir, u)
+
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	b, err := os.ReadFile(fname)
+	return b, fi.ModTime(), err
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// caldavQuery is a calendar-query REPORT for every event in the collection
+// along with its ETag, see RFC 4791 Sec 7.8.
+const caldavQuery = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data/>
+  </d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT"/>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>
+`
+
+// davMultistatus is the response to a REPORT, see RFC 4918 Sec 13.
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ETag string `xml:"DAV: getetag"`
+				Data string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// caldavResource is an event already on the server.
+type caldavResource struct {
+	url  string
+	etag string
+
+	// prodid is the PRODID of the calendar object, to tell our events from
+	// ones added by hand
+	prodid string
+	event  *Component
+}
+
+// caldavTarget publishes every workout as its own calendar object in a
+// CalDAV collection, such as a Nextcloud, Radicale, or Fastmail calendar.
+// Unchanged events are left alone and upcoming events that disappeared from
+// the months being published are deleted. Past events are kept.
+type caldavTarget struct {
+	url       string
+	user      string
+	password  string
+	templates *Templates
+	client    *http.Client
+	dryRun    bool
+}
+
+func (t *caldavTarget) Name() string {
+	return "caldav"
+}
+
+func (t *caldavTarget) Publish(cal *Calendar, status *TargetStatus) error {
+	out, err := t.templates.render(cal, FormatICal)
+	if err != nil {
+		return err
+	}
+
+	objects, err := splitCalendar(out)
+	if err != nil {
+		return err
+	}
+
+	existing, err := t.list()
+	if err != nil {
+		return err
+	}
+
+	var puts []string
+	for uid := range objects {
+		if r, ok := existing[uid]; !ok || !r.event.equal(objects[uid].event, "DTSTAMP") {
+			puts = append(puts, uid)
+		}
+	}
+
+	from, until := calendarMonths(cal)
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+
+	var deletes []*caldavResource
+	for uid, r := range existing {
+		if _, ok := objects[uid]; ok || r.prodid != ProdID {
+			continue
+		}
+
+		dtstart := r.event.Get("DTSTART")
+		if dtstart == nil {
+			continue
+		}
+
+		if start, _, err := parseICalTime(dtstart, time.UTC); err == nil && start.After(from) && start.Before(until) {
+			deletes = append(deletes, r)
+		}
+	}
+
+	sort.Strings(puts)
+
+	if t.dryRun {
+		log.Printf("dry run, not pushing %d events to or deleting %d events from %s", len(puts), len(deletes), t.url)
+		return nil
+	}
+
+	p := newProgress("pushed", "events to "+t.url, len(puts), time.Now())
+
+	for _, uid := range puts {
+		if err := t.put(uid, objects[uid].data, existing[uid]); err != nil {
+			return fmt.Errorf("unable to push %s: %v", uid, err)
+		}
+
+		status.Written++
+		runSummary.Synced++
+		p.step(time.Now())
+	}
+
+	p = newProgress("deleted", "events from "+t.url, len(deletes), time.Now())
+
+	for _, r := range deletes {
+		if err := t.delete(r); err != nil {
+			return fmt.Errorf("unable to delete %s: %v", r.url, err)
+		}
+
+		p.step(time.Now())
+	}
+
+	log.Printf("%s: %d events pushed, %d deleted, %d unchanged", t.url, len(puts), len(deletes), len(objects)-len(puts))
+
+	return nil
+}
+
+// calendarMonths returns the start of the first month and the end of the last
+// month with workouts, only events in those months are deleted so that
+// backfill, which publishes a month at a time, doesn't delete the others.
+func calendarMonths(cal *Calendar) (time.Time, time.Time) {
+	var from, until time.Time
+
+	for _, w := range cal.Workouts {
+		y, m, _ := w.Start.Date()
+
+		start := time.Date(y, m, 1, 0, 0, 0, 0, w.Start.Location())
+		if from.IsZero() || start.Before(from) {
+			from = start
+		}
+		if end := start.AddDate(0, 1, 0); end.After(until) {
+			until = end
+		}
+	}
+
+	return from, until
+}
+
+// calendarObject is a single event wrapped in its own VCALENDAR.
+type calendarObject struct {
+	data  []byte
+	event *Component
+}
+
+// splitCalendar splits a rendered calendar into calendar objects, one per
+// event, keyed by UID. Each gets the calendar's properties and time zones,
+// except for METHOD which isn't allowed in calendar objects, see RFC 4791
+// Sec 4.1.
+func splitCalendar(b []byte) (map[string]*calendarObject, error) {
+	roots, err := parseICS(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("rendered calendar is empty")
+	}
+
+	events := roots[0].Sub("VEVENT")
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	lines := bytes.SplitAfter(b, []byte("\n"))
+
+	var header []byte
+	for _, line := range lines[:events[0].Line-1] {
+		if !bytes.HasPrefix(line, []byte("METHOD:")) {
+			header = append(header, line...)
+		}
+	}
+	footer := bytes.Join(lines[events[len(events)-1].EndLine:], nil)
+
+	res := map[string]*calendarObject{}
+	for _, ev := range events {
+		data := append([]byte{}, header...)
+		data = append(data, bytes.Join(lines[ev.Line-1:ev.EndLine], nil)...)
+		data = append(data, footer...)
+
+		res[ev.Value("UID")] = &calendarObject{data: data, event: ev}
+	}
+
+	return res, nil
+}
+
+// list returns the events in the collection, keyed by UID.
+func (t *caldavTarget) list() (map[string]*caldavResource, error) {
+	resp, body, err := t.do("REPORT", t.url, []byte(caldavQuery), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "1",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 207 {
+		return nil, fmt.Errorf("unable to list events, status code: %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	ms := &davMultistatus{}
+	if err := xml.Unmarshal(body, ms); err != nil {
+		return nil, fmt.Errorf("unable to parse event list: %v", err)
+	}
+
+	base, err := url.Parse(t.url)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]*caldavResource{}
+	for _, r := range ms.Responses {
+		href, err := base.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("invalid href: `%s`", r.Href)
+		}
+
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") || ps.Prop.Data == "" {
+				continue
+			}
+
+			roots, err := parseICS(strings.NewReader(ps.Prop.Data))
+			if err != nil {
+				warnf("unable to parse %s: %v", href, err)
+				continue
+			}
+			if len(roots) == 0 {
+				continue
+			}
+
+			for _, ev := range roots[0].Sub("VEVENT") {
+				res[ev.Value("UID")] = &caldavResource{
+					url:    href.String(),
+					etag:   ps.Prop.ETag,
+					prodid: roots[0].Value("PRODID"),
+					event:  ev,
+				}
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// put creates or updates the event. Updates are conditional on the ETag from
+// list and creates on the event not existing yet. If the event changed on the
+// server in the meantime (412 Precondition Failed), the current ETag is
+// fetched and the put retried once since the club's calendar wins.
+func (t *caldavTarget) put(uid string, data []byte, prev *caldavResource) error {
+	u := strings.TrimSuffix(t.url, "/") + "/" + url.PathEscape(uid) + ".ics"
+
+	headers := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+	if prev != nil {
+		u = prev.url
+		headers["If-Match"] = prev.etag
+	} else {
+		headers["If-None-Match"] = "*"
+	}
+
+	for retry := true; ; retry = false {
+		resp, body, err := t.do("PUT", u, data, headers)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusPreconditionFailed || !retry {
+			return fmt.Errorf("status code: %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		}
+
+		warnf("%s changed on the server, overwriting it", u)
+
+		etag, err := t.etag(u)
+		if err != nil {
+			return err
+		}
+
+		delete(headers, "If-None-Match")
+		headers["If-Match"] = etag
+	}
+}
+
+// etag returns the current ETag of the resource.
+func (t *caldavTarget) etag(u string) (string, error) {
+	resp, _, err := t.do("HEAD", u, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != 200 || resp.Header.Get("ETag") == "" {
+		return "", fmt.Errorf("unable to get ETag, status code: %d", resp.StatusCode)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// delete removes the event, unless it changed on the server since list.
+func (t *caldavTarget) delete(r *caldavResource) error {
+	resp, body, err := t.do("DELETE", r.url, nil, map[string]string{"If-Match": r.etag})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode/100 == 2, resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		warnf("%s changed on the server, not deleting it", r.url)
+		return nil
+	}
+
+	return fmt.Errorf("status code: %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
+
+// do sends a request to the server, returning the response and its body.
+func (t *caldavTarget) do(method, u string, body []byte, headers map[string]string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if t.user != "" {
+		req.SetBasicAuth(t.user, t.password)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+
+	return resp, b, err
+}
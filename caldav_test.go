@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCalendarMonths(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 6, 0, 0, 0, loc)
+	}
+	month := func(y int, m time.Month) time.Time {
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		starts      []time.Time
+		from, until time.Time
+	}{
+		{"empty", nil, time.Time{}, time.Time{}},
+		{"one month", []time.Time{at(2026, time.March, 2), at(2026, time.March, 31)}, month(2026, time.March), month(2026, time.April)},
+		{"out of order", []time.Time{at(2026, time.May, 2), at(2026, time.March, 31)}, month(2026, time.March), month(2026, time.June)},
+		{"across the year", []time.Time{at(2026, time.December, 27), at(2027, time.January, 2)}, month(2026, time.December), month(2027, time.February)},
+	} {
+		cal := &Calendar{}
+		for _, start := range tc.starts {
+			cal.Workouts = append(cal.Workouts, &Workout{Start: start})
+		}
+
+		from, until := calendarMonths(cal)
+		if !from.Equal(tc.from) || !until.Equal(tc.until) {
+			t.Errorf("%s: got %v to %v, want %v to %v", tc.name, from, until, tc.from, tc.until)
+		}
+	}
+}
+
+func TestSplitCalendar(t *testing.T) {
+	const header = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//\r\n"
+	const tz = "BEGIN:VTIMEZONE\r\nTZID:America/Los_Angeles\r\nEND:VTIMEZONE\r\n"
+	const footer = "END:VCALENDAR\r\n"
+	swim := "BEGIN:VEVENT\r\nUID:swim\r\nSUMMARY:Swim\r\nEND:VEVENT\r\n"
+	run := "BEGIN:VEVENT\r\nUID:run\r\nSUMMARY:Run\r\nBEGIN:VALARM\r\nACTION:DISPLAY\r\nEND:VALARM\r\nEND:VEVENT\r\n"
+
+	for _, tc := range []struct {
+		name string
+		ics  string
+		want map[string]string
+	}{
+		{"no events", header + footer, map[string]string{}},
+		{
+			"events",
+			header + swim + run + footer,
+			map[string]string{"swim": header + swim + footer, "run": header + run + footer},
+		},
+		{
+			"METHOD is dropped, the rest of the header is kept",
+			header + "METHOD:PUBLISH\r\nX-WR-CALNAME:TVTC\r\n" + tz + swim + footer,
+			map[string]string{"swim": header + "X-WR-CALNAME:TVTC\r\n" + tz + swim + footer},
+		},
+		{
+			"components after the events are kept",
+			header + swim + run + tz + footer,
+			map[string]string{"swim": header + swim + tz + footer, "run": header + run + tz + footer},
+		},
+	} {
+		objects, err := splitCalendar([]byte(tc.ics))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+
+		got := map[string]string{}
+		for uid, obj := range objects {
+			got[uid] = string(obj.data)
+			if obj.event.Value("UID") != uid {
+				t.Errorf("%s: got event %s for %s", tc.name, obj.event.Value("UID"), uid)
+			}
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := splitCalendar([]byte("BEGIN:VCALENDAR\r\n")); err == nil {
+		t.Error("got no error for an invalid calendar")
+	}
+}
+
+// davServer is an in-memory CalDAV collection that supports the requests
+// made by caldavTarget.
+type davServer struct {
+	mu      sync.Mutex
+	objects map[string]string // path to calendar data
+	etags   map[string]int
+	deletes []string
+}
+
+func newDAVServer() (*davServer, *httptest.Server) {
+	s := &davServer{objects: map[string]string{}, etags: map[string]int{}}
+	return s, httptest.NewServer(s)
+}
+
+func (s *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	etag := func(p string) string {
+		return fmt.Sprintf(`"%d"`, s.etags[p])
+	}
+
+	switch r.Method {
+	case "REPORT":
+		var paths []string
+		for p := range s.objects {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		w.WriteHeader(207)
+		fmt.Fprint(w, `<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+		for _, p := range paths {
+			fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>%s</d:getetag><c:calendar-data>`, p, etag(p))
+			xml.EscapeText(w, []byte(s.objects[p]))
+			fmt.Fprint(w, `</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	case "PUT":
+		_, exists := s.objects[r.URL.Path]
+		if (r.Header.Get("If-None-Match") == "*" && exists) || (r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != etag(r.URL.Path)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		b, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = string(b)
+		s.etags[r.URL.Path]++
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if r.Header.Get("If-Match") != etag(r.URL.Path) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		delete(s.objects, r.URL.Path)
+		s.deletes = append(s.deletes, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// paths returns the paths of the objects on the server.
+func (s *davServer) paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []string
+	for p := range s.objects {
+		res = append(res, p)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+func TestCaldavPublish(t *testing.T) {
+	dav, srv := newDAVServer()
+	defer srv.Close()
+
+	target := &caldavTarget{url: srv.URL + "/cal/", templates: &Templates{}, client: srv.Client()}
+
+	// Next month, so that none of the workouts are in the past
+	now := time.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 6, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+
+	workout := func(uid string, day int, summary string) *Workout {
+		start := month.AddDate(0, 0, day)
+		return &Workout{UID: uid, Summary: summary, Start: start, End: start.Add(time.Hour)}
+	}
+
+	status := &TargetStatus{}
+	cal := &Calendar{Workouts: []*Workout{workout("swim", 1, "Swim"), workout("run", 2, "Run"), workout("ride", 3, "Ride")}}
+	if err := target.Publish(cal, status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Written != 3 {
+		t.Errorf("got %d events written, want 3", status.Written)
+	}
+
+	// An event added by hand in the same month, and one of ours in the month
+	// after, which isn't being published
+	dav.objects["/cal/party.ics"] = "BEGIN:VCALENDAR\r\nPRODID:-//someone else//\r\nBEGIN:VEVENT\r\nUID:party\r\nDTSTART:" + month.AddDate(0, 0, 5).Format(ICalTimeFormat) + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	next := &Calendar{Workouts: []*Workout{workout("race", 40, "Race")}}
+	if err := target.Publish(next, &TargetStatus{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The swim is unchanged, the run changed, and the ride was cancelled
+	status = &TargetStatus{}
+	cal = &Calendar{Workouts: []*Workout{workout("swim", 1, "Swim"), workout("run", 2, "Track & Run")}}
+	if err := target.Publish(cal, status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Written != 1 {
+		t.Errorf("got %d events written, want 1", status.Written)
+	}
+	if want := []string{"/cal/ride.ics"}; !reflect.DeepEqual(dav.deletes, want) {
+		t.Errorf("got deletes %v, want %v", dav.deletes, want)
+	}
+	if got, want := dav.paths(), []string{"/cal/party.ics", "/cal/race.ics", "/cal/run.ics", "/cal/swim.ics"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+	if !strings.Contains(dav.objects["/cal/run.ics"], "SUMMARY:Track & Run") {
+		t.Errorf("run wasn't updated:\n%s", dav.objects["/cal/run.ics"])
+	}
+	if strings.Contains(dav.objects["/cal/swim.ics"], "METHOD:") {
+		t.Errorf("calendar object has a METHOD:\n%s", dav.objects["/cal/swim.ics"])
+	}
+}
+
+func TestCaldavPublishDryRun(t *testing.T) {
+	dav, srv := newDAVServer()
+	defer srv.Close()
+
+	start := time.Now().AddDate(0, 1, 0)
+	cal := &Calendar{Workouts: []*Workout{{UID: "swim", Summary: "Swim", Start: start, End: start.Add(time.Hour)}}}
+
+	target := &caldavTarget{url: srv.URL + "/cal/", templates: &Templates{}, client: srv.Client(), dryRun: true}
+	if err := target.Publish(cal, &TargetStatus{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if paths := dav.paths(); len(paths) != 0 {
+		t.Errorf("got objects %v for a dry run", paths)
+	}
+}
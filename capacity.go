@@ -0,0 +1,11 @@
+package main
+
+import "github.com/jcrussell/tvtccal/tvtccal"
+
+// extractCapacity sets the Capacity and Remaining of each workout based on the
+// text of its summary and description.
+func extractCapacity(workouts []*Workout) {
+	for _, w := range workouts {
+		w.Capacity, w.Remaining = tvtccal.Capacity(w.Summary + "\n" + w.Description)
+	}
+}
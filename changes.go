@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ChangesFeedEntries is the number of runs kept in the -changes-feed.
+const ChangesFeedEntries = 50
+
+// atomFeed is an Atom feed, see RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    *atomLink   `xml:"link,omitempty"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// changesFeed is an Atom feed with an entry for every run that changed the
+// published calendar, so that members can follow what changed and when.
+type changesFeed struct {
+	fname string
+
+	// title and link describe the calendar the changes are for
+	title string
+	link  string
+}
+
+// add records the changes as a new entry, dropping the oldest entries past
+// ChangesFeedEntries. Does nothing if there are no changes.
+func (f *changesFeed) add(changes []EventChange, now time.Time) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	feed := &atomFeed{}
+
+	b, err := os.ReadFile(f.fname)
+	if err == nil {
+		if err := xml.Unmarshal(b, feed); err != nil {
+			return fmt.Errorf("unable to parse %s: %v", f.fname, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	now = now.UTC()
+
+	// Tag URIs (RFC 4151) give stable IDs without depending on where the
+	// feed is published
+	feed.ID = "tag:trivalleytriclub.com,2015:changes"
+	feed.Title = f.title + " schedule changes"
+	feed.Updated = now.Format(time.RFC3339)
+	feed.Author = atomAuthor{Name: "Tri-Valley Triathlon Club"}
+	feed.Link = nil
+	if f.link != "" {
+		feed.Link = &atomLink{Href: f.link}
+	}
+
+	var diff bytes.Buffer
+	printDiff(&diff, changes, false)
+
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.Kind]++
+	}
+
+	entry := atomEntry{
+		Title:   fmt.Sprintf("%d added, %d removed, %d changed", counts[Added], counts[Removed], counts[Changed]),
+		ID:      feed.ID + ":" + now.Format(time.RFC3339Nano),
+		Updated: feed.Updated,
+		Content: atomContent{Type: "text", Body: diff.String()},
+	}
+
+	feed.Entries = append([]atomEntry{entry}, feed.Entries...)
+	if len(feed.Entries) > ChangesFeedEntries {
+		feed.Entries = feed.Entries[:ChangesFeedEntries]
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(f.fname, append([]byte(xml.Header), append(out, '\n')...), 0644)
+}
+
+// writeAtomic writes b to a temporary file and renames it to fname so that
+// a crash can't leave a truncated file behind.
+func writeAtomic(fname string, b []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(fname), "."+filepath.Base(fname))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), fname)
+}
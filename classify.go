@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultType is assigned to workouts that do not match any type rule.
+const DefaultType = "other"
+
+// TypeRule assigns Type to any workout whose summary matches Match.
+type TypeRule struct {
+	Type  string `json:"type"`
+	Match string `json:"match"`
+
+	re *regexp.Regexp
+}
+
+// DefaultTypeRules are used when the config does not define any type rules.
+// Order matters, the first matching rule wins so races are checked before
+// the individual disciplines.
+var DefaultTypeRules = []TypeRule{
+	{Type: "race", Match: `(?i)\brace\b|triathlon|duathlon|aquathlon`},
+	{Type: "swim", Match: `(?i)swim|pool|open water`},
+	{Type: "bike", Match: `(?i)bike|ride|cycl|spin`},
+	{Type: "run", Match: `(?i)\brun|track|jog`},
+	{Type: "social", Match: `(?i)social|party|happy hour|potluck|meeting`},
+}
+
+// DefaultSports are used when the config does not map workout types to
+// sports. Types that aren't a single sport, such as social, have none.
+var DefaultSports = map[string]string{
+	"swim": "swim",
+	"bike": "bike",
+	"run":  "run",
+	"race": "multisport",
+}
+
+// compileTypeRules compiles the regular expressions for each rule.
+func compileTypeRules(rules []TypeRule) error {
+	for i := range rules {
+		if rules[i].Type == "" {
+			return fmt.Errorf("type rule %d: missing type", i)
+		}
+
+		re, err := regexp.Compile(rules[i].Match)
+		if err != nil {
+			return fmt.Errorf("type rule %d: %v", i, err)
+		}
+		rules[i].re = re
+	}
+
+	return nil
+}
+
+// classify returns the type of the first rule that matches the summary.
+func classify(rules []TypeRule, summary string) string {
+	for _, rule := range rules {
+		if rule.re.MatchString(summary) {
+			return rule.Type
+		}
+	}
+
+	return DefaultType
+}
+
+// Values of STATUS for VEVENTs, see RFC 5545 Sec 3.8.1.11.
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// StatusRule assigns Status to any workout whose summary or description
+// matches Match.
+type StatusRule struct {
+	Status string `json:"status"`
+	Match  string `json:"match"`
+
+	re *regexp.Regexp
+}
+
+// DefaultStatusRules are used when the config does not define any status
+// rules. The first matching rule wins, workouts that don't match any have no
+// STATUS.
+var DefaultStatusRules = []StatusRule{
+	{Status: StatusCancelled, Match: `(?i)\bcancell?ed\b`},
+	{Status: StatusTentative, Match: `(?i)weather permitting|\btentative\b|\btb[ad]\b`},
+}
+
+// compileStatusRules validates the statuses and compiles the regular
+// expressions for each rule.
+func compileStatusRules(rules []StatusRule) error {
+	for i := range rules {
+		switch rules[i].Status {
+		case StatusConfirmed, StatusTentative, StatusCancelled:
+		default:
+			return fmt.Errorf("status rule %d: invalid status: `%s`", i, rules[i].Status)
+		}
+
+		re, err := regexp.Compile(rules[i].Match)
+		if err != nil {
+			return fmt.Errorf("status rule %d: %v", i, err)
+		}
+		rules[i].re = re
+	}
+
+	return nil
+}
+
+// statusFor returns the status of the first rule that matches the workout.
+func statusFor(rules []StatusRule, w *Workout) string {
+	text := w.Summary + "\n" + w.Description
+
+	for _, rule := range rules {
+		if rule.re.MatchString(text) {
+			return rule.Status
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Subcommand is one of the roles of tvtccal, with its own flags. Running
+// tvtccal without a subcommand is the same as fetch.
+type Subcommand struct {
+	// Name is the subcommand, e.g. fetch or config show
+	Name string
+
+	// Args describes the arguments after the flags, if any
+	Args string
+
+	Summary string
+
+	// Flags are the flags that apply in addition to commonFlags
+	Flags []string
+
+	// Run runs the subcommand with the arguments left after the flags, once
+	// the flags are resolved and the config is loaded
+	Run func(config *Config, args []string) error
+}
+
+// Groups of flags shared by several subcommands.
+var (
+	commonFlags = []string{"config", "log-file", "log-max-size", "log-max-age", "log-backups", "proxy", "summary-out", "pushgateway", "pushgateway-job"}
+
+	// sourceFlags pick the pages of the club's calendar
+	sourceFlags = []string{"test", "back", "months", "year", "month", "site", "cache-dir", "plan"}
+
+	// buildFlags turn the workouts into a calendar
+	buildFlags = []string{
+		"match", "drop", "include", "exclude", "shift-start", "summary-prefix", "summary-suffix", "summary-template", "badges",
+		"lights", "uuid", "content-uids", "model", "durations", "number", "within", "dtstamp",
+		"cal-name", "cal-description", "cal-color", "templates", "template",
+		"state", "max-deviation", "refuse-anomalies",
+	}
+
+	// outputFlags write the calendar to files
+	outputFlags = []string{
+		"out", "format", "per-fixture", "minimal-update", "dry-run", "no-color", "landing", "feed-url",
+		"changes-feed", "max-changes", "force", "manifest", "manifest-key", "lock", "slack-webhook", "discord-webhook",
+		"encoding", "bom",
+	}
+
+	// syncFlags push the calendar to calendar services
+	syncFlags = []string{"intervals-athlete", "intervals-api-key", "caldav-url", "caldav-user", "caldav-password", "encoding", "dry-run", "force", "lock"}
+
+	// serviceFlags are those of fetch -daemon, which the service runs
+	serviceFlags = flags(sourceFlags, buildFlags, outputFlags, syncFlags, []string{"interval"})
+)
+
+// flags concatenates groups of flags.
+func flags(groups ...[]string) []string {
+	var res []string
+	for _, g := range groups {
+		res = append(res, g...)
+	}
+	return res
+}
+
+// subcommands are the subcommands, in the order that help lists them.
+var subcommands = []*Subcommand{
+	{
+		Name:    "fetch",
+		Summary: "fetch the club's calendar and write it to the -out files and sync targets",
+		Flags:   flags(sourceFlags, buildFlags, outputFlags, syncFlags, []string{"daemon", "interval"}),
+		Run:     fetchCmd,
+	},
+	{
+		Name:    "convert",
+		Args:    "FILE...",
+		Summary: "convert saved calendar pages, or - for stdin, to the -out files",
+		Flags:   flags([]string{"year", "month", "plan"}, buildFlags, outputFlags),
+		Run:     convertCmd,
+	},
+	{
+		Name:    "serve",
+		Args:    "ADDR",
+		Summary: "serve the calendar over HTTP at " + ServePath + " on ADDR, e.g. :8080 or unix:/run/tvtccal.sock",
+		Flags:   flags(sourceFlags, buildFlags, []string{"serve-interval", "tls-cert", "tls-key", "tls-domain", "slack-webhook", "discord-webhook", "encoding", "bom"}),
+		Run:     serveCmd,
+	},
+	{
+		Name:    "diff",
+		Args:    "[PREVIOUS]",
+		Summary: "print how the club's calendar differs from the first iCalendar -out or PREVIOUS",
+		Flags:   flags(sourceFlags, buildFlags, []string{"out", "format", "no-color", "encoding", "bom"}),
+		Run:     diffCmd,
+	},
+	{
+		Name:    "validate",
+		Args:    "FILE...",
+		Summary: "lint iCalendar files",
+		Run:     validateCmd,
+	},
+	{
+		Name:    "sync",
+		Summary: "fetch the club's calendar and push it to the sync targets only",
+		Flags:   flags(sourceFlags, buildFlags, syncFlags),
+		Run:     syncCmd,
+	},
+	{
+		Name:    "config show",
+		Summary: "print the settings and where each one came from",
+		Flags: flags(sourceFlags, buildFlags, outputFlags, syncFlags, []string{
+			"daemon", "interval", "serve-interval", "tls-cert", "tls-key", "tls-domain", "journal", "against", "backfill-delay", "manifest-key", "max-age",
+		}),
+		Run: configShowCmd,
+	},
+	{
+		Name:    "report volume",
+		Summary: "report the weekly training volume by sport",
+		Flags:   flags(sourceFlags, buildFlags),
+		Run:     volumeCmd,
+	},
+	{
+		Name:    "report attendance",
+		Summary: "report the workouts attended and skipped by type, see attend",
+		Flags:   flags(sourceFlags, buildFlags, []string{"journal"}),
+		Run:     attendanceCmd,
+	},
+	{
+		Name:    "attend",
+		Args:    "UID | DATE [SUMMARY]",
+		Summary: "record in the -journal that you attended the workout, e.g. attend 2026-10-12 masters",
+		Flags:   flags(sourceFlags, buildFlags, []string{"journal"}),
+		Run:     recordCmd(true),
+	},
+	{
+		Name:    "skip",
+		Args:    "UID | DATE [SUMMARY]",
+		Summary: "record in the -journal that you skipped the workout",
+		Flags:   flags(sourceFlags, buildFlags, []string{"journal"}),
+		Run:     recordCmd(false),
+	},
+	{
+		Name:    "classify review",
+		Summary: "correct the types of workouts that the type rules don't match, see -model",
+		Flags:   flags(sourceFlags, buildFlags),
+		Run:     reviewCmd,
+	},
+	{
+		Name:    "conflicts",
+		Summary: "list workouts that overlap events in -against",
+		Flags:   flags(sourceFlags, buildFlags, []string{"against"}),
+		Run:     conflictsCmd,
+	},
+	{
+		Name:    "backfill",
+		Summary: "push past and future months to the sync targets",
+		Flags:   flags(sourceFlags, buildFlags, syncFlags, []string{"backfill-delay"}),
+		Run:     backfillCmd,
+	},
+	{
+		Name:    "state export",
+		Args:    "[FILE]",
+		Summary: "write the -state and the UID settings to FILE, or stdout, to move to another host",
+		Flags:   []string{"state", "uuid", "content-uids"},
+		Run:     stateExportCmd,
+	},
+	{
+		Name:    "state import",
+		Args:    "FILE",
+		Summary: "replace the -state with one written by state export",
+		Flags:   []string{"state", "uuid", "content-uids", "force"},
+		Run:     stateImportCmd,
+	},
+	{
+		Name:    "service install",
+		Summary: "install fetch -daemon, with the options given, as a Windows service that starts with the machine",
+		Flags:   serviceFlags,
+		Run:     serviceInstallCmd,
+	},
+	{Name: "service start", Summary: "start the Windows service", Run: serviceStartCmd},
+	{Name: "service stop", Summary: "stop the Windows service once the run in progress is done", Run: serviceStopCmd},
+	{Name: "service remove", Summary: "remove the Windows service", Run: serviceRemoveCmd},
+	{
+		Name:    "service run",
+		Args:    "DIR",
+		Summary: "run as the Windows service installed by service install, which the service manager starts",
+		Flags:   serviceFlags,
+		Run:     serviceRunCmd,
+	},
+	{
+		Name:    "verify",
+		Args:    "MANIFEST FEED",
+		Summary: "check a published feed against its manifest",
+		Flags:   []string{"manifest-key", "max-age"},
+		Run:     verifyCmd,
+	},
+}
+
+// parseSubcommand returns the subcommand that args start with and the rest
+// of the args. Returns fetch if args start with a flag instead.
+func parseSubcommand(args []string) (*Subcommand, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return subcommands[0], args, nil
+	}
+
+	for _, cmd := range subcommands {
+		words := strings.Fields(cmd.Name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.Name {
+			return cmd, args[len(words):], nil
+		}
+	}
+
+	if args[0] == "help" {
+		return nil, nil, flag.ErrHelp
+	}
+
+	return nil, nil, fmt.Errorf("unknown subcommand: %s, see tvtccal help", args[0])
+}
+
+// flagSet returns a FlagSet with the flags that apply to the subcommand. They
+// share their values with options, so parsing it sets the same variables.
+// Other flags are an error, so that a typo or a flag meant for another
+// subcommand isn't silently ignored.
+func (c *Subcommand) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("tvtccal "+c.Name, flag.ContinueOnError)
+
+	for _, name := range flags(commonFlags, c.Flags) {
+		// Some flags are in several groups, e.g. encoding
+		if fs.Lookup(name) != nil {
+			continue
+		}
+
+		f := options.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+
+		// Not the value, which may already be set
+		fs.Lookup(name).DefValue = f.DefValue
+	}
+
+	fs.Usage = func() {
+		c.usage(fs.Output())
+	}
+
+	return fs
+}
+
+// usage prints every subcommand.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: tvtccal [SUBCOMMAND] [OPTION]... [ARG]...")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "subcommands:")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(w, "  %-18s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "without a subcommand, tvtccal runs fetch. tvtccal help SUBCOMMAND lists its options.")
+}
+
+// usage prints how to run the subcommand and its flags.
+func (c *Subcommand) usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s\n\n%s\n\n", strings.TrimSpace("tvtccal "+c.Name+" [OPTION]... "+c.Args), c.Summary)
+
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		def := f.DefValue
+		if _, err := strconv.ParseFloat(def, 64); err != nil && def != "true" && def != "false" {
+			def = strconv.Quote(def)
+		}
+
+		// Same format as the README
+		fmt.Fprintf(w, "  -%s=%s: %s\n", f.Name, def, f.Usage)
+	})
+}
+
+// exitStatus is returned by Run to exit with the status, after the run has
+// already reported what went wrong.
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+// convertFiles are the pages given to convert, see fixtures.
+var convertFiles []string
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestSubcommandFlags(t *testing.T) {
+	for _, cmd := range subcommands {
+		for _, name := range flags(commonFlags, cmd.Flags) {
+			if options.Lookup(name) == nil {
+				t.Errorf("%s: unknown flag -%s", cmd.Name, name)
+			}
+		}
+	}
+
+	// config show prints every setting, so it takes every flag
+	show, _, err := parseSubcommand([]string{"config", "show"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := show.flagSet()
+	options.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			t.Errorf("config show doesn't take -%s", f.Name)
+		}
+	})
+}
+
+func TestParseSubcommand(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		name string
+		rest int
+	}{
+		{nil, "fetch", 0},
+		{[]string{"-out", "tvtc.ics"}, "fetch", 2},
+		{[]string{"state", "export", "-state", "state.json", "state.tar"}, "state export", 3},
+		{[]string{"validate", "tvtc.ics"}, "validate", 1},
+	} {
+		cmd, rest, err := parseSubcommand(tc.args)
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+		} else if cmd.Name != tc.name || len(rest) != tc.rest {
+			t.Errorf("%v: got %s with %v", tc.args, cmd.Name, rest)
+		}
+	}
+
+	if _, _, err := parseSubcommand([]string{"state", "dump"}); err == nil {
+		t.Error("got no error for an unknown subcommand")
+	}
+	if _, _, err := parseSubcommand([]string{"help"}); err != flag.ErrHelp {
+		t.Errorf("got %v for help, want %v", err, flag.ErrHelp)
+	}
+}
+
+// TestFlagSet checks that each subcommand only accepts its own flags, and
+// that they set the same variables as the other subcommands.
+func TestFlagSet(t *testing.T) {
+	defer func(saved string) { *serveInterval = saved }(*serveInterval)
+
+	serve, _, _ := parseSubcommand([]string{"serve"})
+
+	fs := serve.flagSet()
+	if err := fs.Parse([]string{"-serve-interval", "15m", ":8080"}); err != nil {
+		t.Fatal(err)
+	}
+	if *serveInterval != "15m" || fs.Arg(0) != ":8080" {
+		t.Errorf("got -serve-interval %s and %v", *serveInterval, fs.Args())
+	}
+
+	// The defaults are still listed as such
+	if def := serve.flagSet().Lookup("serve-interval").DefValue; def != "1h" {
+		t.Errorf("got default %s, want 1h", def)
+	}
+
+	validate, _, _ := parseSubcommand([]string{"validate"})
+
+	fs = validate.flagSet()
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse([]string{"-serve-interval", "15m", "tvtc.ics"}); err == nil {
+		t.Error("validate accepted -serve-interval")
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// fetchCmd publishes the calendar to the -out files and sync targets, once
+// or, with -daemon, every -interval.
+func fetchCmd(config *Config, args []string) error {
+	if err := checkQuietHours(false); err != nil {
+		return err
+	}
+
+	if *daemonMode {
+		interval, err := parseDuration(*daemonInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid -interval: %s", *daemonInterval)
+		}
+
+		return daemon(config, interval)
+	}
+
+	release, err := runLock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	failed, total, err := publishAll(config)
+	if err != nil {
+		return err
+	}
+
+	if err := runSummary.write(*summaryOut); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := runSummary.push(*pushgateway, *pushgatewayJob); err != nil {
+		log.Print(err)
+	}
+
+	if failed == total {
+		return exitStatus(1)
+	} else if failed > 0 {
+		return exitStatus(ExitPartialFailure)
+	}
+
+	return nil
+}
+
+// convertCmd publishes the calendar from the saved pages instead of the
+// club's site.
+func convertCmd(config *Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: tvtccal convert [OPTION]... FILE...")
+	}
+
+	convertFiles = args
+
+	return fetchCmd(config, nil)
+}
+
+// syncCmd publishes the calendar to the sync targets without the -out files.
+func syncCmd(config *Config, args []string) error {
+	if *intervalsAthlete == "" && *caldavURL == "" {
+		return errors.New("sync requires a sync target, see -intervals-athlete and -caldav-url")
+	}
+
+	// Not even the default one
+	outFiles.Values = nil
+
+	return fetchCmd(config, nil)
+}
+
+func serveCmd(config *Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tvtccal serve [OPTION]... ADDR")
+	}
+
+	if err := checkQuietHours(true); err != nil {
+		return err
+	}
+
+	interval, err := parseDuration(*serveInterval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid -serve-interval: %s", *serveInterval)
+	}
+
+	return serve(args[0], interval, config, newTemplates(config))
+}
+
+// diffCmd prints the changes from the previous calendar, which defaults to
+// the first iCalendar -out.
+func diffCmd(config *Config, args []string) error {
+	var prev string
+	switch {
+	case len(args) > 1:
+		return errors.New("usage: diff [PREVIOUS], a file or URL")
+	case len(args) == 1:
+		prev = args[0]
+	default:
+		for _, out := range outFiles.Values {
+			format, fname := splitOut(out)
+			if format == "" {
+				format = *outFormat
+			}
+
+			if format, err := formatFor(fname, format); err == nil && format == FormatICal {
+				prev = fname
+				break
+			}
+		}
+	}
+
+	if prev == "" {
+		return errors.New("diff requires an iCalendar -out or the previous calendar as an argument")
+	}
+
+	client, err := newHTTPClient(*proxy)
+	if err != nil {
+		return err
+	}
+
+	cals, err := loadCalendars(config)
+	if err != nil {
+		return err
+	}
+
+	templates := newTemplates(config)
+
+	for _, cal := range cals {
+		prev := prev
+		if len(args) == 0 {
+			if prev, err = expandOutName(prev, cal, ""); err != nil {
+				return err
+			}
+		}
+
+		if err := runDiff(os.Stdout, client, prev, cal, templates, !*noColor && os.Getenv("NO_COLOR") == ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateCmd(config *Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: tvtccal validate FILE...")
+	}
+
+	if lintFiles(args) > 0 {
+		return exitStatus(1)
+	}
+
+	return nil
+}
+
+func configShowCmd(config *Config, args []string) error {
+	return config.show(os.Stdout)
+}
+
+func volumeCmd(config *Config, args []string) error {
+	cals, err := loadCalendars(config)
+	if err != nil {
+		return err
+	}
+
+	b, err := reportVolume(allWorkouts(cals), config)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+func attendanceCmd(config *Config, args []string) error {
+	if *journalFile == "" {
+		return errors.New("report attendance requires -journal")
+	}
+
+	journal, err := loadJournal(*journalFile)
+	if err != nil {
+		return err
+	}
+
+	cals, err := loadCalendars(config)
+	if err != nil {
+		return err
+	}
+
+	b, err := reportAttendance(allWorkouts(cals), journal, config, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+// recordCmd returns the Run of attend, or of skip if attended is false.
+func recordCmd(attended bool) func(*Config, []string) error {
+	name, verb := "attend", "attended"
+	if !attended {
+		name, verb = "skip", "skipped"
+	}
+
+	return func(config *Config, args []string) error {
+		if *journalFile == "" {
+			return fmt.Errorf("%s requires -journal", name)
+		}
+
+		journal, err := loadJournal(*journalFile)
+		if err != nil {
+			return err
+		}
+
+		cals, err := loadCalendars(config)
+		if err != nil {
+			return err
+		}
+
+		w, err := findWorkout(allWorkouts(cals), args)
+		if err != nil {
+			return err
+		}
+
+		journal.record(w, attended, time.Now())
+		if err := journal.save(*journalFile); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s %s on %s\n", verb, w.Summary, w.Start.Format("Mon Jan 2 3:04 PM"))
+		return nil
+	}
+}
+
+// reviewCmd asks for the types of the workouts before they are built into
+// calendars, so that it sees the summaries from the club's site.
+func reviewCmd(config *Config, args []string) error {
+	if *modelFile == "" {
+		return errors.New("classify review requires -model")
+	}
+
+	pages, err := loadPages()
+	if err != nil {
+		return err
+	}
+
+	groups, _, _, err := fetchGroups(pages)
+	if err != nil {
+		return err
+	}
+
+	var workouts []*Workout
+	for _, group := range groups {
+		workouts = append(workouts, group...)
+	}
+
+	if n := config.review(os.Stdin, os.Stdout, workouts); n > 0 {
+		if err := config.model.save(*modelFile); err != nil {
+			return err
+		}
+		fmt.Printf("saved %d types to %s\n", n, *modelFile)
+	}
+
+	return nil
+}
+
+func conflictsCmd(config *Config, args []string) error {
+	if *against == "" {
+		return errors.New("conflicts requires -against")
+	}
+
+	cals, err := loadCalendars(config)
+	if err != nil {
+		return err
+	}
+
+	return checkConflicts(os.Stdout, allWorkouts(cals), *against)
+}
+
+func backfillCmd(config *Config, args []string) error {
+	delay, err := parseDuration(*backfillDelay)
+	if err != nil {
+		return fmt.Errorf("invalid -backfill-delay: %v", err)
+	}
+
+	failed, months, err := runBackfill(config, delay)
+	if err != nil {
+		return err
+	}
+
+	if err := runSummary.write(*summaryOut); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := runSummary.push(*pushgateway, *pushgatewayJob); err != nil {
+		log.Print(err)
+	}
+
+	if failed == months {
+		return exitStatus(1)
+	} else if failed > 0 {
+		return exitStatus(ExitPartialFailure)
+	}
+
+	return nil
+}
+
+func stateExportCmd(config *Config, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: state export [FILE]")
+	}
+
+	var fname string
+	if len(args) == 1 {
+		fname = args[0]
+	}
+
+	return exportState(os.Stdout, config, fname)
+}
+
+func stateImportCmd(config *Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: state import FILE, or - for stdin")
+	}
+
+	export, err := importState(config, args[0], *force)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("imported %d events and %d runs exported on %s", len(export.State.Events), len(export.State.Runs), export.Exported.Format("Jan 2 15:04"))
+	return nil
+}
+
+func verifyCmd(config *Config, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: verify MANIFEST FEED, each a file or URL")
+	}
+
+	var age time.Duration
+	if *maxAge != "" {
+		var err error
+		if age, err = parseDuration(*maxAge); err != nil {
+			return fmt.Errorf("invalid -max-age: %v", err)
+		}
+	}
+
+	client, err := newHTTPClient(*proxy)
+	if err != nil {
+		return err
+	}
+
+	return runVerify(os.Stdout, client, args[0], args[1], *manifestKey, age)
+}
+
+// allWorkouts returns the workouts of every calendar.
+func allWorkouts(cals []*Calendar) []*Workout {
+	var workouts []*Workout
+	for _, cal := range cals {
+		workouts = append(workouts, cal.Workouts...)
+	}
+
+	return workouts
+}
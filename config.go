@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jcrussell/tvtccal/tvtccal"
+)
+
+// EnvPrefix is prepended to the flag name, uppercased with dashes replaced
+// by underscores, to get the environment variable for a flag.
+const EnvPrefix = "TVTCCAL_"
+
+// Sources of flag values, in order of precedence.
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceConfig  = "config"
+	SourceDefault = "default"
+)
+
+// secretName matches setting names whose values are redacted by config show.
+var secretName = regexp.MustCompile(`(?i)token|secret|password|passwd|key|credential`)
+
+// urlName matches setting names whose values are URLs that may carry a secret
+// in their path or query, such as webhooks, config show only prints their
+// scheme and host.
+var urlName = regexp.MustCompile(`(?i)webhook|url`)
+
+// redactValue returns the value of the named setting as config show prints
+// it.
+func redactValue(name, v string) string {
+	if v == "" {
+		return v
+	}
+
+	if secretName.MatchString(name) {
+		return "REDACTED"
+	}
+
+	if urlName.MatchString(name) {
+		u, err := url.Parse(v)
+		if err != nil || u.Host == "" {
+			return "REDACTED"
+		}
+
+		if u.User != nil || u.RawQuery != "" || strings.Trim(u.Path, "/") != "" {
+			return u.Scheme + "://" + u.Host + "/REDACTED"
+		}
+	}
+
+	return v
+}
+
+// Config holds the settings that are too structured for flags. It is loaded
+// from the JSON file specified by -config. The file may also set any flag by
+// name, see resolveFlags for the precedence.
+type Config struct {
+	// Types classifies workouts based on their summary, defaults to
+	// DefaultTypeRules.
+	Types []TypeRule `json:"types"`
+
+	// Statuses set the iCal STATUS of workouts based on their summary and
+	// description, defaults to DefaultStatusRules. An empty list disables
+	// them.
+	Statuses []StatusRule `json:"status"`
+
+	// Sports maps workout types to the sport of the JSON output, defaults
+	// to DefaultSports.
+	Sports map[string]string `json:"sports"`
+
+	// Priority maps workout types to iCal PRIORITY values, 1 is the highest
+	// and 9 the lowest. Unmapped types are left undefined (0).
+	Priority map[string]int `json:"priority"`
+
+	// Alarms are the alarm rules, see parseAlarmRules for the syntax.
+	Alarms string `json:"alarms"`
+
+	// AlarmEmail is the address that EMAIL alarms are sent to.
+	AlarmEmail string `json:"alarm_email"`
+
+	// CalendarProperties are extra X- properties added to the VCALENDAR.
+	CalendarProperties map[string]string `json:"calendar_properties"`
+
+	// EventProperties are extra X- properties added to every VEVENT. Values
+	// are templates executed against the Workout.
+	EventProperties map[string]string `json:"event_properties"`
+
+	// Badges maps workout types to the emoji or tag used by -badges,
+	// defaults to DefaultBadges.
+	Badges map[string]string `json:"type_badges"`
+
+	// Rules rewrite matching workouts, see Rule.
+	Rules []Rule `json:"rules"`
+
+	// ShiftStart maps workout types to start shifts (e.g. "-15m") that
+	// override -shift-start.
+	ShiftStart map[string]string `json:"shift_start"`
+
+	// Landing configures the page written by -landing.
+	Landing Landing `json:"landing_page"`
+
+	// Home is where -within measures distances from.
+	Home *Coordinates `json:"home"`
+
+	// Venues are the coordinates of each venue for -within, keyed by the
+	// venue's name, the part of the location before the first comma.
+	Venues map[string]Coordinates `json:"venues"`
+
+	// Daylight configures the sunset notes added by -lights.
+	Daylight Daylight `json:"daylight"`
+
+	// UIDNamespace is the UUID namespace of the UIDs generated by -uuid,
+	// defaults to DefaultUIDNamespace.
+	UIDNamespace string `json:"uid_namespace"`
+
+	// Notifications configures where to send notifications about runs, see
+	// NotifierConfig.
+	Notifications []NotifierConfig `json:"notifications"`
+
+	// Locale is the language of the strings tvtccal generates, such as
+	// headings and dates, defaults to DefaultLocale.
+	Locale string `json:"locale"`
+
+	// SeasonStart is the first day of the season, e.g. 2026-01-05, that
+	// workouts are numbered from, see -number.
+	SeasonStart string `json:"season_start"`
+
+	// Precedence is the order in which the sources of a workout that is in
+	// more than one of them (site, plan) are tried for each field, see
+	// reconcile.
+	Precedence map[string][]string `json:"precedence"`
+
+	// Selectors are the CSS selectors that find the calendar on the club's
+	// page, see tvtccal.Selectors.
+	Selectors tvtccal.Selectors `json:"selectors"`
+
+	// ServeAuth requires authentication for the routes of serve, see
+	// AuthRule.
+	ServeAuth []AuthRule `json:"serve_auth"`
+
+	alarmRules []AlarmRule
+	calProps   []PropertyTemplate
+	eventProps []PropertyTemplate
+
+	// uidNamespace is the parsed UIDNamespace
+	uidNamespace []byte
+
+	// seasonStart is the parsed SeasonStart, zero if unset
+	seasonStart time.Time
+
+	// model is the classifier learned from corrections, see -model
+	model *TypeModel
+
+	// flags are the values for flags set in the config file, lists are
+	// used for flags that may be repeated
+	flags map[string][]string
+
+	// sources are where the value of each flag of the subcommand came from,
+	// see resolveFlags
+	sources map[string]string
+}
+
+// loadConfig reads the config from fname. If fname is empty, the default
+// config is returned.
+func loadConfig(fname string) (*Config, error) {
+	config := &Config{flags: map[string][]string{}}
+
+	if fname != "" {
+		b, err := os.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := config.parse(b); err != nil {
+			return nil, fmt.Errorf("unable to parse config %s: %v", fname, err)
+		}
+	}
+
+	if config.Badges == nil {
+		config.Badges = DefaultBadges
+	}
+
+	if config.Sports == nil {
+		config.Sports = DefaultSports
+	}
+
+	if len(config.Types) == 0 {
+		config.Types = append([]TypeRule{}, DefaultTypeRules...)
+	}
+
+	err := compileTypeRules(config.Types)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Statuses == nil {
+		config.Statuses = append([]StatusRule{}, DefaultStatusRules...)
+	}
+
+	if err := compileStatusRules(config.Statuses); err != nil {
+		return nil, err
+	}
+
+	if err := checkLocale(config.Locale); err != nil {
+		return nil, err
+	}
+
+	if config.UIDNamespace == "" {
+		config.UIDNamespace = DefaultUIDNamespace
+	}
+
+	config.uidNamespace, err = parseUUID(config.UIDNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid_namespace: %v", err)
+	}
+
+	if config.SeasonStart != "" {
+		if config.seasonStart, err = parseSeasonStart(config.SeasonStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkPrecedence(config.Precedence); err != nil {
+		return nil, err
+	}
+
+	if err := config.Selectors.Check(); err != nil {
+		return nil, err
+	}
+
+	if err := checkAuthRules(config.ServeAuth); err != nil {
+		return nil, err
+	}
+
+	for typ, p := range config.Priority {
+		if p < 0 || p > 9 {
+			return nil, fmt.Errorf("invalid priority for %s: %d", typ, p)
+		}
+	}
+
+	config.alarmRules, err = parseAlarmRules(config.Alarms)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range config.alarmRules {
+		for _, a := range rule.Alarms {
+			if a.Action == "EMAIL" && config.AlarmEmail == "" {
+				return nil, errors.New("email alarms require alarm_email")
+			}
+		}
+	}
+
+	for i := range config.Rules {
+		if err := config.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+
+	config.calProps, err = compileProperties(config.CalendarProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	config.eventProps, err = compileProperties(config.EventProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// parse decodes the config file. Top-level keys that match flag names are
+// saved as flag values, the rest are decoded into the Config.
+func (c *Config) parse(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	for k, v := range raw {
+		if options.Lookup(k) == nil {
+			continue
+		}
+
+		var s string
+		var list []string
+		if err := json.Unmarshal(v, &s); err == nil {
+			list = []string{s}
+		} else if err := json.Unmarshal(v, &list); err != nil {
+			// Not a string or list, use the literal value (e.g. true, 10)
+			list = []string{string(bytes.TrimSpace(v))}
+		}
+
+		c.flags[k] = list
+		delete(raw, k)
+	}
+
+	rest, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(rest))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(c)
+}
+
+// envName returns the environment variable for the named flag.
+func envName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// resolveFlags applies environment variables and then config values to the
+// flags that were not set on the command line, giving the precedence flags >
+// env > config file > defaults. Returns the source of each flag's value. The
+// config is optional so that the config path itself can be resolved first.
+func resolveFlags(fs *flag.FlagSet, config *Config) (map[string]string, error) {
+	sources := map[string]string{}
+
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = SourceFlag
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := sources[f.Name]; ok || err != nil {
+			return
+		}
+
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			// Repeated flags are comma separated in the environment
+			vals := []string{v}
+			if _, ok := f.Value.(*stringsFlag); ok {
+				vals = strings.Split(v, ",")
+			}
+
+			if err = setFlag(f, vals); err != nil {
+				err = fmt.Errorf("invalid value for %s: %v", envName(f.Name), err)
+			}
+			sources[f.Name] = SourceEnv
+		} else if vals, ok := config.flags[f.Name]; ok {
+			if err = setFlag(f, vals); err != nil {
+				err = fmt.Errorf("invalid value for %s in config: %v", f.Name, err)
+			}
+			sources[f.Name] = SourceConfig
+		} else {
+			sources[f.Name] = SourceDefault
+		}
+	})
+
+	return sources, err
+}
+
+// setFlag sets the flag to each of the values in turn.
+func setFlag(f *flag.Flag, vals []string) error {
+	for _, v := range vals {
+		if err := f.Value.Set(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// show prints the effective flag values, with their sources, and the rest of
+// the config. Secret values are redacted.
+func (c *Config) show(w io.Writer) error {
+	fmt.Fprintln(w, "# flags (flag > env > config > default)")
+
+	options.VisitAll(func(f *flag.Flag) {
+		v := redactValue(f.Name, f.Value.String())
+
+		fmt.Fprintf(w, "%s=%q (%s)\n", f.Name, v, c.sources[f.Name])
+	})
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	b, err = json.MarshalIndent(redact(v), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "# config")
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// redact replaces the values for secret keys in decoded JSON.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if s, ok := val.(string); ok {
+				v[k] = redactValue(k, s)
+			} else if secretName.MatchString(k) && val != nil {
+				v[k] = "REDACTED"
+			} else {
+				v[k] = redact(val)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+
+	return v
+}
+
+// apply fills in the fields of each workout that are derived from the config.
+func (c *Config) apply(workouts []*Workout) error {
+	for _, w := range workouts {
+		// Workouts from the plan may have their type already
+		if w.Type == "" {
+			w.Type, _ = c.classifyWorkout(w.Summary)
+		}
+		w.Sport = c.Sports[w.Type]
+		w.Status = statusFor(c.Statuses, w)
+		w.Priority = c.Priority[w.Type]
+		w.Alarms = alarmsFor(c.alarmRules, w, c.AlarmEmail)
+	}
+
+	return applyRules(c.Rules, workouts)
+}
+
+// expandEventProperties adds the event properties to each workout. It is
+// called once the workouts are final, so that the templates see the
+// durations, shifted starts, decorated summaries, and UIDs. They come before
+// the properties added by rules.
+func (c *Config) expandEventProperties(workouts []*Workout) error {
+	for _, w := range workouts {
+		props, err := expandProperties(c.eventProps, w)
+		if err != nil {
+			return err
+		}
+		w.Properties = append(props, w.Properties...)
+	}
+
+	return nil
+}
+
+// calendar creates the Calendar for the workouts, including any calendar
+// level properties.
+func (c *Config) calendar(workouts []*Workout) (*Calendar, error) {
+	props, err := expandProperties(c.calProps, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Calendar{Properties: props, Workouts: workouts}, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestResolveFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, name := range []string{"both", "env", "config", "default"} {
+		fs.String(name, name+"-default", "")
+	}
+
+	if err := fs.Parse([]string{"-both=flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(envName("both"), "env")
+	t.Setenv(envName("env"), "env")
+
+	config := &Config{flags: map[string][]string{"both": {"config"}, "env": {"config"}, "config": {"config"}}}
+
+	sources, err := resolveFlags(fs, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, value, source string
+	}{
+		{"both", "flag", SourceFlag},
+		{"env", "env", SourceEnv},
+		{"config", "config", SourceConfig},
+		{"default", "default-default", SourceDefault},
+	} {
+		if v := fs.Lookup(tc.name).Value.String(); v != tc.value {
+			t.Errorf("%s: got `%s`, want `%s`", tc.name, v, tc.value)
+		}
+		if sources[tc.name] != tc.source {
+			t.Errorf("%s: got source %s, want %s", tc.name, sources[tc.name], tc.source)
+		}
+	}
+}
+
+func TestResolveFlagsRepeated(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	env := &stringsFlag{Values: []string{"tvtc.ical"}}
+	config := &stringsFlag{Values: []string{"tvtc.ical"}}
+	fs.Var(env, "env", "")
+	fs.Var(config, "config", "")
+
+	t.Setenv(envName("env"), "tvtc.ics,tvtc.json")
+
+	if _, err := resolveFlags(fs, &Config{flags: map[string][]string{"config": {"tvtc.md", "tvtc.json"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"tvtc.ics", "tvtc.json"}; !reflect.DeepEqual(env.Values, want) {
+		t.Errorf("env: got %v, want %v", env.Values, want)
+	}
+	if want := []string{"tvtc.md", "tvtc.json"}; !reflect.DeepEqual(config.Values, want) {
+		t.Errorf("config: got %v, want %v", config.Values, want)
+	}
+}
+
+func TestResolveFlagsInvalid(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("count", 0, "")
+
+	t.Setenv(envName("count"), "ten")
+
+	if _, err := resolveFlags(fs, &Config{}); err == nil || err.Error() != `invalid value for TVTCCAL_COUNT: parse error` {
+		t.Errorf("got %v, want an invalid value error", err)
+	}
+}
+
+func TestConfigParse(t *testing.T) {
+	c := &Config{flags: map[string][]string{}}
+
+	err := c.parse([]byte(`{"out": ["club.ics", "club.md"], "minimal-update": true, "test": "march.html", "priority": {"swim": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string][]string{"out": {"club.ics", "club.md"}, "minimal-update": {"true"}, "test": {"march.html"}}; !reflect.DeepEqual(c.flags, want) {
+		t.Errorf("got flags %v, want %v", c.flags, want)
+	}
+	if c.Priority["swim"] != 1 {
+		t.Errorf("got priorities %v", c.Priority)
+	}
+
+	if err := (&Config{flags: map[string][]string{}}).parse([]byte(`{"outfile": "club.ics"}`)); err == nil {
+		t.Error("got no error for an unknown key")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(`{"api_key": "abc", "token": "", "types": [{"type": "swim", "secret": "x"}], "alarm_email": "me@example.com"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"api_key":     "REDACTED",
+		"token":       "",
+		"types":       []interface{}{map[string]interface{}{"type": "swim", "secret": "REDACTED"}},
+		"alarm_email": "me@example.com",
+	}
+	if got := redact(v); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// icalDuration matches iCal DURATION values, e.g. PT1H30M or P1D.
+var icalDuration = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// busy is a block of time in a personal calendar.
+type busy struct {
+	Summary    string
+	Start, End time.Time
+	AllDay     bool
+}
+
+// Conflict is a workout that overlaps with personal commitments.
+type Conflict struct {
+	Workout *Workout
+	With    []busy
+}
+
+// parseICalDuration parses an iCal DURATION value.
+func parseICalDuration(v string) (time.Duration, error) {
+	m := icalDuration.FindStringSubmatch(v)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration: `%s`", v)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+
+	return d, nil
+}
+
+// readBusy reads the events that block time from a personal calendar.
+// Transparent (free) and cancelled events don't block time. Recurring events
+// aren't expanded, they are skipped with a warning.
+func readBusy(r io.Reader, loc *time.Location) ([]busy, error) {
+	roots, err := parseICS(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []busy
+	recurring := 0
+
+	for _, root := range roots {
+		for _, ev := range root.Sub("VEVENT") {
+			if ev.Value("TRANSP") == "TRANSPARENT" || ev.Value("STATUS") == "CANCELLED" {
+				continue
+			}
+
+			if ev.Get("RRULE") != nil {
+				recurring++
+				continue
+			}
+
+			dtstart := ev.Get("DTSTART")
+			if dtstart == nil {
+				continue
+			}
+
+			start, allDay, err := parseICalTime(dtstart, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", dtstart.Line, err)
+			}
+
+			b := busy{Summary: ev.Value("SUMMARY"), Start: start, End: start, AllDay: allDay}
+
+			if dtend := ev.Get("DTEND"); dtend != nil {
+				if b.End, _, err = parseICalTime(dtend, loc); err != nil {
+					return nil, fmt.Errorf("line %d: %v", dtend.Line, err)
+				}
+			} else if dur := ev.Get("DURATION"); dur != nil {
+				d, err := parseICalDuration(dur.Value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", dur.Line, err)
+				}
+				b.End = start.Add(d)
+			} else if allDay {
+				b.End = start.AddDate(0, 0, 1)
+			}
+
+			res = append(res, b)
+		}
+	}
+
+	if recurring > 0 {
+		warnf("skipped %d recurring events, only single events are checked", recurring)
+	}
+
+	return res, nil
+}
+
+// findConflicts returns the workouts that overlap with the busy times.
+func findConflicts(workouts []*Workout, times []busy) []Conflict {
+	var res []Conflict
+
+	for _, w := range workouts {
+		c := Conflict{Workout: w}
+
+		for _, b := range times {
+			if w.Start.Before(b.End) && b.Start.Before(w.End) {
+				c.With = append(c.With, b)
+			}
+		}
+
+		if len(c.With) > 0 {
+			res = append(res, c)
+		}
+	}
+
+	return res
+}
+
+// checkConflicts reports the upcoming workouts that clash with the events in
+// the personal calendar fname.
+func checkConflicts(w io.Writer, workouts []*Workout, fname string) error {
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	times, err := readBusy(f, loc)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fname, err)
+	}
+
+	now := time.Now()
+
+	var upcoming []*Workout
+	for _, w := range workouts {
+		if w.End.After(now) {
+			upcoming = append(upcoming, w)
+		}
+	}
+
+	conflicts := findConflicts(upcoming, times)
+
+	for _, c := range conflicts {
+		fmt.Fprintf(w, "%s %s\n", c.Workout.Start.Format("Mon Jan 2 3:04 PM"), c.Workout.Summary)
+		for _, b := range c.With {
+			if b.AllDay {
+				fmt.Fprintf(w, "    all day: %s\n", b.Summary)
+			} else {
+				fmt.Fprintf(w, "    %s-%s: %s\n", b.Start.In(loc).Format("3:04 PM"), b.End.In(loc).Format("3:04 PM"), b.Summary)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "%d of %d upcoming workouts conflict\n", len(conflicts), len(upcoming))
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+)
+
+// CSV formats for calendar apps that import CSV files.
+const (
+	FormatGoogleCSV  = "gcal-csv"
+	FormatOutlookCSV = "outlook-csv"
+
+	// FormatCSV is an alias for FormatGoogleCSV, the layout most calendar
+	// apps can import
+	FormatCSV = "csv"
+)
+
+// csvFormat is the layout of a CSV import file.
+type csvFormat struct {
+	header []string
+	row    func(w *Workout) []string
+}
+
+// csvFormats are the supported CSV layouts, by format name.
+var csvFormats = map[string]csvFormat{
+	// Google Calendar, see "Create or edit a CSV file" in its help
+	FormatGoogleCSV: {
+		header: []string{"Subject", "Start Date", "Start Time", "End Date", "End Time", "Location", "Description"},
+		row: func(w *Workout) []string {
+			return []string{
+				w.Summary,
+				w.Start.Format("01/02/2006"),
+				w.Start.Format("03:04 PM"),
+				w.End.Format("01/02/2006"),
+				w.End.Format("03:04 PM"),
+				w.Location,
+				w.Description,
+			}
+		},
+	},
+
+	// Outlook, uses the column names from its own CSV export
+	FormatOutlookCSV: {
+		header: []string{"Subject", "Start Date", "Start Time", "End Date", "End Time", "All day event", "Categories", "Description", "Location"},
+		row: func(w *Workout) []string {
+			return []string{
+				w.Summary,
+				w.Start.Format("1/2/2006"),
+				w.Start.Format("3:04:05 PM"),
+				w.End.Format("1/2/2006"),
+				w.End.Format("3:04:05 PM"),
+				"False",
+				w.Type,
+				w.Description,
+				w.Location,
+			}
+		},
+	},
+}
+
+// renderCSV renders the workouts as a CSV file in the given layout.
+func renderCSV(cal *Calendar, format csvFormat) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+	w.Write(format.header)
+
+	for _, workout := range cal.Workouts {
+		w.Write(format.row(workout))
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DaemonJitter is the largest fraction of -interval added to each wait, so
+// that daemons started together don't all hit the club's site at once.
+const DaemonJitter = 0.1
+
+// cycle is a single run of the daemon: it fetches the calendar and publishes
+// it to every target, like fetch without -daemon. The -lock is only held
+// during the cycle, so that a manual run can go between two.
+func cycle(config *Config) error {
+	release, err := runLock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	*runSummary = *newRunSummary()
+
+	failed, total, err := publishAll(config)
+	if err != nil {
+		return err
+	}
+
+	if err := runSummary.write(*summaryOut); err != nil {
+		log.Print(err)
+	}
+
+	if err := runSummary.push(*pushgateway, *pushgatewayJob); err != nil {
+		log.Print(err)
+	}
+
+	if failed > 0 {
+		log.Printf("%d of %d targets failed", failed, total)
+	}
+
+	return nil
+}
+
+// daemon runs a cycle every interval, plus up to DaemonJitter of it, until
+// SIGINT or SIGTERM. A cycle in progress is finished first so that no output
+// is left half written. Failed cycles are reported and retried on the next
+// one, only a failed first cycle is returned so that a broken setup fails
+// fast.
+func daemon(config *Config, interval time.Duration) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	return runDaemon(config, interval, stop)
+}
+
+// runDaemon runs the cycles of daemon until stop receives, e.g. from the
+// Windows service manager instead of a signal.
+func runDaemon(config *Config, interval time.Duration, stop <-chan os.Signal) error {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for first := true; ; first = false {
+		if err := cycle(config); err != nil {
+			if first {
+				return err
+			}
+
+			log.Printf("run failed: %v", err)
+			fail(err)
+		}
+
+		wait := interval + time.Duration(rnd.Float64()*DaemonJitter*float64(interval))
+		log.Printf("next run at %s", time.Now().Add(wait).Format("Jan 2 15:04"))
+
+		select {
+		case sig := <-stop:
+			log.Printf("%v, exiting", sig)
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCycleLock checks that each daemon cycle takes the -lock and releases it
+// when it is done, instead of holding it for the daemon's lifetime.
+func TestCycleLock(t *testing.T) {
+	dir := t.TempDir()
+
+	page := filepath.Join(dir, "october.html")
+	if err := os.WriteFile(page, []byte(octoberPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(test, lock string, out []string) {
+		*testFile, *lockPath, outFiles.Values = test, lock, out
+	}(*testFile, *lockPath, outFiles.Values)
+
+	*testFile = page
+	*lockPath = filepath.Join(dir, ".tvtccal.lock")
+	outFiles.Values = []string{filepath.Join(dir, "tvtc.ics")}
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cycle(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Released after the cycle
+	release, err := acquireLock(*lockPath)
+	if err != nil {
+		t.Fatalf("lock still held after the cycle: %v", err)
+	}
+
+	// A cycle while another run holds it fails, and is retried by daemon
+	if err := cycle(config); err == nil || !strings.Contains(err.Error(), ErrLocked.Error()) {
+		t.Errorf("got %v, want %v", err, ErrLocked)
+	}
+	release()
+
+	if err := cycle(config); err != nil {
+		t.Errorf("after the other run: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Decorator rewrites workout summaries so that club events stand out when
+// merged into a personal calendar.
+type Decorator struct {
+	// Template, if set, replaces the summary. It is executed against the
+	// Workout so {{.Summary}} is the original summary.
+	Template string
+
+	// Number annotates the summary with the week of the season or the
+	// session number, see number. Locale is the language of the annotation.
+	Number string
+	Locale string
+
+	// Prefix and Suffix are added around the (templated) summary
+	Prefix string
+	Suffix string
+
+	// Badges, if set, maps workout types to an emoji or short tag that is
+	// prepended to the summary
+	Badges map[string]string
+}
+
+// DefaultBadges are the badges used if the config does not define any.
+var DefaultBadges = map[string]string{
+	"swim":   "\U0001F3CA", // swimmer
+	"bike":   "\U0001F6B4", // bicyclist
+	"run":    "\U0001F3C3", // runner
+	"race":   "\U0001F3C5", // medal
+	"social": "\U0001F389", // party popper
+}
+
+// decorate applies the decorator to every workout.
+func (d *Decorator) decorate(workouts []*Workout) error {
+	var tmpl *template.Template
+	if d.Template != "" {
+		var err error
+		tmpl, err = template.New("summary").Funcs(templateFuncs).Parse(d.Template)
+		if err != nil {
+			return fmt.Errorf("invalid summary template: %v", err)
+		}
+	}
+
+	for _, w := range workouts {
+		if tmpl != nil {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, w); err != nil {
+				return fmt.Errorf("unable to expand summary template: %v", err)
+			}
+
+			w.Summary = strings.TrimSpace(buf.String())
+		}
+
+		w.Summary = d.Prefix + number(w, d.Number, d.Locale) + d.Suffix
+
+		if badge := d.Badges[w.Type]; badge != "" {
+			w.Summary = badge + " " + w.Summary
+		}
+	}
+
+	return nil
+}
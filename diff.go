@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// Kinds of EventChange.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// ANSI escape codes for colorized diffs.
+const (
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// EventChange describes how a single event differs between two calendars.
+type EventChange struct {
+	Kind    string
+	UID     string
+	Summary string
+	Start   string
+
+	// URL is the signup link of the event, if any
+	URL string
+
+	// Fields that changed, only set for Changed
+	Fields []FieldChange
+}
+
+// FieldChange is a single property that changed.
+type FieldChange struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// diffCalendars compares the events in two iCalendar files by UID, ignoring
+// DTSTAMP. Changes are sorted by start time.
+func diffCalendars(prev, cur []byte) ([]EventChange, error) {
+	var prevEvents map[string]*Component
+	if len(prev) > 0 {
+		var err error
+		if prevEvents, err = eventsByUID(prev); err != nil {
+			return nil, err
+		}
+	}
+
+	curEvents, err := eventsByUID(cur)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []EventChange
+
+	for uid, ev := range curEvents {
+		old, ok := prevEvents[uid]
+		if !ok {
+			changes = append(changes, newEventChange(Added, ev))
+		} else if !old.equal(ev, "DTSTAMP") {
+			c := newEventChange(Changed, ev)
+			c.Fields = diffProperties(old, ev)
+			changes = append(changes, c)
+		}
+	}
+
+	for uid, ev := range prevEvents {
+		if _, ok := curEvents[uid]; !ok {
+			changes = append(changes, newEventChange(Removed, ev))
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Start != changes[j].Start {
+			return changes[i].Start < changes[j].Start
+		}
+		return changes[i].UID < changes[j].UID
+	})
+
+	return changes, nil
+}
+
+func newEventChange(kind string, ev *Component) EventChange {
+	return EventChange{
+		Kind:    kind,
+		UID:     ev.Value("UID"),
+		Summary: icalUnescape(ev.Value("SUMMARY")),
+		Start:   ev.Value("DTSTART"),
+		URL:     ev.Value("URL"),
+	}
+}
+
+// diffProperties lists the properties that differ between two versions of an
+// event. Subcomponents, such as alarms, are compared as a whole.
+func diffProperties(old, cur *Component) []FieldChange {
+	var fields []FieldChange
+
+	names := map[string]bool{}
+	for _, p := range append(append([]*ContentLine{}, old.Properties...), cur.Properties...) {
+		names[p.Name] = true
+	}
+	delete(names, "DTSTAMP")
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		if o, c := old.Value(name), cur.Value(name); o != c {
+			fields = append(fields, FieldChange{name, o, c})
+		}
+	}
+
+	if !(&Component{Components: old.Components}).equal(&Component{Components: cur.Components}, "DTSTAMP") {
+		fields = append(fields, FieldChange{Name: "alarms", Old: fmt.Sprint(len(old.Components)), New: fmt.Sprint(len(cur.Components))})
+	}
+
+	return fields
+}
+
+// printDiff writes a human readable summary of the changes. Added events are
+// prefixed with +, removed events with -, and changed events with ~.
+func printDiff(w io.Writer, changes []EventChange, color bool) {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	var counts = map[string]int{}
+	for _, c := range changes {
+		counts[c.Kind]++
+
+		line := fmt.Sprintf("%s %s", c.Start, c.Summary)
+		switch c.Kind {
+		case Added:
+			fmt.Fprintln(w, paint(colorGreen, "+ "+line))
+		case Removed:
+			fmt.Fprintln(w, paint(colorRed, "- "+line))
+		case Changed:
+			fmt.Fprintln(w, paint(colorYellow, "~ "+line))
+			for _, f := range c.Fields {
+				fmt.Fprintf(w, "    %s: %s -> %s\n", f.Name, paint(colorRed, f.Old), paint(colorGreen, f.New))
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "%d added, %d removed, %d changed\n", counts[Added], counts[Removed], counts[Changed])
+}
+
+// checkChanges returns an error if more than threshold percent of the events
+// in prev were changed or removed in cur, which is more likely to be a glitch
+// on the club's site than a real update.
+func checkChanges(prev, cur []byte, threshold float64) error {
+	prevEvents, err := eventsByUID(prev)
+	if err != nil || len(prevEvents) == 0 {
+		return err
+	}
+
+	changes, err := diffCalendars(prev, cur)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, c := range changes {
+		if c.Kind != Added {
+			n++
+		}
+	}
+
+	pct := float64(n) / float64(len(prevEvents)) * 100
+	if pct > threshold {
+		return fmt.Errorf("%d of %d events (%.0f%%) changed or removed, keeping the previous output, use -force to publish anyway", n, len(prevEvents), pct)
+	}
+
+	return nil
+}
+
+// runDiff compares the calendar with the previous one, a file or URL, and
+// prints the changes. Nothing is printed if there are none so that cron only
+// mails when the schedule changed. A missing previous file counts as empty.
+func runDiff(w io.Writer, client *http.Client, prev string, cal *Calendar, templates *Templates, color bool) error {
+	out, err := templates.render(cal, FormatICal)
+	if err != nil {
+		return err
+	}
+
+	b, err := readSource(client, prev)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	changes, err := diffCalendars(b, out)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		printDiff(w, changes, color)
+	}
+
+	return nil
+}
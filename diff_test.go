@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// icsEvent returns a VEVENT, extra is added before the END.
+func icsEvent(uid, start, summary, extra string) string {
+	return "BEGIN:VEVENT\r\nUID:" + uid + "\r\nDTSTAMP:20260301T000000Z\r\nDTSTART:" + start + "\r\nSUMMARY:" + summary + "\r\n" + extra + "END:VEVENT\r\n"
+}
+
+// icsCalendar returns a VCALENDAR with the events.
+func icsCalendar(events ...string) []byte {
+	return []byte("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n")
+}
+
+func TestDiffCalendars(t *testing.T) {
+	const alarm = "BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT1H\r\nEND:VALARM\r\n"
+
+	prev := icsCalendar(
+		icsEvent("swim", "20260302T013000Z", "Masters Swim", ""),
+		icsEvent("run", "20260302T140000Z", "Track", ""),
+		icsEvent("bike", "20260303T150000Z", "Ride", ""),
+		icsEvent("brick", "20260307T150000Z", "Brick", ""),
+	)
+	cur := icsCalendar(
+		strings.Replace(icsEvent("swim", "20260302T013000Z", "Masters Swim", ""), "20260301T000000Z", "20260308T000000Z", 1),
+		icsEvent("run", "20260302T150000Z", "Track & Run", ""),
+		icsEvent("open", "20260301T160000Z", "Open Water", ""),
+		icsEvent("brick", "20260307T150000Z", "Brick", alarm),
+	)
+
+	changes, err := diffCalendars(prev, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	printDiff(&buf, changes, false)
+
+	// The swim only has a new DTSTAMP so it is unchanged
+	want := `+ 20260301T160000Z Open Water
+~ 20260302T150000Z Track & Run
+    DTSTART: 20260302T140000Z -> 20260302T150000Z
+    SUMMARY: Track -> Track & Run
+- 20260303T150000Z Ride
+~ 20260307T150000Z Brick
+    alarms: 0 -> 1
+1 added, 1 removed, 2 changed
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// Without a previous calendar, everything is new
+	changes, err = diffCalendars(nil, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		if c.Kind != Added {
+			t.Errorf("%s: got %s, want added", c.UID, c.Kind)
+		}
+	}
+	if len(changes) != 4 {
+		t.Errorf("got %d changes, want 4", len(changes))
+	}
+}
+
+func TestPrintDiffColor(t *testing.T) {
+	var buf bytes.Buffer
+	printDiff(&buf, []EventChange{{Kind: Removed, Summary: "Ride", Start: "20260303T150000Z"}}, true)
+
+	want := colorRed + "- 20260303T150000Z Ride" + colorReset + "\n0 added, 1 removed, 0 changed\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCheckChanges(t *testing.T) {
+	var prev []string
+	for _, uid := range []string{"a", "b", "c", "d"} {
+		prev = append(prev, icsEvent(uid, "20260302T013000Z", "Swim", ""))
+	}
+
+	for _, tc := range []struct {
+		name string
+		cur  []string
+		err  string
+	}{
+		{"unchanged", prev, ""},
+		{"added", append(append([]string{}, prev...), icsEvent("e", "20260302T013000Z", "Swim", ""), icsEvent("f", "20260302T013000Z", "Swim", "")), ""},
+		{"one removed", prev[1:], ""},
+		{"two removed", prev[2:], ""},
+		{"three removed", prev[3:], "3 of 4 events (75%) changed or removed, keeping the previous output, use -force to publish anyway"},
+		{
+			"changed and removed",
+			[]string{icsEvent("a", "20260302T013000Z", "Track", ""), icsEvent("b", "20260302T013000Z", "Track", ""), prev[2]},
+			"3 of 4 events (75%) changed or removed, keeping the previous output, use -force to publish anyway",
+		},
+		{"empty", nil, "4 of 4 events (100%) changed or removed, keeping the previous output, use -force to publish anyway"},
+	} {
+		err := checkChanges(icsCalendar(prev...), icsCalendar(tc.cur...), 50)
+		if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%s: got %v, want %s", tc.name, err, tc.err)
+		}
+	}
+
+	// There is nothing to protect in an empty calendar
+	if err := checkChanges(icsCalendar(), icsCalendar(prev...), 50); err != nil {
+		t.Errorf("empty previous calendar: got %v", err)
+	}
+}
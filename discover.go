@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jcrussell/tvtccal/tvtccal"
+	"golang.org/x/net/html"
+)
+
+// MaxDiscoveryCandidates is the number of likely pages that discovery tries
+// before giving up.
+const MaxDiscoveryCandidates = 10
+
+// Patterns for links that probably lead to the calendar, the better ones
+// first.
+var (
+	calendarLink = regexp.MustCompile(`(?i)calendar`)
+	scheduleLink = regexp.MustCompile(`(?i)schedule|workouts|events`)
+)
+
+// discovered is the calendar found by discoverCalendar, so that serve
+// doesn't look for it on every refresh.
+var discovered string
+
+// discoverCalendar finds the calendar page of the club's site, given its
+// homepage. Links on the homepage and URLs in its sitemap are scored by how
+// much they look like a calendar, and the first one that the parser can read
+// wins.
+func discoverCalendar(client *http.Client, site string) (string, error) {
+	if discovered != "" {
+		return discovered, nil
+	}
+
+	base, err := url.Parse(site)
+	if err != nil || base.Host == "" {
+		return "", fmt.Errorf("invalid -site: %s", site)
+	}
+
+	scores := map[string]int{}
+
+	add := func(href, text string) {
+		u, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || u.Host != base.Host || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+
+		score := 0
+		for _, s := range []string{u.Path, text} {
+			if calendarLink.MatchString(s) {
+				score += 3
+			} else if scheduleLink.MatchString(s) {
+				score++
+			}
+		}
+
+		if score > scores[u.String()] {
+			scores[u.String()] = score
+		}
+	}
+
+	root, err := getHTML(client, site)
+	if err != nil {
+		return "", err
+	}
+
+	// The homepage itself may be the calendar
+	if parses(root) {
+		discovered = site
+		return site, nil
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, a := range n.Attr {
+				if a.Key == "href" {
+					add(a.Val, nodeText(n))
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	for _, loc := range sitemapURLs(client, base) {
+		add(loc, "")
+	}
+
+	var candidates []string
+	for u, score := range scores {
+		if score > 0 {
+			candidates = append(candidates, u)
+		}
+	}
+
+	// Best score first, then the shortest URL as it is usually the main
+	// page rather than a single event
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	if len(candidates) > MaxDiscoveryCandidates {
+		candidates = candidates[:MaxDiscoveryCandidates]
+	}
+
+	for _, u := range candidates {
+		root, err := getHTML(client, u)
+		if err != nil {
+			log.Printf("discovery: %s: %v", u, err)
+			continue
+		}
+
+		if parses(root) {
+			log.Printf("discovery: found the calendar at %s", u)
+			discovered = u
+			return u, nil
+		}
+	}
+
+	return "", errors.New("unable to find a calendar page that parses on " + site)
+}
+
+// parses returns true if the page is a calendar that the parser can read.
+func parses(root *html.Node) bool {
+	_, err := tvtccal.ParseNode(root, tvtccal.ParseOptions{Warnf: func(string, ...interface{}) {}, Selectors: selectors})
+	return err == nil
+}
+
+// sitemapURLs returns the URLs listed in the site's sitemap.xml, if it has
+// one. Sitemap indexes aren't followed.
+func sitemapURLs(client *http.Client, base *url.URL) []string {
+	u, _ := base.Parse("/sitemap.xml")
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil
+	}
+
+	var sitemap struct {
+		URLs []string `xml:"url>loc"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&sitemap); err != nil {
+		log.Printf("discovery: unable to parse %s: %v", u, err)
+		return nil
+	}
+
+	return sitemap.URLs
+}
+
+// getHTML downloads and parses the page at u.
+func getHTML(client *http.Client, u string) (*html.Node, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	return parseHTML(resp.Body)
+}
+
+// nodeText returns the text inside n, including the alt text of images that
+// are often used as links.
+func nodeText(n *html.Node) string {
+	var parts []string
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			parts = append(parts, n.Data)
+		case n.Type == html.ElementNode && n.Data == "img":
+			for _, a := range n.Attr {
+				if a.Key == "alt" {
+					parts = append(parts, a.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
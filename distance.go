@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius is the mean radius of the Earth in km.
+const EarthRadius = 6371.0088
+
+// KmPerMile converts miles to km.
+const KmPerMile = 1.609344
+
+// Coordinates are a latitude and longitude in degrees.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// parseDistance parses a distance with a unit of mi or km, e.g. 15mi,
+// returning it in km.
+func parseDistance(s string) (float64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+
+	unit := 0.0
+	switch {
+	case strings.HasSuffix(v, "mi"):
+		unit = KmPerMile
+	case strings.HasSuffix(v, "km"):
+		unit = 1
+	default:
+		return 0, fmt.Errorf("distance needs a unit of mi or km: `%s`", s)
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(v[:len(v)-2]), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid distance: `%s`", s)
+	}
+
+	return n * unit, nil
+}
+
+// distance returns the great-circle distance between a and b in km.
+func distance(a, b Coordinates) float64 {
+	rad := math.Pi / 180
+
+	dLat := (b.Latitude - a.Latitude) * rad
+	dLon := (b.Longitude - a.Longitude) * rad
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(a.Latitude*rad)*math.Cos(b.Latitude*rad)*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * EarthRadius * math.Asin(math.Sqrt(h))
+}
+
+// venueName returns the venue of a location, the part before the address.
+func venueName(location string) string {
+	return strings.TrimSpace(strings.SplitN(location, ",", 2)[0])
+}
+
+// filterWithin keeps the workouts at venues within km of home. Workouts at
+// venues without coordinates, or without a location, are kept with a warning
+// since there's no telling how far they are.
+func filterWithin(workouts []*Workout, home *Coordinates, venues map[string]Coordinates, km float64) ([]*Workout, error) {
+	if home == nil {
+		return nil, errors.New("-within requires home in the config")
+	}
+
+	coords := map[string]Coordinates{}
+	for name, c := range venues {
+		coords[strings.ToLower(name)] = c
+	}
+
+	unknown := map[string]bool{}
+
+	var res []*Workout
+	for _, w := range workouts {
+		venue := venueName(w.Location)
+
+		c, ok := coords[strings.ToLower(venue)]
+		if !ok {
+			if !unknown[venue] {
+				warnf("no coordinates for venue `%s`, keeping its workouts", venue)
+				unknown[venue] = true
+			}
+			res = append(res, w)
+			continue
+		}
+
+		if distance(*home, c) <= km {
+			res = append(res, w)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jcrussell/tvtccal/tvtccal"
+)
+
+// DefaultDurationKey is the key in -durations for workouts of any other type.
+const DefaultDurationKey = "default"
+
+// parseDurations parses a list of comma separated type=duration pairs, e.g.
+// swim=60m,run=75m,default=90m.
+func parseDurations(s string) (map[string]time.Duration, error) {
+	res := map[string]time.Duration{}
+
+	if s == "" {
+		return res, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected type=duration: `%s`", pair)
+		}
+
+		typ := strings.TrimSpace(parts[0])
+
+		d, err := parseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		if d < tvtccal.MinDuration || d > tvtccal.MaxDuration {
+			return nil, fmt.Errorf("duration for %s out of bounds (%v to %v): %v", typ, tvtccal.MinDuration, tvtccal.MaxDuration, d)
+		}
+
+		res[typ] = d
+	}
+
+	return res, nil
+}
+
+// setDurations sets the end of the workouts that the calendar didn't give a
+// duration for. The duration is looked up by the workout's type, then its
+// sport, then DefaultDurationKey. Workouts without any keep the parser's
+// tvtccal.DefaultDuration.
+func setDurations(workouts []*Workout, durations map[string]time.Duration) {
+	if len(durations) == 0 {
+		return
+	}
+
+	for _, w := range workouts {
+		if w.HasDuration {
+			continue
+		}
+
+		for _, key := range []string{w.Type, w.Sport, DefaultDurationKey} {
+			if d, ok := durations[key]; ok && key != "" {
+				w.End = w.Start.Add(d)
+				break
+			}
+		}
+	}
+}
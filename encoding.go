@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encodings of the outputs, see -encoding.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingASCII       = "ascii"
+	EncodingASCIIStrict = "ascii-strict"
+)
+
+// BOM is the UTF-8 byte order mark, see -bom.
+const BOM = "\xef\xbb\xbf"
+
+// asciiReplacements are the ASCII spellings of the non-ASCII characters that
+// show up in workouts, such as accented venue names and the typographic
+// punctuation that editors insert. Characters without one become ?. None is
+// longer than the character in UTF-8, so that folded iCalendar lines stay
+// within 75 octets.
+var asciiReplacements = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE", 'Ç': "C",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ð': "D", 'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ý': "Y", 'Þ': "TH", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'þ': "th", 'ÿ': "y",
+	'Œ': "OE", 'œ': "oe", 'Š': "S", 'š': "s", 'Ž': "Z", 'ž': "z", 'Ÿ': "Y",
+	'‘': "'", '’': "'", '‚': "'", '“': `"`, '”': `"`, '„': `"`, '′': "'", '″': `"`,
+	'–': "-", '—': "-", '‐': "-", '‑': "-", '−': "-", '…': "...", '•': "*", '·': "*",
+	'\u00a0': " ", '\u2009': " ", '\u202f': " ", '\u200b': "", '\ufeff': "",
+	'×': "x", '™': "TM", '¡': "!", '¿': "?",
+}
+
+// checkEncoding returns an error if the encoding is unknown.
+func checkEncoding(encoding string) error {
+	switch encoding {
+	case EncodingUTF8, EncodingASCII, EncodingASCIIStrict:
+		return nil
+	}
+
+	return fmt.Errorf("invalid -encoding, must be %s, %s, or %s: `%s`", EncodingUTF8, EncodingASCII, EncodingASCIIStrict, encoding)
+}
+
+// encode converts the rendered output to the encoding and adds the byte
+// order mark, if set. JSON never gets one, RFC 8259 forbids it.
+func (t *Templates) encode(out []byte, format string) ([]byte, error) {
+	switch t.Encoding {
+	case EncodingASCII:
+		out = transliterate(out)
+	case EncodingASCIIStrict:
+		if err := checkASCII(out); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.BOM && format != FormatJSON && format != FormatJSONLD {
+		out = append([]byte(BOM), out...)
+	}
+
+	return out, nil
+}
+
+// transliterate replaces the non-ASCII characters in b with their ASCII
+// spellings, see asciiReplacements.
+func transliterate(b []byte) []byte {
+	if isASCII(b) {
+		return b
+	}
+
+	var buf bytes.Buffer
+
+	for _, r := range string(b) {
+		if r < utf8.RuneSelf {
+			buf.WriteRune(r)
+		} else if s, ok := asciiReplacements[r]; ok {
+			buf.WriteString(s)
+		} else {
+			buf.WriteByte('?')
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// checkASCII returns an error for the first non-ASCII character in b.
+func checkASCII(b []byte) error {
+	for i, line := range strings.Split(string(b), "\n") {
+		for _, r := range line {
+			if r >= utf8.RuneSelf {
+				return fmt.Errorf("`%c` on line %d can't be encoded as ASCII, see -encoding", r, i+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isASCII reports whether b is all ASCII.
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// StateExportVersion is the version of the StateExport format, bumped on
+// incompatible changes.
+const StateExportVersion = 1
+
+// StateExport is the -state along with the settings that the UIDs in it
+// depend on, for moving the publishing job to another host, see state export
+// and state import.
+type StateExport struct {
+	Version  int       `json:"version"`
+	Exported time.Time `json:"exported"`
+
+	// UIDs are the settings that the UIDs of the events were generated with
+	UIDs UIDScheme `json:"uids"`
+
+	State *State `json:"state"`
+}
+
+// UIDScheme is how the UIDs of events are generated. A host that generates
+// them differently publishes every event again under a new UID, which
+// subscribers see as duplicates.
+type UIDScheme struct {
+	Namespace   string `json:"namespace"`
+	UUID        bool   `json:"uuid"`
+	ContentUIDs bool   `json:"content_uids"`
+}
+
+// currentUIDScheme returns the UID settings of this run.
+func currentUIDScheme(config *Config) UIDScheme {
+	return UIDScheme{
+		Namespace:   config.UIDNamespace,
+		UUID:        *uuidUIDs,
+		ContentUIDs: *contentUIDs,
+	}
+}
+
+// diff lists the settings that differ between s and other, as the flags or
+// config key that set them.
+func (s UIDScheme) diff(other UIDScheme) []string {
+	var res []string
+	if s.UUID != other.UUID {
+		res = append(res, fmt.Sprintf("-uuid=%v", other.UUID))
+	}
+	if s.UUID && other.UUID && !strings.EqualFold(s.Namespace, other.Namespace) {
+		res = append(res, fmt.Sprintf("uid_namespace %s in the config", other.Namespace))
+	}
+	if s.ContentUIDs != other.ContentUIDs {
+		res = append(res, fmt.Sprintf("-content-uids=%v", other.ContentUIDs))
+	}
+
+	return res
+}
+
+// exportState writes the -state to fname, or stdout if fname is empty or -.
+func exportState(w io.Writer, config *Config, fname string) error {
+	if *stateFile == "" {
+		return errors.New("state export requires -state")
+	}
+
+	if _, err := os.Stat(*stateFile); err != nil {
+		return fmt.Errorf("unable to export state: %v", err)
+	}
+
+	state, err := loadState(*stateFile)
+	if err != nil {
+		return err
+	}
+
+	export := StateExport{
+		Version:  StateExportVersion,
+		Exported: time.Now().UTC(),
+		UIDs:     currentUIDScheme(config),
+		State:    state,
+	}
+
+	b, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if fname == "" || fname == "-" {
+		_, err := w.Write(b)
+		return err
+	}
+
+	return writeAtomic(fname, b, 0600)
+}
+
+// importState replaces the -state with the one exported to fname, or read
+// from stdin if fname is -. Refuses to if the UIDs of this host would differ
+// from those of the exporting one, or if the -state already remembers
+// events, unless force is set.
+func importState(config *Config, fname string, force bool) (*StateExport, error) {
+	if *stateFile == "" {
+		return nil, errors.New("state import requires -state")
+	}
+
+	var b []byte
+	var err error
+	if fname == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(fname)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	export := &StateExport{}
+	if err := json.Unmarshal(b, export); err != nil {
+		return nil, fmt.Errorf("unable to parse state export %s: %v", fname, err)
+	}
+
+	if export.Version != StateExportVersion {
+		return nil, fmt.Errorf("unsupported state export version, must be %d: `%d`", StateExportVersion, export.Version)
+	} else if export.State == nil {
+		return nil, fmt.Errorf("state export %s has no state", fname)
+	}
+
+	if diff := currentUIDScheme(config).diff(export.UIDs); len(diff) > 0 && !force {
+		return nil, fmt.Errorf("UIDs would differ from the exporting host, every event would be published again under a new UID; run with %s, or -force", strings.Join(diff, ", "))
+	}
+
+	prev, err := loadState(*stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prev.Events) > 0 && !force {
+		return nil, fmt.Errorf("%s already remembers %d events, use -force to replace it", *stateFile, len(prev.Events))
+	}
+
+	if err := export.State.save(*stateFile); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter keeps workouts based on regular expressions matched against the
+// summary and description, or only the summary for Include and Exclude.
+type Filter struct {
+	// Match, if not empty, keeps only the workouts that match at least one
+	Match []*regexp.Regexp
+
+	// Drop removes the workouts that match any
+	Drop []*regexp.Regexp
+
+	// Include, if not empty, keeps only the workouts whose summary matches
+	// at least one
+	Include []*regexp.Regexp
+
+	// Exclude removes the workouts whose summary matches any
+	Exclude []*regexp.Regexp
+}
+
+// compileKeywords compiles a value of -include or -exclude. A value without
+// any regexp syntax is a comma separated list of keywords, e.g. swim,bike,
+// that match at the start of a word regardless of case. Anything else is a
+// regexp.
+func compileKeywords(s string) (*regexp.Regexp, error) {
+	if regexp.QuoteMeta(s) != s {
+		return regexp.Compile(s)
+	}
+
+	var words []string
+	for _, word := range strings.Split(s, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+
+	if len(words) == 0 {
+		return nil, fmt.Errorf("no keywords: `%s`", s)
+	}
+
+	return regexp.Compile(`(?i)\b(?:` + strings.Join(words, "|") + `)`)
+}
+
+// newFilter compiles the match and drop expressions, and the include and
+// exclude keywords or expressions.
+func newFilter(match, drop, include, exclude []string) (*Filter, error) {
+	f := &Filter{}
+
+	for _, s := range match {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -match: %v", err)
+		}
+		f.Match = append(f.Match, re)
+	}
+
+	for _, s := range drop {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -drop: %v", err)
+		}
+		f.Drop = append(f.Drop, re)
+	}
+
+	for _, s := range include {
+		re, err := compileKeywords(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -include: %v", err)
+		}
+		f.Include = append(f.Include, re)
+	}
+
+	for _, s := range exclude {
+		re, err := compileKeywords(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -exclude: %v", err)
+		}
+		f.Exclude = append(f.Exclude, re)
+	}
+
+	return f, nil
+}
+
+// keep returns true if the workout passes the filter.
+func (f *Filter) keep(w *Workout) bool {
+	text := w.Summary + "\n" + w.Description
+
+	for _, re := range f.Drop {
+		if re.MatchString(text) {
+			return false
+		}
+	}
+
+	for _, re := range f.Exclude {
+		if re.MatchString(w.Summary) {
+			return false
+		}
+	}
+
+	return matchAny(f.Match, text) && matchAny(f.Include, w.Summary)
+}
+
+// matchAny returns true if s matches any of the expressions, or if there are
+// none.
+func matchAny(res []*regexp.Regexp, s string) bool {
+	if len(res) == 0 {
+		return true
+	}
+
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filter returns the workouts that pass the filter.
+func (f *Filter) filter(workouts []*Workout) []*Workout {
+	var res []*Workout
+
+	for _, w := range workouts {
+		if f.keep(w) {
+			res = append(res, w)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileKeywords(t *testing.T) {
+	for _, tc := range []struct {
+		keywords string
+		match    []string
+		noMatch  []string
+	}{
+		{"swim", []string{"Masters Swim", "swim clinic", "SWIMMING"}, []string{"Open Water Kickswim", "Run"}},
+		{"swim,bike", []string{"Masters Swim", "Bike Maintenance"}, []string{"Track Run"}},
+		{" swim , , run ", []string{"Track Run", "Masters Swim"}, []string{"Bike"}},
+		{"warm-up", []string{"Warm-up Swim"}, []string{"Warmup Swim", "prewarm-up"}},
+
+		// Regexp syntax is used as is, case sensitive
+		{"^Masters", []string{"Masters Swim"}, []string{"masters swim", "Swim Masters"}},
+		{"Swim|Run", []string{"Masters Swim", "Track Run"}, []string{"swim"}},
+	} {
+		re, err := compileKeywords(tc.keywords)
+		if err != nil {
+			t.Errorf("%q: %v", tc.keywords, err)
+			continue
+		}
+
+		for _, s := range tc.match {
+			if !re.MatchString(s) {
+				t.Errorf("%q: doesn't match `%s`", tc.keywords, s)
+			}
+		}
+		for _, s := range tc.noMatch {
+			if re.MatchString(s) {
+				t.Errorf("%q: matches `%s`", tc.keywords, s)
+			}
+		}
+	}
+
+	for _, s := range []string{"", " , ", "swim("} {
+		if _, err := compileKeywords(s); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
+
+func TestFilterKeep(t *testing.T) {
+	workouts := []*Workout{
+		{Summary: "Masters Swim", Description: "Bring fins"},
+		{Summary: "Open Water Swim", Description: "Wetsuits required"},
+		{Summary: "Track Run", Description: "Bring fins for the pool after"},
+		{Summary: "Group Ride"},
+	}
+
+	for _, tc := range []struct {
+		name                          string
+		match, drop, include, exclude []string
+		want                          string
+	}{
+		{"none", nil, nil, nil, nil, "Masters Swim, Open Water Swim, Track Run, Group Ride"},
+		{"match description", []string{"fins"}, nil, nil, nil, "Masters Swim, Track Run"},
+		{"drop", nil, []string{"(?i)wetsuit"}, nil, nil, "Masters Swim, Track Run, Group Ride"},
+		{"include summary only", nil, nil, []string{"fins,ride"}, nil, "Group Ride"},
+		{"include and exclude", nil, nil, []string{"swim,run"}, []string{"open"}, "Masters Swim, Track Run"},
+		{"match and include", []string{"fins"}, nil, []string{"swim"}, nil, "Masters Swim"},
+	} {
+		f, err := newFilter(tc.match, tc.drop, tc.include, tc.exclude)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+
+		var got []string
+		for _, w := range workouts {
+			if f.keep(w) {
+				got = append(got, w.Summary)
+			}
+		}
+
+		if strings.Join(got, ", ") != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, strings.Join(got, ", "), tc.want)
+		}
+	}
+}
+
+func TestNewFilterInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		match, drop, include, exclude []string
+		err                           string
+	}{
+		{[]string{"("}, nil, nil, nil, "invalid -match"},
+		{nil, []string{"("}, nil, nil, "invalid -drop"},
+		{nil, nil, []string{","}, nil, "invalid -include: no keywords: `,`"},
+		{nil, nil, nil, []string{"["}, "invalid -exclude"},
+	} {
+		_, err := newFilter(tc.match, tc.drop, tc.include, tc.exclude)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("got error %v, want %s", err, tc.err)
+		}
+	}
+}
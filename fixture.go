@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcrussell/tvtccal/tvtccal"
+)
+
+// fixture is a predownloaded calendar page, see -test.
+type fixture struct {
+	fname string
+	opts  tvtccal.ParseOptions
+}
+
+// fixtures finds the fixtures for -test, which may be a file, a glob, or a
+// directory of .html files. Each fixture may have a metadata file with the
+// same name and a .json extension containing its tvtccal.ParseOptions, e.g.
+// {"year": 2015} for a page from a past year. A pattern of - reads a single
+// page from stdin.
+func fixtures(pattern string) ([]fixture, error) {
+	if pattern == "-" {
+		return []fixture{{fname: pattern}}, nil
+	}
+
+	var fnames []string
+
+	if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+		fnames, err = filepath.Glob(filepath.Join(pattern, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+	} else if err == nil {
+		fnames = []string{pattern}
+	} else {
+		fnames, err = filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(fnames) == 0 {
+		return nil, fmt.Errorf("no fixtures match %s", pattern)
+	}
+
+	sort.Strings(fnames)
+
+	var res []fixture
+	for _, fname := range fnames {
+		if filepath.Ext(fname) == ".json" {
+			// metadata for another fixture
+			continue
+		}
+
+		f := fixture{fname: fname}
+
+		meta := strings.TrimSuffix(fname, filepath.Ext(fname)) + ".json"
+		b, err := os.ReadFile(meta)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			if err := json.Unmarshal(b, &f.opts); err != nil {
+				return nil, fmt.Errorf("unable to parse metadata %s: %v", meta, err)
+			}
+		}
+
+		res = append(res, f)
+	}
+
+	return res, nil
+}
+
+// name is the fixture's file name without the directory or extension, used
+// to name per-fixture outputs.
+func (f fixture) name() string {
+	if f.fname == "-" {
+		return "stdin"
+	}
+
+	base := filepath.Base(f.fname)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// outName inserts the fixture's name before the extension of fname, e.g.
+// tvtc.ics becomes tvtc-march.ics.
+func (f fixture) outName(fname string) string {
+	ext := filepath.Ext(fname)
+	return strings.TrimSuffix(fname, ext) + "-" + f.name() + ext
+}
+
+// parseMonthName parses a month given as a number or an English name (or its
+// abbreviation). Returns 0 if s is empty.
+func parseMonthName(s string) (time.Month, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 12 {
+			return 0, fmt.Errorf("invalid month: %s", s)
+		}
+		return time.Month(n), nil
+	}
+
+	for m := time.January; m <= time.December; m++ {
+		if strings.EqualFold(m.String(), s) || strings.EqualFold(m.String()[:3], s) {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid month: %s", s)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jcrussell/tvtccal/tvtccal"
+)
+
+func TestFixtures(t *testing.T) {
+	dir := t.TempDir()
+	for fname, content := range map[string]string{
+		"march.html":    "",
+		"november.html": "",
+		"november.json": `{"year": 2015, "month": 11}`,
+		"notes.txt":     "",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, fname), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	march := fixture{fname: filepath.Join(dir, "march.html")}
+	november := fixture{fname: filepath.Join(dir, "november.html"), opts: tvtccal.ParseOptions{Year: 2015, Month: time.November}}
+
+	for _, tc := range []struct {
+		pattern string
+		want    []fixture
+	}{
+		{dir, []fixture{march, november}},
+		{filepath.Join(dir, "march.html"), []fixture{march}},
+		{filepath.Join(dir, "nov*"), []fixture{november}},
+		{filepath.Join(dir, "*"), []fixture{march, {fname: filepath.Join(dir, "notes.txt")}, november}},
+	} {
+		got, err := fixtures(tc.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", tc.pattern, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.pattern, got, tc.want)
+		}
+	}
+
+	if _, err := fixtures(filepath.Join(dir, "*.htm")); err == nil {
+		t.Error("got no error when nothing matches")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "march.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fixtures(dir); err == nil {
+		t.Error("got no error for invalid metadata")
+	}
+}
+
+func TestFixtureOutName(t *testing.T) {
+	f := fixture{fname: "testdata/march.html"}
+
+	for fname, want := range map[string]string{
+		"tvtc.ics":        "tvtc-march.ics",
+		"out/tvtc.ics":    "out/tvtc-march.ics",
+		"tvtc":            "tvtc-march",
+		"out.d/tvtc.json": "out.d/tvtc-march.json",
+	} {
+		if got := f.outName(fname); got != want {
+			t.Errorf("%s: got %s, want %s", fname, got, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// templateFuncs are the functions available to all the output templates.
+// Functions that take the value being operated on take it last so that they
+// can be used in pipelines, e.g. {{.Summary | truncate 20 | upper}}.
+var templateFuncs = template.FuncMap{
+	"now": func() string {
+		return time.Now().UTC().Format(ICalTimeFormat)
+	},
+	"ical": func(t time.Time) string {
+		return t.UTC().Format(ICalTimeFormat)
+	},
+	"text": icalText,
+
+	// Dates and times
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"utc": func(t time.Time) time.Time {
+		return t.UTC()
+	},
+	"weekday": func(t time.Time) string {
+		return t.Weekday().String()
+	},
+
+	// Durations, strings use the same syntax as time.ParseDuration plus d for
+	// days
+	"add": func(d string, t time.Time) (time.Time, error) {
+		v, err := parseDuration(d)
+		return t.Add(v), err
+	},
+	"duration": func(start, end time.Time) time.Duration {
+		return end.Sub(start)
+	},
+	"minutes": func(d time.Duration) int {
+		return int(d.Minutes())
+	},
+	"hours": func(d time.Duration) float64 {
+		return d.Hours()
+	},
+
+	// Strings
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"title":     title,
+	"trim":      strings.TrimSpace,
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"replace":   func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":      func(sep string, s []string) string { return strings.Join(s, sep) },
+	"truncate": func(n int, s string) string {
+		if r := []rune(s); len(r) > n {
+			return string(r[:n])
+		}
+		return s
+	},
+	"default": func(d, s string) string {
+		if s == "" {
+			return d
+		}
+		return s
+	},
+}
+
+// funcs returns the template functions, including the lookups that depend on
+// the config:
+//
+//	typeOf SUMMARY      type assigned by the classifier
+//	priorityOf TYPE     iCal PRIORITY for the type
+func (t *Templates) funcs() template.FuncMap {
+	fns := template.FuncMap{}
+	for k, v := range templateFuncs {
+		fns[k] = v
+	}
+
+	var config *Config
+	if t != nil && t.Config != nil {
+		config = t.Config
+	} else {
+		// Default config can't fail to load
+		config, _ = loadConfig("")
+	}
+
+	fns["typeOf"] = func(summary string) string {
+		typ, _ := config.classifyWorkout(summary)
+		return typ
+	}
+	fns["priorityOf"] = func(typ string) int {
+		return config.Priority[typ]
+	}
+	fns["t"] = func(s string) string {
+		return translate(config.Locale, s)
+	}
+	fns["ldate"] = func(layout string, t time.Time) string {
+		return formatDate(config.Locale, layout, t)
+	}
+
+	return fns
+}
+
+// parseDuration is like time.ParseDuration but also accepts d for days, such
+// as 1d12h.
+func parseDuration(s string) (time.Duration, error) {
+	v := strings.TrimLeft(s, "+-")
+	neg := strings.HasPrefix(s, "-")
+	if v == "" {
+		return 0, fmt.Errorf("invalid duration: `%s`", s)
+	}
+
+	var days time.Duration
+	if i := strings.IndexByte(v, 'd'); i >= 0 {
+		n, err := strconv.Atoi(v[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: `%s`", s)
+		}
+
+		days = time.Duration(n) * 24 * time.Hour
+		v = v[i+1:]
+	}
+
+	var rest time.Duration
+	if v != "" {
+		var err error
+		if rest, err = time.ParseDuration(v); err != nil {
+			return 0, fmt.Errorf("invalid duration: `%s`", s)
+		}
+	}
+
+	if neg {
+		return -(days + rest), nil
+	}
+
+	return days + rest, nil
+}
+
+// title upper cases the first letter of each word, which is anything that
+// follows a character other than a letter, digit, or apostrophe.
+func title(s string) string {
+	r := []rune(s)
+	for i := range r {
+		if i == 0 || !(unicode.IsLetter(r[i-1]) || unicode.IsDigit(r[i-1]) || r[i-1] == '\'') {
+			r[i] = unicode.ToTitle(r[i])
+		}
+	}
+
+	return string(r)
+}
+
+// icalText escapes a TEXT property value, see RFC 5545 Sec 3.3.11.
+func icalText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// icalUnescape undoes icalText.
+func icalUnescape(s string) string {
+	return strings.NewReplacer(
+		`\\`, `\`,
+		`\;`, ";",
+		`\,`, ",",
+		`\n`, "\n",
+		`\N`, "\n",
+	).Replace(s)
+}
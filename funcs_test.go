@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestTitle(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                  "",
+		"masters swim":      "Masters Swim",
+		"open-water swim":   "Open-Water Swim",
+		"o'neill's 5k":      "O'neill's 5k",
+		"élan vitesse":      "Élan Vitesse",
+		"brick (bike/run)":  "Brick (Bike/Run)",
+		"ALREADY Title":     "ALREADY Title",
+		"  leading spaces ": "  Leading Spaces ",
+	} {
+		if got := title(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestPropertyFuncs checks that property templates can use templateFuncs.
+func TestPropertyFuncs(t *testing.T) {
+	props, err := compileProperties(map[string]string{
+		"X-TYPE":    "{{.Type | upper}}",
+		"X-SUMMARY": "{{.Summary | title | truncate 12}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := expandProperties(props, &Workout{Summary: "masters swim workout", Type: "swim"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Property{{"X-SUMMARY", "Masters Swim"}, {"X-TYPE", "SWIM"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/jcrussell/tvtccal
+
+go 1.26.0
+
+require (
+	github.com/andybalholm/cascadia v1.3.5
+	golang.org/x/crypto v0.57.0
+	golang.org/x/net v0.59.0
+	golang.org/x/sys v0.48.0
+)
+
+require golang.org/x/text v0.42.0 // indirect
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the language of the strings in the code and templates.
+const DefaultLocale = "en"
+
+// messages translates the strings that tvtccal generates itself, keyed by
+// locale and then by the English string. Date layouts are translated too,
+// see formatDate for the month and day names.
+var messages = map[string]map[string]string{
+	"es": {
+		"Tri-Valley Triathlon Club Workouts": "Entrenamientos del Tri-Valley Triathlon Club",
+		"All workouts":                       "Todos los entrenamientos",
+		"Subscribe":                          "Suscribirse",
+		"Sign up":                            "Inscribirse",
+		"Download":                           "Descargar",
+		"QR code for":                        "Código QR para",
+		"Starts at %s":                       "Empieza a las %s",
+		"Lights required, sunset at %s":      "Se necesitan luces, el sol se pone a las %s",
+		"Week %d: %s":                        "Semana %d: %s",
+
+		"Workout schedule changed": "Cambios en el calendario de entrenamientos",
+		"New: %s %s":               "Nuevo: %s %s",
+		"Moved: %s from %s to %s":  "Movido: %s del %s al %s",
+		"Changed: %s %s (%s)":      "Modificado: %s %s (%s)",
+		"Cancelled: %s %s":         "Cancelado: %s %s",
+
+		"%d updates during quiet hours": "%d novedades durante las horas de silencio",
+		"Workouts tomorrow, %s":         "Entrenamientos de mañana, %s",
+
+		"Monday, January 2": "Monday, 2 de January",
+		"Mon Jan 2 3:04 PM": "Mon 2 Jan 15:04",
+		"Mon Jan 2":         "Mon 2 Jan",
+		"3:04 PM":           "15:04",
+	},
+}
+
+// monthNames and dayNames are the localized names substituted by
+// formatDate, in lower case as is usual mid-sentence in most languages.
+var (
+	monthNames = map[string][12]string{
+		"es": {"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+	}
+
+	dayNames = map[string][7]string{
+		"es": {"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+	}
+)
+
+// checkLocale returns an error if there are no translations for locale.
+func checkLocale(locale string) error {
+	if _, ok := messages[locale]; !ok && locale != "" && locale != DefaultLocale {
+		return fmt.Errorf("unsupported locale: %s", locale)
+	}
+
+	return nil
+}
+
+// translate returns s in the locale, or s itself if there's no translation.
+func translate(locale, s string) string {
+	if v, ok := messages[locale][s]; ok {
+		return v
+	}
+
+	return s
+}
+
+// formatDate formats t using the translated layout, replacing the English
+// month and day names with the locale's.
+func formatDate(locale, layout string, t time.Time) string {
+	s := t.Format(translate(locale, layout))
+
+	if months, ok := monthNames[locale]; ok {
+		name := t.Month().String()
+		s = strings.Replace(s, name, months[t.Month()-1], -1)
+		s = strings.Replace(s, name[:3], abbrev(months[t.Month()-1]), -1)
+	}
+
+	if days, ok := dayNames[locale]; ok {
+		name := t.Weekday().String()
+		s = strings.Replace(s, name, days[t.Weekday()], -1)
+		s = strings.Replace(s, name[:3], abbrev(days[t.Weekday()]), -1)
+	}
+
+	return s
+}
+
+// abbrev returns the first three letters of the name.
+func abbrev(name string) string {
+	r := []rune(name)
+	if len(r) > 3 {
+		r = r[:3]
+	}
+
+	return string(r)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentLine is a single unfolded content line, see RFC 5545 Sec 3.1.
+type ContentLine struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+
+	// Line is the line number of the first physical line
+	Line int
+}
+
+// Param returns the first value for the named parameter.
+func (cl *ContentLine) Param(name string) string {
+	if vals := cl.Params[name]; len(vals) > 0 {
+		return vals[0]
+	}
+
+	return ""
+}
+
+// Component is a BEGIN/END block such as VCALENDAR or VEVENT.
+type Component struct {
+	Name       string
+	Properties []*ContentLine
+	Components []*Component
+
+	// Line and EndLine are the line numbers of the BEGIN and END lines
+	Line    int
+	EndLine int
+}
+
+// Get returns the first property with the given name or nil.
+func (c *Component) Get(name string) *ContentLine {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Value returns the value of the first property with the given name.
+func (c *Component) Value(name string) string {
+	if p := c.Get(name); p != nil {
+		return p.Value
+	}
+
+	return ""
+}
+
+// Sub returns all the subcomponents with the given name.
+func (c *Component) Sub(name string) []*Component {
+	var res []*Component
+	for _, sub := range c.Components {
+		if sub.Name == name {
+			res = append(res, sub)
+		}
+	}
+
+	return res
+}
+
+// unfoldLines splits r into content lines, joining folded lines. Both CRLF
+// and bare LF line endings are accepted. Returns the content lines along with
+// the line number where each one started.
+func unfoldLines(r io.Reader) ([]string, []int, error) {
+	var lines []string
+	var linenos []int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if i == 1 {
+			line = strings.TrimPrefix(line, BOM)
+		}
+
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+
+		lines = append(lines, line)
+		linenos = append(linenos, i)
+	}
+
+	return lines, linenos, scanner.Err()
+}
+
+// foldLines ends every line of b with CRLF and folds the lines that are longer
+// than MaxLineOctets, see RFC 5545 Sec 3.1. Lines are only folded between
+// UTF-8 characters.
+func foldLines(b []byte) []byte {
+	var buf bytes.Buffer
+
+	lines := bytes.Split(b, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	for _, line := range lines {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+
+		// Continuation lines start with a space that counts towards the limit
+		for max := MaxLineOctets; len(line) > max; max = MaxLineOctets - 1 {
+			i := max
+			for i > 0 && !utf8.RuneStart(line[i]) {
+				i--
+			}
+
+			buf.Write(line[:i])
+			buf.WriteString("\r\n ")
+			line = line[i:]
+		}
+
+		buf.Write(line)
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes()
+}
+
+// parseContentLine splits a content line into name, parameters, and value.
+func parseContentLine(s string, lineno int) (*ContentLine, error) {
+	cl := &ContentLine{Line: lineno, Params: map[string][]string{}}
+
+	// Find the end of the name and parameters, the first colon that isn't
+	// inside a quoted parameter value
+	quoted := false
+	end := -1
+	for i := 0; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				end = i
+			}
+		}
+	}
+
+	if end < 0 {
+		return nil, fmt.Errorf("line %d: missing `:` in content line", lineno)
+	}
+
+	cl.Value = s[end+1:]
+
+	parts := splitUnquoted(s[:end], ';')
+	cl.Name = strings.ToUpper(parts[0])
+	if cl.Name == "" {
+		return nil, fmt.Errorf("line %d: missing property name", lineno)
+	}
+
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: invalid parameter `%s`", lineno, param)
+		}
+
+		key := strings.ToUpper(kv[0])
+		for _, v := range splitUnquoted(kv[1], ',') {
+			cl.Params[key] = append(cl.Params[key], strings.Trim(v, `"`))
+		}
+	}
+
+	return cl, nil
+}
+
+// splitUnquoted splits s on sep, ignoring separators inside double quotes.
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			quoted = !quoted
+		} else if s[i] == sep && !quoted {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// parseICS reads the components from r. Typically, there is a single
+// VCALENDAR component.
+func parseICS(r io.Reader) ([]*Component, error) {
+	lines, linenos, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*Component
+	var stack []*Component
+
+	for i, line := range lines {
+		cl, err := parseContentLine(line, linenos[i])
+		if err != nil {
+			return nil, err
+		}
+
+		switch cl.Name {
+		case "BEGIN":
+			c := &Component{Name: strings.ToUpper(cl.Value), Line: cl.Line}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else {
+				roots = append(roots, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			name := strings.ToUpper(cl.Value)
+			if len(stack) == 0 || stack[len(stack)-1].Name != name {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", cl.Line, cl.Value)
+			}
+			stack[len(stack)-1].EndLine = cl.Line
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside of component", cl.Line, cl.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, cl)
+		}
+	}
+
+	if len(stack) > 0 {
+		c := stack[len(stack)-1]
+		return nil, fmt.Errorf("line %d: missing END:%s", c.Line, c.Name)
+	}
+
+	return roots, nil
+}
+
+// parseICalTime parses a DATE or DATE-TIME property value. Times with a TZID
+// parameter are resolved using the IANA database when possible and fall back
+// to loc. The returned bool is true for DATE values (all-day events).
+func parseICalTime(cl *ContentLine, loc *time.Location) (time.Time, bool, error) {
+	v := cl.Value
+
+	if cl.Param("VALUE") == "DATE" || len(v) == 8 {
+		t, err := time.ParseInLocation("20060102", v, loc)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse(ICalTimeFormat, v)
+		return t, false, err
+	}
+
+	if tzid := cl.Param("TZID"); tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", v, loc)
+	return t, false, err
+}
+
+// equal compares two components, ignoring the named properties (in this
+// component and all subcomponents).
+func (c *Component) equal(other *Component, ignore ...string) bool {
+	skip := func(p *ContentLine) bool {
+		for _, name := range ignore {
+			if p.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	filter := func(props []*ContentLine) []*ContentLine {
+		var res []*ContentLine
+		for _, p := range props {
+			if !skip(p) {
+				res = append(res, p)
+			}
+		}
+		return res
+	}
+
+	if c.Name != other.Name || len(c.Components) != len(other.Components) {
+		return false
+	}
+
+	props, otherProps := filter(c.Properties), filter(other.Properties)
+	if len(props) != len(otherProps) {
+		return false
+	}
+
+	for i := range props {
+		if !props[i].equal(otherProps[i]) {
+			return false
+		}
+	}
+
+	for i := range c.Components {
+		if !c.Components[i].equal(other.Components[i], ignore...) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equal compares the name, parameters, and value of two content lines.
+func (cl *ContentLine) equal(other *ContentLine) bool {
+	if cl.Name != other.Name || cl.Value != other.Value || len(cl.Params) != len(other.Params) {
+		return false
+	}
+
+	for k, vals := range cl.Params {
+		otherVals := other.Params[k]
+		if len(vals) != len(otherVals) {
+			return false
+		}
+		for i := range vals {
+			if vals[i] != otherVals[i] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFoldLines(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("0123456789", 20)
+	accents := "LOCATION:" + strings.Repeat("Piscine Olympique Régionale, ", 5)
+
+	for _, in := range []string{
+		"BEGIN:VCALENDAR\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n",
+		long + "\n",
+		accents + "\n",
+		strings.Repeat("x", MaxLineOctets) + "\n",
+		strings.Repeat("x", MaxLineOctets+1) + "\n",
+	} {
+		out := foldLines([]byte(in))
+
+		if !bytes.HasSuffix(out, []byte("\r\n")) {
+			t.Errorf("%.20q: missing CRLF at the end", in)
+		}
+
+		for i, line := range bytes.Split(bytes.TrimSuffix(out, []byte("\r\n")), []byte("\r\n")) {
+			if len(line) > MaxLineOctets {
+				t.Errorf("%.20q: line %d is %d octets", in, i+1, len(line))
+			}
+			if !utf8.Valid(line) {
+				t.Errorf("%.20q: line %d splits a character: %q", in, i+1, line)
+			}
+			if bytes.Contains(line, []byte("\n")) {
+				t.Errorf("%.20q: line %d has a bare LF", in, i+1)
+			}
+		}
+
+		// Folding is undone by unfoldLines and folding twice is a no-op
+		lines, _, err := unfoldLines(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := strings.TrimSuffix(strings.Replace(in, "\r\n", "\n", -1), "\n")
+		if got := strings.Join(lines, "\n"); got != want {
+			t.Errorf("%.20q: got %q after unfolding", in, got)
+		}
+
+		if again := foldLines(out); !bytes.Equal(again, out) {
+			t.Errorf("%.20q: folding again changed the output", in)
+		}
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	// Folded with a space and with a tab, LF and CRLF line endings, and text
+	// with escaped commas, semicolons, and newlines
+	ics := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\n" +
+		"UID:swim-1@example.com\r\n" +
+		"SUMMARY:Masters Swim\\, Lap\r\n" +
+		"  Pool\r\n" +
+		"DESCRIPTION:Limited to 20\\; sign up early\\nBring fins\r\n" +
+		"\tand a kickboard\r\n" +
+		"DTSTART;TZID=America/Los_Angeles:20260301T173000\r\n" +
+		"ATTENDEE;CN=\"Coach; Pool: North\";ROLE=CHAIR:mailto:coach@example.com\r\n" +
+		"CATEGORIES:swim,masters\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	roots, err := parseICS(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0].Name != "VCALENDAR" {
+		t.Fatalf("got %d roots, want a VCALENDAR", len(roots))
+	}
+
+	events := roots[0].Sub("VEVENT")
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	ev := events[0]
+
+	if ev.Line != 3 || ev.EndLine != 12 {
+		t.Errorf("got event on lines %d to %d, want 3 to 12", ev.Line, ev.EndLine)
+	}
+
+	for _, tc := range []struct {
+		name, value string
+		line        int
+	}{
+		{"UID", "swim-1@example.com", 4},
+		{"SUMMARY", `Masters Swim\, Lap Pool`, 5},
+		{"DESCRIPTION", `Limited to 20\; sign up early\nBring finsand a kickboard`, 7},
+		{"DTSTART", "20260301T173000", 9},
+		{"ATTENDEE", "mailto:coach@example.com", 10},
+		{"CATEGORIES", "swim,masters", 11},
+	} {
+		p := ev.Get(tc.name)
+		if p == nil {
+			t.Errorf("missing %s", tc.name)
+			continue
+		}
+
+		if p.Value != tc.value {
+			t.Errorf("%s: got `%s`, want `%s`", tc.name, p.Value, tc.value)
+		}
+		if p.Line != tc.line {
+			t.Errorf("%s: got line %d, want %d", tc.name, p.Line, tc.line)
+		}
+	}
+
+	if v := ev.Get("DTSTART").Param("TZID"); v != "America/Los_Angeles" {
+		t.Errorf("got TZID `%s`", v)
+	}
+	if v := ev.Get("ATTENDEE").Param("CN"); v != "Coach; Pool: North" {
+		t.Errorf("got CN `%s`", v)
+	}
+	if v := ev.Get("ATTENDEE").Param("ROLE"); v != "CHAIR" {
+		t.Errorf("got ROLE `%s`", v)
+	}
+}
+
+func TestParseICSInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		ics, err string
+	}{
+		{"BEGIN:VCALENDAR\nVERSION:2.0\n", "line 1: missing END:VCALENDAR"},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n", "line 3: unexpected END:VCALENDAR"},
+		{"VERSION:2.0\n", "line 1: property VERSION outside of component"},
+		{"BEGIN:VCALENDAR\nVERSION\n", "line 2: missing `:` in content line"},
+		{"BEGIN:VCALENDAR\nDTSTART;TZID:20260301\n", "line 2: invalid parameter `TZID`"},
+	} {
+		_, err := parseICS(strings.NewReader(tc.ics))
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("%q: got error %v, want %s", tc.ics, err, tc.err)
+		}
+	}
+}
+
+// TestICalText checks that escaped text survives rendering, folding, and
+// parsing.
+func TestICalText(t *testing.T) {
+	text := "Limited to 20 swimmers; lanes 1, 2, and 3\nBring fins \\ paddles"
+	want := `Limited to 20 swimmers\; lanes 1\, 2\, and 3\nBring fins \\ paddles`
+
+	if got := icalText(text); got != want {
+		t.Fatalf("got `%s`, want `%s`", got, want)
+	}
+	if got := icalUnescape(want); got != text {
+		t.Errorf("got `%s` after unescaping", got)
+	}
+
+	line := "DESCRIPTION:" + strings.Repeat(icalText(text)+" ", 3)
+	ics := foldLines([]byte("BEGIN:VCALENDAR\n" + line + "\nEND:VCALENDAR\n"))
+
+	roots, err := parseICS(bytes.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := roots[0].Value("DESCRIPTION"); got != strings.Repeat(want+" ", 3) {
+		t.Errorf("got `%s`", got)
+	}
+}
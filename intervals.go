@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// IntervalsURL is the base of the intervals.icu API.
+const IntervalsURL = "https://intervals.icu/api/v1"
+
+// intervalsTypes maps workout types to intervals.icu activity types, other
+// types aren't pushed.
+var intervalsTypes = map[string]string{
+	"swim": "Swim",
+	"bike": "Ride",
+	"run":  "Run",
+}
+
+// intervalsEvent is a planned workout on the intervals.icu calendar.
+type intervalsEvent struct {
+	Category    string `json:"category"`
+	Start       string `json:"start_date_local"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// MovingTime is the planned duration in seconds
+	MovingTime int `json:"moving_time"`
+
+	// ExternalID makes the push idempotent, events with the same ID are
+	// updated instead of duplicated
+	ExternalID string `json:"external_id"`
+}
+
+// intervalsTarget pushes the workouts to an athlete's intervals.icu calendar
+// as planned workouts.
+type intervalsTarget struct {
+	athlete string
+	apiKey  string
+	client  *http.Client
+	dryRun  bool
+}
+
+func (t *intervalsTarget) Name() string {
+	return "intervals.icu"
+}
+
+func (t *intervalsTarget) Publish(cal *Calendar, status *TargetStatus) error {
+	var events []intervalsEvent
+
+	for _, w := range cal.Workouts {
+		typ, ok := intervalsTypes[w.Type]
+		if !ok {
+			continue
+		}
+
+		events = append(events, intervalsEvent{
+			Category:    "WORKOUT",
+			Start:       w.Start.Format("2006-01-02T15:04:05"),
+			Type:        typ,
+			Name:        w.Summary,
+			Description: w.Description,
+			MovingTime:  int(w.End.Sub(w.Start).Seconds()),
+			ExternalID:  w.UID,
+		})
+	}
+
+	if t.dryRun {
+		log.Printf("dry run, not pushing %d workouts to intervals.icu", len(events))
+		return nil
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%s/athlete/%s/events/bulk?upsert=true", IntervalsURL, t.athlete)
+	req, err := http.NewRequest("POST", u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("API_KEY", t.apiKey)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unable to push workouts, status code: %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	status.Written = len(events)
+	runSummary.Synced += len(events)
+
+	return nil
+}
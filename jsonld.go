@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// FormatJSONLD is schema.org Events in JSON-LD, for embedding in a web page
+// so that search engines show the workouts as events.
+const FormatJSONLD = "jsonld"
+
+// Organizer of every event.
+var jsonldOrganizer = map[string]string{
+	"@type": "Organization",
+	"name":  "Tri-Valley Triathlon Club",
+	"url":   "https://www.trivalleytriclub.com/",
+}
+
+// jsonldEvent is a schema.org Event.
+type jsonldEvent struct {
+	Context        string            `json:"@context"`
+	Type           string            `json:"@type"`
+	Name           string            `json:"name"`
+	StartDate      string            `json:"startDate"`
+	EndDate        string            `json:"endDate"`
+	Description    string            `json:"description,omitempty"`
+	URL            string            `json:"url,omitempty"`
+	AttendanceMode string            `json:"eventAttendanceMode"`
+	Status         string            `json:"eventStatus"`
+	Location       *jsonldPlace      `json:"location,omitempty"`
+	Organizer      map[string]string `json:"organizer"`
+}
+
+// jsonldPlace is a schema.org Place.
+type jsonldPlace struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Address jsonldAddress `json:"address"`
+}
+
+// jsonldAddress is a schema.org PostalAddress.
+type jsonldAddress struct {
+	Type          string `json:"@type"`
+	StreetAddress string `json:"streetAddress"`
+}
+
+// renderJSONLD renders the workouts as a JSON-LD array of Events.
+func renderJSONLD(cal *Calendar) ([]byte, error) {
+	events := []jsonldEvent{}
+
+	for _, w := range cal.Workouts {
+		status := "https://schema.org/EventScheduled"
+		if w.Status == StatusCancelled {
+			status = "https://schema.org/EventCancelled"
+		}
+
+		events = append(events, jsonldEvent{
+			Context:        "https://schema.org",
+			Type:           "Event",
+			Name:           w.Summary,
+			StartDate:      w.Start.Format(time.RFC3339),
+			EndDate:        w.End.Format(time.RFC3339),
+			Description:    w.Description,
+			URL:            w.SignupURL,
+			AttendanceMode: "https://schema.org/OfflineEventAttendanceMode",
+			Status:         status,
+			Location:       newJSONLDPlace(w.Location),
+			Organizer:      jsonldOrganizer,
+		})
+	}
+
+	b, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// newJSONLDPlace splits the location, the venue followed by its address,
+// into a Place. Returns nil if there is no location.
+func newJSONLDPlace(location string) *jsonldPlace {
+	if location == "" {
+		return nil
+	}
+
+	parts := strings.SplitN(location, ", ", 2)
+
+	place := &jsonldPlace{
+		Type:    "Place",
+		Name:    parts[0],
+		Address: jsonldAddress{Type: "PostalAddress", StreetAddress: parts[0]},
+	}
+	if len(parts) == 2 {
+		place.Address.StreetAddress = parts[1]
+	}
+
+	return place
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+)
+
+// FormatLanding is the format name of the landing page, used to find its
+// override template.
+const FormatLanding = "landing"
+
+// QRScale is the size in pixels of each QR code module.
+const QRScale = 6
+
+// Template for the subscription landing page
+const LandingTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{block "title" .}}{{.Title}}{{end}}</title>
+<style>
+{{block "style" .}}body { font-family: sans-serif; }
+.feed { display: inline-block; margin: 1em; text-align: center; }
+.feed img { display: block; margin: 0 auto; }
+{{end}}</style>
+</head>
+<body>
+<h1>{{template "title" .}}</h1>
+{{range .Feeds}}{{block "feed" .}}<section class="feed">
+<h2>{{.Name}}</h2>
+<img src="{{.QR}}" alt="{{t "QR code for"}} {{.URL}}">
+<p><a href="{{.Webcal}}">{{t "Subscribe"}}</a> &middot; <a href="{{.URL}}">{{t "Download"}}</a></p>
+</section>
+{{end}}{{end}}</body>
+</html>
+`
+
+// Landing configures the subscription landing page written by -landing.
+type Landing struct {
+	// Title of the page
+	Title string `json:"title"`
+
+	// Feeds are the published calendars to link to, such as per-filter
+	// variants. Defaults to a single feed for -feed-url.
+	Feeds []Feed `json:"feeds"`
+}
+
+// Feed is a published calendar that members can subscribe to.
+type Feed struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// landingFeed is a Feed along with everything the template needs to link to
+// it.
+type landingFeed struct {
+	Feed
+
+	// Webcal is the URL with the webcal scheme, which most clients open as
+	// a subscription instead of a one-off import
+	Webcal htmltemplate.URL
+
+	// QR is a data URI with a PNG of the QR code for URL
+	QR htmltemplate.URL
+}
+
+// landingTarget writes the subscription landing page.
+type landingTarget struct {
+	fname     string
+	landing   Landing
+	templates *Templates
+}
+
+func (t *landingTarget) Name() string {
+	return t.fname
+}
+
+func (t *landingTarget) Publish(cal *Calendar, status *TargetStatus) error {
+	out, err := t.render()
+	if err != nil {
+		return err
+	}
+
+	return writeFile(t.fname, out, 0, status)
+}
+
+// render renders the landing page, the calendar itself isn't needed.
+func (t *landingTarget) render() ([]byte, error) {
+	if len(t.landing.Feeds) == 0 {
+		return nil, errors.New("no feeds for the landing page, see -feed-url")
+	}
+
+	data := struct {
+		Title string
+		Feeds []landingFeed
+	}{Title: t.landing.Title}
+
+	locale := ""
+	if t.templates != nil && t.templates.Config != nil {
+		locale = t.templates.Config.Locale
+	}
+
+	if data.Title == "" {
+		data.Title = translate(locale, "Tri-Valley Triathlon Club Workouts")
+	}
+
+	for _, feed := range t.landing.Feeds {
+		if feed.Name == "" {
+			feed.Name = translate(locale, "All workouts")
+		}
+
+		f, err := newLandingFeed(feed)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Feeds = append(data.Feeds, f)
+	}
+
+	override, err := t.templates.override(FormatLanding)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := htmltemplate.New(FormatLanding).Funcs(htmltemplate.FuncMap(t.templates.funcs())).Parse(LandingTemplate)
+	if err == nil && override != "" {
+		tmpl, err = tmpl.Parse(override)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	return buf.Bytes(), err
+}
+
+// newLandingFeed creates the webcal link and QR code for the feed.
+func newLandingFeed(feed Feed) (landingFeed, error) {
+	u, err := url.Parse(feed.URL)
+	if err != nil {
+		return landingFeed{}, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return landingFeed{}, fmt.Errorf("feed URL must be http or https: %s", feed.URL)
+	}
+
+	u.Scheme = "webcal"
+
+	// The QR code gets the https URL, camera apps handle it everywhere
+	// while support for webcal varies
+	qr, err := encodeQR([]byte(feed.URL))
+	if err != nil {
+		return landingFeed{}, err
+	}
+
+	img, err := qr.png(QRScale)
+	if err != nil {
+		return landingFeed{}, err
+	}
+
+	return landingFeed{
+		Feed:   feed,
+		Webcal: htmltemplate.URL(u.String()),
+		QR:     htmltemplate.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(img)),
+	}, nil
+}
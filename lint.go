@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxLineOctets is the maximum length of a line before it must be folded, see
+// RFC 5545 Sec 3.1.
+const MaxLineOctets = 75
+
+// Severity of a lint Problem.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+
+	return "warning"
+}
+
+// Problem is an interop problem found by lintICS.
+type Problem struct {
+	Line     int
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%v: %s", p.Severity, p.Message)
+	}
+
+	return fmt.Sprintf("line %d: %v: %s", p.Line, p.Severity, p.Message)
+}
+
+// lintICS checks an iCalendar file for the most common problems that break
+// clients, Outlook in particular.
+func lintICS(b []byte) []Problem {
+	var problems []Problem
+
+	add := func(line int, sev Severity, format string, args ...interface{}) {
+		problems = append(problems, Problem{line, sev, fmt.Sprintf(format, args...)})
+	}
+
+	if bytes.HasPrefix(b, []byte("\xef\xbb\xbf")) {
+		add(1, Warning, "file starts with a UTF-8 byte order mark")
+		b = b[3:]
+	}
+
+	if !utf8.Valid(b) {
+		add(0, Error, "file is not valid UTF-8")
+	}
+
+	// Checks on the raw lines, only report the first occurrence of each
+	var bareLF, long, firstBareLF, firstLong int
+	newlines := bytes.Count(b, []byte("\n"))
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		if i == newlines {
+			// Trailing data after the last newline
+			break
+		}
+
+		if !bytes.HasSuffix(line, []byte("\r")) {
+			if bareLF == 0 {
+				firstBareLF = i + 1
+			}
+			bareLF++
+		}
+
+		if len(bytes.TrimSuffix(line, []byte("\r"))) > MaxLineOctets {
+			if long == 0 {
+				firstLong = i + 1
+			}
+			long++
+		}
+	}
+
+	if bareLF > 0 {
+		add(firstBareLF, Warning, "%d lines end with a bare LF instead of CRLF", bareLF)
+	}
+	if long > 0 {
+		add(firstLong, Warning, "%d lines are longer than %d octets and should be folded", long, MaxLineOctets)
+	}
+
+	roots, err := parseICS(bytes.NewReader(b))
+	if err != nil {
+		add(0, Error, "%v", err)
+		return problems
+	}
+
+	if len(roots) == 0 || roots[0].Name != "VCALENDAR" {
+		add(0, Error, "missing VCALENDAR")
+		return problems
+	}
+	if len(roots) > 1 {
+		add(roots[1].Line, Warning, "multiple top-level components, most clients only read the first")
+	}
+
+	cal := roots[0]
+
+	if v := cal.Value("VERSION"); v != "2.0" {
+		add(cal.Line, Error, "VERSION must be 2.0, not `%s`", v)
+	}
+	if cal.Get("PRODID") == nil {
+		add(cal.Line, Error, "missing PRODID")
+	}
+
+	tzids := map[string]bool{}
+	for _, tz := range cal.Sub("VTIMEZONE") {
+		tzids[tz.Value("TZID")] = true
+	}
+
+	events := cal.Sub("VEVENT")
+	if len(events) == 0 {
+		add(cal.Line, Warning, "calendar does not contain any events")
+	}
+
+	uids := map[string]int{}
+	for _, ev := range events {
+		for _, name := range []string{"UID", "DTSTAMP", "DTSTART"} {
+			if ev.Get(name) == nil {
+				add(ev.Line, Error, "VEVENT missing %s", name)
+			}
+		}
+
+		if uid := ev.Value("UID"); uid != "" && ev.Get("RECURRENCE-ID") == nil {
+			if line, ok := uids[uid]; ok {
+				add(ev.Line, Error, "duplicate UID `%s`, first used on line %d", uid, line)
+			}
+			uids[uid] = ev.Line
+		}
+
+		if ev.Get("DTEND") != nil && ev.Get("DURATION") != nil {
+			add(ev.Line, Error, "VEVENT has both DTEND and DURATION")
+		}
+
+		for _, p := range ev.Properties {
+			if tzid := p.Param("TZID"); tzid != "" && !tzids[tzid] {
+				add(p.Line, Error, "TZID `%s` does not have a matching VTIMEZONE", tzid)
+			}
+		}
+
+		lintEventTimes(ev, add)
+	}
+
+	return problems
+}
+
+// lintEventTimes checks that DTSTART and DTEND parse and are consistent.
+func lintEventTimes(ev *Component, add func(int, Severity, string, ...interface{})) {
+	times := map[string]time.Time{}
+	dates := map[string]bool{}
+
+	for _, name := range []string{"DTSTART", "DTEND", "DTSTAMP"} {
+		p := ev.Get(name)
+		if p == nil {
+			continue
+		}
+
+		t, date, err := parseICalTime(p, time.UTC)
+		if err != nil {
+			add(p.Line, Error, "invalid %s `%s`", name, p.Value)
+			continue
+		}
+
+		times[name] = t
+		dates[name] = date
+	}
+
+	start, ok := times["DTSTART"]
+	end, ok2 := times["DTEND"]
+	if !ok || !ok2 {
+		return
+	}
+
+	line := ev.Get("DTEND").Line
+	if dates["DTSTART"] != dates["DTEND"] {
+		add(line, Error, "DTSTART and DTEND must both be dates or both be date-times")
+	} else if end.Before(start) {
+		add(line, Error, "DTEND is before DTSTART")
+	} else if end.Equal(start) {
+		add(line, Warning, "DTEND is the same as DTSTART")
+	}
+}
+
+// lintFiles lints each file, printing the problems. Returns the number of
+// files with errors.
+func lintFiles(fnames []string) int {
+	failed := 0
+
+	for _, fname := range fnames {
+		b, err := os.ReadFile(fname)
+		if err != nil {
+			fmt.Printf("%s: %v\n", fname, err)
+			failed++
+			continue
+		}
+
+		problems := lintICS(b)
+		for _, p := range problems {
+			fmt.Printf("%s: %v\n", fname, p)
+		}
+
+		if hasErrors(problems) {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// hasErrors returns true if any of the problems are errors.
+func hasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Severity == Error {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLintOwnOutput checks that the calendars rendered by ICalTemplate lint
+// clean, including long and escaped text.
+func TestLintOwnOutput(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, time.March, 1, 17, 30, 0, 0, loc)
+	cal := &Calendar{
+		Name:        "TVTC, Masters & Track",
+		Description: "Workouts; from the club's calendar",
+		Workouts: []*Workout{{
+			Summary:     "Masters Swim",
+			Location:    "Dublin High School Aquatic Center, 8151 Village Pkwy, Dublin, CA",
+			Start:       start,
+			End:         start.Add(time.Hour),
+			UID:         "swim-1@trivalleytriclub.com",
+			Description: strings.Repeat("Limited to 20 swimmers; sign up early, lanes fill up (Régionale)\n", 4),
+			SignupURL:   "https://www.trivalleytriclub.com/signup?event=12345&session=" + strings.Repeat("abcdef", 10),
+		}},
+		Stamp: start,
+	}
+
+	out, err := (&Templates{}).render(cal, FormatICal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range lintICS(out) {
+		t.Errorf("%v", p)
+	}
+}
+
+func TestLintICS(t *testing.T) {
+	const header = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//\r\n"
+	const event = "BEGIN:VEVENT\r\nUID:a@example.com\r\nDTSTAMP:20260301T000000Z\r\nDTSTART:20260301T173000Z\r\nDTEND:20260301T183000Z\r\nEND:VEVENT\r\n"
+	const footer = "END:VCALENDAR\r\n"
+
+	for _, tc := range []struct {
+		name string
+		ics  string
+		want []string
+	}{
+		{"valid", header + event + footer, nil},
+		{
+			"bare LF",
+			strings.Replace(header+event+footer, "\r\n", "\n", -1),
+			[]string{"line 1: warning: 10 lines end with a bare LF instead of CRLF"},
+		},
+		{
+			"long lines",
+			header + strings.Replace(event, "UID:a@example.com", "UID:"+strings.Repeat("a", 80), 1) + footer,
+			[]string{"line 5: warning: 1 lines are longer than 75 octets and should be folded"},
+		},
+		{
+			"folded",
+			header + strings.Replace(event, "UID:a@example.com", "UID:"+strings.Repeat("a", 70)+"\r\n "+strings.Repeat("a", 70), 1) + footer,
+			nil,
+		},
+		{
+			"BOM",
+			BOM + header + event + footer,
+			[]string{"line 1: warning: file starts with a UTF-8 byte order mark"},
+		},
+		{
+			"no events",
+			header + footer,
+			[]string{"line 1: warning: calendar does not contain any events"},
+		},
+		{"not a calendar", "BEGIN:VEVENT\r\nEND:VEVENT\r\n", []string{"error: missing VCALENDAR"}},
+		{"unbalanced", header + "BEGIN:VEVENT\r\n" + footer, []string{"error: line 5: unexpected END:VCALENDAR"}},
+		{
+			"version and prodid",
+			"BEGIN:VCALENDAR\r\nVERSION:1.0\r\n" + event + footer,
+			[]string{"line 1: error: VERSION must be 2.0, not `1.0`", "line 1: error: missing PRODID"},
+		},
+		{
+			"missing properties",
+			header + "BEGIN:VEVENT\r\nSUMMARY:Swim\r\nEND:VEVENT\r\n" + footer,
+			[]string{"line 4: error: VEVENT missing UID", "line 4: error: VEVENT missing DTSTAMP", "line 4: error: VEVENT missing DTSTART"},
+		},
+		{
+			"duplicate UID",
+			header + event + event + footer,
+			[]string{"line 10: error: duplicate UID `a@example.com`, first used on line 4"},
+		},
+		{
+			"DTEND and DURATION",
+			header + strings.Replace(event, "END:VEVENT", "DURATION:PT1H\r\nEND:VEVENT", 1) + footer,
+			[]string{"line 4: error: VEVENT has both DTEND and DURATION"},
+		},
+		{
+			"TZID",
+			header + strings.Replace(event, "DTSTART:20260301T173000Z", "DTSTART;TZID=America/Los_Angeles:20260301T093000", 1) + footer,
+			[]string{"line 7: error: TZID `America/Los_Angeles` does not have a matching VTIMEZONE"},
+		},
+		{
+			"DTEND before DTSTART",
+			header + strings.Replace(event, "DTEND:20260301T183000Z", "DTEND:20260301T163000Z", 1) + footer,
+			[]string{"line 8: error: DTEND is before DTSTART"},
+		},
+		{
+			"date and date-time",
+			header + strings.Replace(event, "DTEND:20260301T183000Z", "DTEND;VALUE=DATE:20260302", 1) + footer,
+			[]string{"line 8: error: DTSTART and DTEND must both be dates or both be date-times"},
+		},
+		{
+			"invalid DTSTART",
+			header + strings.Replace(event, "DTSTART:20260301T173000Z", "DTSTART:tomorrow", 1) + footer,
+			[]string{"line 7: error: invalid DTSTART `tomorrow`"},
+		},
+	} {
+		var got []string
+		for _, p := range lintICS([]byte(tc.ics)) {
+			got = append(got, p.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s: got problems:\n\t%s\nwant:\n\t%s", tc.name, strings.Join(got, "\n\t"), strings.Join(tc.want, "\n\t"))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// ErrLocked is returned when another run holds the lock.
+var ErrLocked = errors.New("another run in progress")
+
+// acquireLock takes an exclusive lock on fname, creating it if needed, so
+// that overlapping runs (cron and a manual run, say) can't interleave their
+// writes. The lock is held until release is called or the process exits.
+func acquireLock(fname string) (release func(), err error) {
+	f, err := lockFile(fname)
+	if err == ErrLocked {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := f.Close(); err != nil {
+			log.Printf("unable to release lock %s: %v", fname, err)
+		}
+	}, nil
+}
+
+// runLock takes the -lock for a run, by default .tvtccal.lock in the
+// directory of the first -out. Noop with -dry-run, which doesn't write.
+func runLock() (release func(), err error) {
+	if *dryRun {
+		return func() {}, nil
+	}
+
+	lock := *lockPath
+	if lock == "" && len(outFiles.Values) > 0 {
+		_, fname := splitOut(outFiles.Values[0])
+		lock = filepath.Join(filepath.Dir(fname), ".tvtccal.lock")
+	} else if lock == "" {
+		lock = ".tvtccal.lock"
+	}
+
+	return acquireLock(lock)
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import "os"
+
+// lockFile opens fname, file locking isn't supported on this platform so
+// overlapping runs aren't prevented.
+func lockFile(fname string) (*os.File, error) {
+	return os.OpenFile(fname, os.O_RDWR|os.O_CREATE, 0644)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, returned when another
+// process has the file open.
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens fname without sharing it with other processes, which is an
+// exclusive lock for as long as the handle is open.
+func lockFile(fname string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(name,
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		0, // no sharing
+		nil,
+		syscall.OPEN_ALWAYS,
+		syscall.FILE_ATTRIBUTE_NORMAL,
+		0)
+	if err == errorSharingViolation {
+		return nil, ErrLocked
+	} else if err != nil {
+		return nil, &os.PathError{Op: "open", Path: fname, Err: err}
+	}
+
+	return os.NewFile(uintptr(h), fname), nil
+}
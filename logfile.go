@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogTimeFormat is the suffix added to the names of rotated log files.
+const LogTimeFormat = "20060102T150405"
+
+// rotatingFile is a log file that is rotated once it grows past maxSize.
+// Rotated files are removed once there are more than backups of them or they
+// are older than maxAge, whichever comes first. Zero values disable the
+// limits.
+type rotatingFile struct {
+	fname   string
+	maxSize int64
+	maxAge  time.Duration
+	backups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// openRotatingFile opens fname for appending.
+func openRotatingFile(fname string, maxSize int64, maxAge time.Duration, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		fname:   fname,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		backups: backups,
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the current file rather than losing output
+			fmt.Fprintf(os.Stderr, "unable to rotate %s: %v\n", r.fname, err)
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// open opens the log file, recording its current size.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = fi.Size()
+	return nil
+}
+
+// rotate renames the log file with a timestamp, starts a new one, and prunes
+// old backups.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	backup := r.fname + "." + time.Now().Format(LogTimeFormat)
+	if err := os.Rename(r.fname, backup); err != nil {
+		// Reopen so that logging can continue
+		if err2 := r.open(); err2 != nil {
+			return err2
+		}
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.prune()
+	return nil
+}
+
+// prune removes backups past the limits, errors are ignored since they only
+// cost disk space.
+func (r *rotatingFile) prune() {
+	matches, err := filepath.Glob(r.fname + ".*")
+	if err != nil {
+		return
+	}
+
+	var backups []string
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, r.fname+".")
+		if _, err := time.Parse(LogTimeFormat, suffix); err == nil {
+			backups = append(backups, m)
+		}
+	}
+
+	// Newest first, the timestamps sort lexically
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, b := range backups {
+		if r.backups > 0 && i >= r.backups {
+			os.Remove(b)
+			continue
+		}
+
+		if r.maxAge > 0 {
+			if fi, err := os.Stat(b); err == nil && time.Since(fi.ModTime()) > r.maxAge {
+				os.Remove(b)
+			}
+		}
+	}
+}
@@ -2,297 +2,1088 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
+	"github.com/jcrussell/tvtccal/tvtccal"
 	"golang.org/x/net/html"
-
-	"launchpad.net/xmlpath"
 )
 
 const (
-	CalendarURL = "http://www.trivalleytriclub.com/calendar"
+	CalendarURL = tvtccal.CalendarURL
 
 	// Timezone for calendar, all events on Pacific time
-	Timezone = "America/Los_Angeles"
+	Timezone = tvtccal.Timezone
 
 	// Time format, see RFC 2445 Sec 4.3.5
 	ICalTimeFormat = "20060102T150405Z"
 
-	// XPaths to various things of interest
-	TRPath     = `//div[@id="main"]/table/tbody/tr`
-	MonthXpath = `//div[@id="main"]/table/caption`
-	TDPath     = `./td`
+	// ProdID identifies the calendars that tvtccal generates
+	ProdID = "-//Tri-Valley Triathlon Club//trivalleytriclub.com//"
 )
 
-// Default timezone Location
-var Location *time.Location
-
-// Template for the output, an ical file
+// Template for the output, an ical file. The header and event blocks may be
+// redefined by templates in the -templates directory.
 const ICalTemplate = `BEGIN:VCALENDAR
-VERSION:2.0
-PRODID:-//Tri-Valley Triathlon Club//trivalleytriclub.com//
+{{block "header" .}}VERSION:2.0
+PRODID:` + ProdID + `
 METHOD:PUBLISH
-{{range .}}BEGIN:VEVENT
+{{with .Name}}NAME:{{text .}}
+X-WR-CALNAME:{{text .}}
+{{end}}{{with .Description}}DESCRIPTION:{{text .}}
+X-WR-CALDESC:{{text .}}
+{{end}}{{with .Color}}COLOR:{{.}}
+{{end}}{{range .Properties}}{{.Name}}:{{.Value}}
+{{end}}{{end}}{{range .Workouts}}{{block "event" .}}BEGIN:VEVENT
 TRANSP:TRANSPARENT
-DTSTART:{{.Start}}
-DTEND:{{.End}}
-SUMMARY:{{.Summary}}
-LOCATION:{{.Location}}
-UID:{{.Start}}-{{.End}}@trivalleytriclub.com
-SEQUENCE:0
+DTSTART:{{ical .Start}}
+DTEND:{{ical .End}}
+SUMMARY:{{text .Summary}}
+LOCATION:{{text .Location}}
+{{if .Description}}DESCRIPTION:{{text .Description}}
+{{end}}{{if .Priority}}PRIORITY:{{.Priority}}
+{{end}}{{if .Status}}STATUS:{{.Status}}
+{{end}}{{if .Color}}COLOR:{{.Color}}
+{{end}}{{with .SignupURL}}URL:{{.}}
+{{end}}{{if .Planned}}CATEGORIES:` + PlanCategory + `,{{text .Type}}
+{{end}}UID:{{.UID}}
+SEQUENCE:{{.Sequence}}
 DTSTAMP:{{now}}
-END:VEVENT
-{{end}}END:VCALENDAR`
+{{range .Properties}}{{.Name}}:{{.Value}}
+{{end}}{{range .Alarms}}BEGIN:VALARM
+ACTION:{{.Action}}
+TRIGGER:{{.Trigger}}
+{{if .Description}}DESCRIPTION:{{text .Description}}
+{{end}}{{if .Attendee}}SUMMARY:{{text .Description}}
+ATTENDEE:mailto:{{.Attendee}}
+{{end}}END:VALARM
+{{end}}END:VEVENT
+{{end}}{{end}}END:VCALENDAR`
 
 type Workout struct {
-	Summary  string
-	Location string
-	Start    string
-	End      string
+	Summary  string    `json:"summary"`
+	Location string    `json:"location"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+
+	// UID identifies the workout across runs, see uidFor
+	UID string `json:"uid"`
+
+	// Description is the DESCRIPTION, optional
+	Description string `json:"description,omitempty"`
+	// Type is the category assigned by the classifier, see TypeRule
+	Type string `json:"type"`
+	// Sport is swim, bike, run, etc. for dashboards, see Config.Sports
+	Sport string `json:"sport,omitempty"`
+	// Status is the iCal STATUS assigned by the status rules, optional
+	Status string `json:"status,omitempty"`
+	// Priority is the iCal PRIORITY for the workout, zero if undefined
+	Priority int `json:"priority,omitempty"`
+	// Capacity is the signup limit, zero if unlimited or unknown
+	Capacity int `json:"capacity,omitempty"`
+	// Remaining is the number of spots left, nil if unknown
+	Remaining *int `json:"remaining,omitempty"`
+	// Color is the CSS color name of the event, defaults to -cal-color
+	Color string `json:"color,omitempty"`
+	// Week is the week of the season, zero if before season_start or unset
+	Week int `json:"week,omitempty"`
+	// Session counts the workouts with the same summary during the season
+	Session int `json:"session,omitempty"`
+	// HasDuration is set if the calendar or a rule gave the duration, see
+	// -durations
+	HasDuration bool `json:"-"`
+	// Alarms are the VALARMs for the workout, see AlarmRule
+	Alarms []Alarm `json:"-"`
+	// Properties are extra properties from the config
+	Properties []Property `json:"-"`
+	// Sequence is the iCal SEQUENCE, bumped by the -state whenever the
+	// workout changes
+	Sequence int `json:"sequence,omitempty"`
+	// Planned is set for the workouts from the -plan
+	Planned bool `json:"planned,omitempty"`
+	// SignupURL is the registration link from the calendar, optional
+	SignupURL string `json:"signup_url,omitempty"`
+
+	// contentKey replaces the event key in the UID, see setContentKeys
+	contentKey string
+	// shifted is how far the Shifter moved the start, see -shift-start
+	shifted time.Duration
+}
+
+// Calendar is the data passed to the output templates.
+type Calendar struct {
+	// Name, Description, and Color brand the feed, see -cal-name
+	Name        string
+	Description string
+	Color       string
+
+	Properties []Property
+	Workouts   []*Workout
+
+	// Stamp is the DTSTAMP of the events, the current time if zero
+	Stamp time.Time
+
+	// Year and Month of the calendar page, or of the first page when they
+	// are merged. Zero if the calendar isn't from a page.
+	Year  int
+	Month time.Month
+}
+
+// Day is all the workouts on a single day.
+type Day struct {
+	Date     time.Time
+	Workouts []*Workout
+}
+
+// Days groups the workouts by day, assumes the workouts are sorted by start.
+func (c *Calendar) Days() []*Day {
+	var days []*Day
+
+	for _, w := range c.Workouts {
+		y, m, d := w.Start.Date()
+		if len(days) == 0 || !sameDay(days[len(days)-1].Date, w.Start) {
+			days = append(days, &Day{Date: time.Date(y, m, d, 0, 0, 0, 0, w.Start.Location())})
+		}
+
+		day := days[len(days)-1]
+		day.Workouts = append(day.Workouts, w)
+	}
+
+	return days
 }
 
+// sameDay returns true if a and b are on the same date.
+func sameDay(a, b time.Time) bool {
+	y, m, d := a.Date()
+	y2, m2, d2 := b.Date()
+	return y == y2 && m == m2 && d == d2
+}
+
+// options are every flag of tvtccal, each subcommand's FlagSet has the ones
+// that apply to it, see Subcommand.
+var options = flag.NewFlagSet("tvtccal", flag.ContinueOnError)
+
 var (
-	testFile = flag.String("test", "", "test using a predownloaded HTML file")
-	outFile  = flag.String("out", "tvtc.ical", "output file")
+	outFiles = stringsFlag{Values: []string{"tvtc.ical"}}
+	matches  stringsFlag
+	drops    stringsFlag
+	includes stringsFlag
+	excludes stringsFlag
+
+	testFile      = options.String("test", "", "test using predownloaded HTML files, may be a file, glob, or directory")
+	perFixture    = options.Bool("per-fixture", false, "with -test, write separate outputs for each fixture")
+	confFile      = options.String("config", "", "JSON config file")
+	minimal       = options.Bool("minimal-update", false, "carry forward unchanged events from the existing output file")
+	dryRun        = options.Bool("dry-run", false, "print changes to the output file instead of writing it")
+	noColor       = options.Bool("no-color", false, "disable colors in -dry-run output")
+	summaryOut    = options.String("summary-out", "", "write a JSON summary of the run")
+	tmplDir       = options.String("templates", "", "directory with templates that override the defaults")
+	tmplFile      = options.String("template", "", "template that overrides the iCalendar template, instead of ical.tmpl in -templates")
+	summaryPrefix = options.String("summary-prefix", "", "prefix added to every summary, e.g. \"TVTC: \"")
+	summarySuffix = options.String("summary-suffix", "", "suffix added to every summary")
+	summaryTmpl   = options.String("summary-template", "", "template that replaces the summary, e.g. \"{{.Summary}} ({{.Type}})\"")
+	badges        = options.Bool("badges", false, "prepend a per-type emoji or tag to every summary")
+	shiftStart    = options.String("shift-start", "", "move the start of every workout, e.g. -15m to arrive early")
+	outFormat     = options.String("format", "", "output format, overrides the one picked from the -out extension, only with a single -out")
+	landingFile   = options.String("landing", "", "write an HTML landing page with subscription links and QR codes")
+	stateFile     = options.String("state", "", "JSON file that remembers past runs, events, and held notifications, for -max-deviation, SEQUENCE, and quiet_hours")
+	maxDeviation  = options.Float64("max-deviation", 0, "warn when the number of workouts deviates from the recent average by more than this percent")
+	refuseAnomaly = options.Bool("refuse-anomalies", false, "with -max-deviation, don't publish when the number of workouts is anomalous")
+	maxChanges    = options.Float64("max-changes", 0, "refuse to overwrite an output file when more than this percent of its events changed or disappeared")
+	force         = options.Bool("force", false, "publish even if -max-changes is exceeded or the output fails preflight")
+	stampMode     = options.String("dtstamp", StampNow, "DTSTAMP of the events: now, fixed, or source-mtime, the latter two make the output reproducible")
+	lockPath      = options.String("lock", "", "lock file that prevents overlapping runs, defaults to .tvtccal.lock next to the first -out")
+	proxy         = options.String("proxy", "", "proxy to fetch the calendar through, e.g. socks5://127.0.0.1:9050, defaults to HTTP_PROXY and friends")
+	lights        = options.Bool("lights", false, "note when outdoor workouts end after sunset")
+	against       = options.String("against", "", "personal iCalendar file to check for conflicts, see conflicts")
+	yearFlag      = options.Int("year", 0, "year of the calendar, instead of inferring it from the current date")
+	monthFlag     = options.String("month", "", "month of the calendar (e.g. 3 or March), instead of reading it from the page")
+	uuidUIDs      = options.Bool("uuid", false, "use UUIDv5 UIDs, see uid_namespace in the config")
+	feedURL       = options.String("feed-url", "", "https URL where the calendar is published, for -landing")
+	monthsAhead   = options.Int("months", 0, "also fetch the next N months and merge them into the calendar")
+	monthsBack    = options.Int("back", 0, "also fetch the previous N months, e.g. for backfill")
+	backfillDelay = options.String("backfill-delay", "2s", "pause between the months pushed by backfill, to stay under API rate limits")
+	within        = options.String("within", "", "only keep workouts at venues within this distance of home in the config, e.g. 15mi or 25km")
+	contentUIDs   = options.Bool("content-uids", false, "derive UIDs from the summary, location, and day instead of the start and end, so rescheduled workouts keep their UID")
+	modelFile     = options.String("model", "", "JSON file with the types learned by classify review, for workouts that the type rules don't match")
+	durationsFlag = options.String("durations", "", "duration of workouts by type or sport when the calendar doesn't give one, e.g. swim=60m,bike=150m,run=75m,default=90m")
+	cacheDir      = options.String("cache-dir", "", "keep the last copy of each page fetched from the club's site here, and parse it when the site is unreachable")
+	numbering     = options.String("number", "", "annotate summaries with the week of the season (week) or the session number (session), see season_start in the config")
+	planFile      = options.String("plan", "", "CSV file of planned key sessions and races to add to the calendar until they are on the club's site")
+	site          = options.String("site", "", "homepage of a club using the same calendar as TVTC, to find its calendar page instead of using the TVTC one")
+
+	// intervals.icu push, see intervalsTarget
+	intervalsAthlete = options.String("intervals-athlete", "", "intervals.icu athlete ID to push swims, rides, and runs to as planned workouts")
+	intervalsKey     = options.String("intervals-api-key", "", "intervals.icu API key, see Settings > Developer Settings")
+
+	// Log file rotation, see rotatingFile
+	logFile    = options.String("log-file", "", "log to this file instead of stderr")
+	logMaxSize = options.Int("log-max-size", 10, "size in MB at which -log-file is rotated")
+	logMaxAge  = options.String("log-max-age", "30d", "remove rotated log files older than this")
+	logBackups = options.Int("log-backups", 5, "number of rotated log files to keep")
+
+	// Branding of the published feed, see Calendar
+	calName  = options.String("cal-name", "", "display name of the calendar")
+	calDesc  = options.String("cal-description", "", "description of the calendar")
+	calColor = options.String("cal-color", "", "CSS color name of the calendar and its events, e.g. teal")
+
+	// HTTP server for subscriptions, see calendarServer
+	serveInterval = options.String("serve-interval", "1h", "how often serve refreshes the calendar")
+	tlsCert       = options.String("tls-cert", "", "certificate file for serve to use HTTPS with, with -tls-key")
+	tlsKey        = options.String("tls-key", "", "private key file of -tls-cert")
+	tlsDomains    = options.String("tls-domain", "", "comma separated domains that serve gets certificates for from Let's Encrypt, e.g. cal.trivalleytriclub.com, instead of -tls-cert")
+
+	// Daemon mode, see daemon
+	daemonMode     = options.Bool("daemon", false, "keep running and publish the calendar again every -interval, e.g. under systemd")
+	daemonInterval = options.String("interval", "6h", "how often -daemon publishes the calendar, a random delay of up to a tenth of it is added")
+
+	// Changes to the published calendar, see changesFeed
+	changesFile = options.String("changes-feed", "", "write an Atom feed of the changes to the first iCalendar -out")
+
+	// CalDAV publishing, see caldavTarget
+	caldavURL      = options.String("caldav-url", "", "CalDAV calendar to publish the events to, e.g. https://cloud.example.com/remote.php/dav/calendars/tvtc/workouts/")
+	caldavUser     = options.String("caldav-user", "", "user name for -caldav-url")
+	caldavPassword = options.String("caldav-password", "", "password, or app password, for -caldav-url")
+
+	// Manifests for checking mirrors, see Manifest
+	manifest    = options.Bool("manifest", false, "write a manifest with the SHA-256 of each -out next to it, named like the -out plus "+ManifestSuffix)
+	manifestKey = options.String("manifest-key", "", "secret that manifests are signed with, and that verify checks the signature with")
+	maxAge      = options.String("max-age", "", "with verify, fail if the manifest is older than this, e.g. 2d")
+
+	// Metrics for cron runs, see RunSummary.metrics
+	pushgateway    = options.String("pushgateway", "", "Prometheus Pushgateway to push the outcome of the run to, e.g. http://localhost:9091")
+	pushgatewayJob = options.String("pushgateway-job", "tvtccal", "job to push the metrics under, for -pushgateway")
+
+	// Chat notifications about schedule changes, see notifications in the
+	// config for more
+	slackWebhook   = options.String("slack-webhook", "", "Slack incoming webhook to post schedule changes to")
+	discordWebhook = options.String("discord-webhook", "", "Discord webhook to post schedule changes to")
+
+	// Output encoding, see Templates.encode
+	encoding = options.String("encoding", EncodingUTF8, "encoding of the outputs: utf-8, ascii to transliterate non-ASCII characters, or ascii-strict to fail on them")
+	bom      = options.Bool("bom", false, "start the outputs, except JSON, with a UTF-8 byte order mark, for clients that need one")
+
+	// Attendance journaling, see Journal
+	journalFile = options.String("journal", "", "JSON file that attend and skip record attendance in, for report attendance")
 )
 
-// fixHTML cleans up messy HTML before running it through xmlpath which expects
-// cleaner HTML.
-func fixHTML(reader io.Reader) (*xmlpath.Node, error) {
-	var buf bytes.Buffer
+// stringsFlag is a flag that may be repeated. Setting it replaces the default
+// values.
+type stringsFlag struct {
+	Values []string
+
+	set bool
+}
+
+func (f *stringsFlag) String() string {
+	return strings.Join(f.Values, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	if !f.set {
+		f.Values = nil
+		f.set = true
+	}
+
+	f.Values = append(f.Values, v)
+	return nil
+}
+
+// parseHTML parses the calendar page.
+func parseHTML(reader io.Reader) (*html.Node, error) {
+	return html.Parse(reader)
+}
 
-	root, err := html.Parse(reader)
+// colorName matches the CSS color names allowed for COLOR, see RFC 7986 Sec 5.9.
+var colorName = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// calendarPages returns the pages of the calendar at base for the previous
+// months, the current month, and the next months, in order.
+func calendarPages(base string, back, ahead int, now time.Time) ([]fixture, error) {
+	if back < 0 {
+		return nil, fmt.Errorf("invalid -back: %d", back)
+	}
+	if ahead < 0 {
+		return nil, fmt.Errorf("invalid -months: %d", ahead)
+	}
+
+	loc, err := time.LoadLocation(Timezone)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	html.Render(&buf, root)
+	var pages []fixture
 
-	return xmlpath.ParseHTML(&buf)
+	now = now.In(loc)
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+
+	for i := -back; i <= ahead; i++ {
+		if i == 0 {
+			pages = append(pages, fixture{fname: base})
+			continue
+		}
+
+		t := first.AddDate(0, i, 0)
+
+		u, err := url.Parse(base)
+		if err != nil {
+			return nil, err
+		}
+
+		v := u.Query()
+		v.Set("month", strconv.Itoa(int(t.Month())))
+		v.Set("year", strconv.Itoa(t.Year()))
+		u.RawQuery = v.Encode()
+
+		pages = append(pages, fixture{
+			fname: u.String(),
+			opts:  tvtccal.ParseOptions{Year: t.Year(), Month: t.Month()},
+		})
+	}
+
+	return pages, nil
 }
 
-// parseMonth extracts the month from the caption inside the main table
-func parseMonth(n *xmlpath.Node) time.Month {
-	val, ok := xmlpath.MustCompile(MonthXpath).String(n)
-	if !ok {
-		log.Fatal("failed to find month")
+// dedupeWorkouts removes workouts that appear more than once, such as those
+// in the days of the adjacent months shown on each page. The first one wins.
+func dedupeWorkouts(workouts []*Workout) []*Workout {
+	type key struct {
+		start             time.Time
+		summary, location string
 	}
 
-	month := strings.TrimSpace(strings.Split(val, " ")[0])
-	for i := 1; i < 12; i++ {
-		if time.Month(i).String() == month {
-			return time.Month(i)
+	seen := map[key]bool{}
+
+	var res []*Workout
+	for _, w := range workouts {
+		k := key{w.Start.UTC(), w.Summary, w.Location}
+		if seen[k] {
+			continue
 		}
+
+		seen[k] = true
+		res = append(res, w)
+	}
+
+	if n := len(workouts) - len(res); n > 0 {
+		log.Printf("removed %d duplicate workouts", n)
 	}
 
-	log.Fatalf("invalid month: `%s`", month)
-	return time.January
+	return res
 }
 
-// parseDayOfMonth finds the number in the first TD of a TR containing days of
-// the month.
-func parseDayOfMonth(n *xmlpath.Node) int {
-	val, ok := xmlpath.MustCompile(TDPath).String(n)
-	if !ok {
-		log.Fatal("failed to find day")
+// selectors are the selectors from the config, see tvtccal.Selectors.
+var selectors tvtccal.Selectors
+
+// parseCalendar extracts the workouts from the calendar page, see
+// tvtccal.ParsePage. Also returns the first day of the page's month.
+func parseCalendar(root *html.Node, opts tvtccal.ParseOptions) ([]*Workout, time.Time, error) {
+	opts.Warnf = warnf
+	opts.Selectors = selectors
+
+	page, err := tvtccal.ParsePage(root, opts)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var workouts []*Workout
+	for _, w := range page.Workouts {
+		workouts = append(workouts, &Workout{
+			Summary:     w.Summary,
+			Location:    w.Location,
+			Start:       w.Start,
+			End:         w.End,
+			Description: w.Description,
+			HasDuration: w.HasDuration,
+			SignupURL:   w.SignupURL,
+		})
 	}
 
-	parts := strings.Split(strings.TrimSpace(val), " ")
-	d, err := strconv.Atoi(parts[len(parts)-1])
+	return workouts, time.Date(page.Year, page.Month, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+func init() {
+	options.Var(&outFiles, "out", "output file, may be repeated, the format is based on the extension or a FORMAT: prefix")
+	options.Var(&matches, "match", "only keep workouts whose summary or description match the regexp, may be repeated")
+	options.Var(&drops, "drop", "drop workouts whose summary or description match the regexp, may be repeated")
+	options.Var(&includes, "include", "only keep workouts whose summary has one of the comma separated keywords, e.g. swim,bike, or matches the regexp, may be repeated")
+	options.Var(&excludes, "exclude", "drop workouts whose summary has one of the comma separated keywords, e.g. \"board meeting\", or matches the regexp, may be repeated")
+}
+
+func main() {
+	cmd, args, err := parseSubcommand(os.Args[1:])
+	if err == flag.ErrHelp {
+		if cmd, _, err := parseSubcommand(os.Args[2:]); err == nil && len(os.Args) > 2 {
+			cmd.usage(os.Stdout)
+		} else {
+			usage(os.Stdout)
+		}
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	fs := cmd.flagSet()
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		os.Exit(2)
+	}
+
+	if *confFile == "" {
+		*confFile = os.Getenv(envName("config"))
+	}
+
+	config, err := loadConfig(*confFile)
 	if err != nil {
-		log.Fatalf("failed to parse day: `%s`", val)
+		fatal(err)
+	}
+
+	selectors = config.Selectors
+
+	if config.sources, err = resolveFlags(fs, config); err != nil {
+		fatal(err)
+	}
+
+	if err := checkEncoding(*encoding); err != nil {
+		fatal(err)
+	}
+
+	// Otherwise it would silently override the extension of every -out
+	if *outFormat != "" && len(outFiles.Values) > 1 {
+		fatal(errors.New("-format can't be used with more than one -out, prefix each with its format instead, e.g. -out gcal-csv:members.csv"))
 	}
 
-	return d
+	if *logFile != "" {
+		maxAge, err := parseDuration(*logMaxAge)
+		if err != nil {
+			fatal(fmt.Errorf("invalid -log-max-age: %v", err))
+		}
+
+		f, err := openRotatingFile(*logFile, int64(*logMaxSize)<<20, maxAge, *logBackups)
+		if err != nil {
+			fatal(err)
+		}
+
+		log.SetOutput(f)
+	}
+
+	if *modelFile != "" {
+		if config.model, err = loadModel(*modelFile); err != nil {
+			fatal(err)
+		}
+	}
+
+	client, err := newHTTPClient(*proxy)
+	if err != nil {
+		fatal(err)
+	}
+
+	notifiers, err = newNotifiers(append(config.Notifications, flagNotifiers(*slackWebhook, *discordWebhook)...), client)
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := cmd.Run(config, fs.Args()); err != nil {
+		if status, ok := err.(exitStatus); ok {
+			os.Exit(int(status))
+		}
+		fatal(err)
+	}
 }
 
-// parseWorkoutRow handles a TR containing workouts. Increments base by one day
-// per TD as each TD contains all the workouts for a single day.
-func parseWorkoutRow(base *time.Time, n *xmlpath.Node) []*Workout {
-	path := xmlpath.MustCompile(TDPath)
+// publishAll fetches the calendar and publishes it to every target, then sends
+// the notifications and records the run in the -state. Returns the number of
+// targets that failed and the total.
+func publishAll(config *Config) (int, int, error) {
+	start := time.Now()
+
+	pages, err := loadPages()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	groups, mtimes, months, err := fetchGroups(pages)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	runSummary.phase("fetch", start)
+	start = time.Now()
+
+	state, err := openState()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cals, err := buildCalendars(config, groups, mtimes, months)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if state != nil {
+		for _, cal := range cals {
+			state.sequence(cal.Workouts, runSummary.Start)
+		}
+	}
+
+	runSummary.phase("parse", start)
+	start = time.Now()
 
-	workouts := []*Workout{}
+	failed, total, err := publishCalendars(config, cals, pages, newTemplates(config))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	runSummary.phase("write", start)
 
-	iter := path.Iter(n)
-	for iter.Next() {
-		workouts = append(workouts, parseWorkouts(*base, iter.Node())...)
-		*base = base.Add(24 * time.Hour)
+	if !*dryRun {
+		state.deliver(config.Locale, cals, time.Now())
 	}
+	state.saveRun()
 
-	return workouts
+	return failed, total, nil
 }
 
-// parseWorkouts handles all workouts for a single day. Extracts information
-// into Workout structs.
-func parseWorkouts(base time.Time, n *xmlpath.Node) []*Workout {
-	var workouts []*Workout
+// loadCalendars fetches and builds the calendars, like publishAll, for the
+// subcommands that report on them instead.
+func loadCalendars(config *Config) ([]*Calendar, error) {
+	pages, err := loadPages()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, mtimes, months, err := fetchGroups(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := openState()
+	if err != nil {
+		return nil, err
+	}
+
+	cals, err := buildCalendars(config, groups, mtimes, months)
+	if err != nil {
+		return nil, err
+	}
 
-	lines := strings.Split(n.String(), "\n")
-	for len(lines) >= 11 {
-		loc := []string{}
-		for i := 0; i < 3; i++ {
-			loc = append(loc, strings.TrimSpace(lines[3+2*i]))
+	if state != nil {
+		for _, cal := range cals {
+			state.sequence(cal.Workouts, runSummary.Start)
 		}
+	}
+
+	return cals, nil
+}
+
+// publishCalendars publishes each calendar to the -out files and sync
+// targets. Returns the number of targets that failed and the total.
+func publishCalendars(config *Config, cals []*Calendar, pages []fixture, templates *Templates) (int, int, error) {
+	var targets []Target
+	failed := 0
+
+	tracked := false
+
+	for i, cal := range cals {
+		var group []Target
+		for _, out := range outFiles.Values {
+			format, fname := splitOut(out)
+			if format == "" {
+				format = *outFormat
+			}
+
+			fixture := ""
+			if *perFixture {
+				fixture = pages[i].name()
+
+				// Templates name the outputs themselves with .Fixture
+				if !isOutTemplate(fname) {
+					fname = pages[i].outName(fname)
+				}
+			}
+
+			fname, err := expandOutName(fname, cal, fixture)
+			if err != nil {
+				return 0, 0, err
+			}
 
-		parts := strings.Split(strings.TrimSpace(lines[9]), " ")
-		if len(parts) != 2 {
-			log.Printf("unexpected number of parts in time: `%s`", lines[9])
+			format, err = formatFor(fname, format)
+			if err != nil {
+				return 0, 0, err
+			}
 
-			return nil
+			target := &fileTarget{
+				fname:      fname,
+				format:     format,
+				templates:  templates,
+				minimal:    *minimal,
+				dryRun:     *dryRun,
+				color:      !*noColor && os.Getenv("NO_COLOR") == "",
+				maxChanges: *maxChanges,
+				force:      *force,
+
+				manifest:    *manifest,
+				manifestKey: *manifestKey,
+			}
+
+			// Changes to the first iCalendar output go to the changes
+			// feed and the notifiers
+			if format == FormatICal && !tracked {
+				tracked = true
+
+				var feed *changesFeed
+				if *changesFile != "" {
+					title := cal.Name
+					if title == "" {
+						title = "Tri-Valley Triathlon Club Workouts"
+					}
+
+					feed = &changesFeed{fname: *changesFile, title: title, link: *feedURL}
+				}
+
+				target.changed = func(changes []EventChange) {
+					if feed != nil {
+						if err := feed.add(changes, time.Now()); err != nil {
+							warnf("unable to update %s: %v", feed.fname, err)
+						}
+					}
+
+					notify(changesNotification(config.Locale, changes))
+				}
+			}
+
+			group = append(group, target)
 		}
 
-		hourmins := strings.Split(parts[0], ":")
-		if len(hourmins) != 2 {
-			log.Printf("unable to parse time as duration: `%s`", parts[0])
-			return nil
+		if *landingFile != "" && i == 0 {
+			landing := config.Landing
+			if len(landing.Feeds) == 0 && *feedURL != "" {
+				landing.Feeds = []Feed{{URL: *feedURL}}
+			}
+
+			group = append(group, &landingTarget{
+				fname:     *landingFile,
+				landing:   landing,
+				templates: templates,
+			})
 		}
-		hour, err := strconv.Atoi(hourmins[0])
-		min, err2 := strconv.Atoi(hourmins[1])
-		if err != nil || err2 != nil {
-			log.Printf("unable to parse time as duration: `%s`", parts[0])
-			return nil
+
+		syncs, err := syncTargets(templates)
+		if err != nil {
+			return 0, 0, err
 		}
+		group = append(group, syncs...)
 
-		if parts[1] == "PM" {
-			hour += 12
-		} else if parts[1] != "AM" {
-			log.Printf("expected AM/PM and not: `%s`", parts[1])
-			return nil
+		if !*force {
+			if err := preflight(cal, templates); err != nil {
+				failed += abandon(group, err)
+				targets = append(targets, group...)
+				continue
+			}
 		}
 
-		// Create the precise start date so that it should handle daylight savings
-		start := time.Date(
-			base.Year(), base.Month(), base.Day(), // Only care about date from base
-			hour, min, // Parsed from HTML
-			0, 0, // Seconds/nanoseconds
-			Location,
-		)
+		failed += publish(group, cal)
+		targets = append(targets, group...)
+	}
 
-		workouts = append(workouts, &Workout{
-			Summary:  strings.TrimSpace(lines[2]),
-			Location: strings.TrimSpace(strings.Join(loc, ", ")),
-			Start:    start.UTC().Format(ICalTimeFormat),
-			End:      start.Add(time.Minute * 90).UTC().Format(ICalTimeFormat),
+	return failed, len(targets), nil
+}
+
+// syncTargets returns the targets for the calendar services that the
+// workouts are pushed to, if any are configured.
+func syncTargets(templates *Templates) ([]Target, error) {
+	var targets []Target
+
+	client, err := newHTTPClient(*proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	if *intervalsAthlete != "" {
+		targets = append(targets, &intervalsTarget{
+			athlete: *intervalsAthlete,
+			apiKey:  *intervalsKey,
+			client:  client,
+			dryRun:  *dryRun,
 		})
+	}
+
+	if *caldavURL != "" {
+		// Each event is its own resource on the server, a byte order mark
+		// would end up in the middle of them
+		noBOM := *templates
+		noBOM.BOM = false
 
-		// Chop off already processed workout
-		lines = lines[10:]
+		targets = append(targets, &caldavTarget{
+			url:       *caldavURL,
+			user:      *caldavUser,
+			password:  *caldavPassword,
+			templates: &noBOM,
+			client:    client,
+			dryRun:    *dryRun,
+		})
 	}
 
-	return workouts
+	return targets, nil
 }
 
-// writeCalendar renders the workouts using the ICalTemplate to fname.
-func writeCalendar(fname string, workouts []*Workout) error {
-	fns := template.FuncMap{
-		"now": func() string {
-			return time.Now().UTC().Format(ICalTimeFormat)
-		},
+// fetch reads the page from the fixture or, when not testing, downloads it
+// from the calendar. Also returns when the page was last modified, if known.
+func fetch(page fixture) ([]byte, time.Time, error) {
+	if page.fname == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		return b, time.Time{}, err
+	}
+
+	if offline() {
+		fi, err := os.Stat(page.fname)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		b, err := os.ReadFile(page.fname)
+		return b, fi.ModTime(), err
 	}
 
-	f, err := os.Create(fname)
+	log.Printf("downloading %s", page.fname)
+
+	client, err := newHTTPClient(*proxy)
 	if err != nil {
-		return err
+		return nil, time.Time{}, err
 	}
-	defer f.Close()
 
-	tmpl, err := template.New("ical").Funcs(fns).Parse(ICalTemplate)
+	resp, err := client.Get(page.fname)
 	if err != nil {
-		return err
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, time.Time{}, fmt.Errorf("unable to fetch calendar, status code: %d", resp.StatusCode)
 	}
 
-	return tmpl.Execute(f, workouts)
+	// Zero if the header is missing or invalid
+	mtime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	b, err := io.ReadAll(resp.Body)
+	return b, mtime, err
 }
 
-// parseCalendar takes a parsed HTML tree and extracts all the workouts from
-// the main table.
-func parseCalendar(root *xmlpath.Node) ([]*Workout, error) {
-	var err error
-	var base time.Time
-	var workouts []*Workout
+// newHTTPClient returns a client that goes through the proxy, given as a URL
+// such as socks5://127.0.0.1:9050. If proxy is empty, the standard
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables are used.
+func newHTTPClient(proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
 
-	path := xmlpath.MustCompile(TRPath)
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %v", err)
+		}
 
-	now := time.Now()
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme: %s", u.Scheme)
+		}
 
-	month := parseMonth(root)
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// offline reports whether the pages are read from files given by -test or
+// convert instead of downloaded.
+func offline() bool {
+	return *testFile != "" || len(convertFiles) > 0
+}
+
+// loadPages returns the pages to fetch, either the club's calendar or the
+// -test or convert fixtures, with the -year and -month overrides applied.
+func loadPages() ([]fixture, error) {
+	var pages []fixture
+	var err error
+
+	if len(convertFiles) > 0 {
+		for _, fname := range convertFiles {
+			var fs []fixture
+			if fs, err = fixtures(fname); err != nil {
+				break
+			}
+			pages = append(pages, fs...)
+		}
+	} else if *testFile != "" {
+		pages, err = fixtures(*testFile)
+	} else {
+		base := CalendarURL
+		if *site != "" {
+			client, err := newHTTPClient(*proxy)
+			if err != nil {
+				return nil, err
+			}
 
-	year := now.Year()
-	if month == time.December && now.Month() == time.January {
-		// On last week of the year
-		year -= 1
+			if base, err = discoverCalendar(client, *site); err != nil {
+				return nil, err
+			}
+		}
+
+		pages, err = calendarPages(base, *monthsBack, *monthsAhead, time.Now())
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	Location, err = time.LoadLocation(Timezone)
+	month, err := parseMonthName(*monthFlag)
 	if err != nil {
 		return nil, err
 	}
 
-	iter := path.Iter(root)
-	for i := 0; iter.Next(); i++ {
-		node := iter.Node()
+	for i := range pages {
+		if *yearFlag != 0 {
+			pages[i].opts.Year = *yearFlag
+		}
+		if month != 0 {
+			pages[i].opts.Month = month
+		}
+	}
 
-		if i == 0 {
-			day := parseDayOfMonth(node)
-			base = time.Date(year, month, day, 0, 0, 0, 0, Location)
+	return pages, nil
+}
+
+// fetchGroups fetches and parses the workouts from each page, merged into a
+// single group unless -per-fixture is set. Also returns the last time each
+// group was modified, zero if unknown, and the month of each group's first
+// page.
+func fetchGroups(pages []fixture) ([][]*Workout, []time.Time, []time.Time, error) {
+	var groups [][]*Workout
+	var mtimes, months []time.Time
+
+	// Only pages downloaded from the club's site are cached
+	cached := *cacheDir != "" && !offline()
+
+	p := newProgress("fetched", "pages", len(pages), time.Now())
+
+	for _, page := range pages {
+		b, mtime, err := fetch(page)
+		stale := false
+		if err != nil && cached {
+			var cerr error
+			if b, mtime, cerr = loadCachedPage(*cacheDir, page.fname); cerr != nil {
+				return nil, nil, nil, err
+			}
+
+			warnf("unable to fetch %s: %v, using the stale copy from %s", page.fname, err, mtime.Format("Jan 2 15:04"))
+			runSummary.Stale = append(runSummary.Stale, page.fname)
+			stale = true
+		} else if err != nil {
+			return nil, nil, nil, err
 		}
 
-		if i%2 == 1 {
-			workouts = append(workouts, parseWorkoutRow(&base, node)...)
+		runSummary.Fetched++
+
+		root, err := parseHTML(bytes.NewReader(b))
+		if err != nil {
+			return nil, nil, nil, err
 		}
+
+		workouts, month, err := parseCalendar(root, page.opts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// Only pages that parsed are cached, so an error page from the
+		// site doesn't replace a good copy
+		if cached && !stale {
+			if err := saveCachedPage(*cacheDir, page.fname, b, mtime); err != nil {
+				warnf("unable to cache %s: %v", page.fname, err)
+			}
+		}
+
+		log.Printf("parsed %d workouts from %s", len(workouts), page.fname)
+		runSummary.Parsed += len(workouts)
+
+		if len(groups) == 0 || *perFixture {
+			groups = append(groups, nil)
+			mtimes = append(mtimes, time.Time{})
+			months = append(months, month)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], workouts...)
+
+		if mtime.After(mtimes[len(mtimes)-1]) {
+			mtimes[len(mtimes)-1] = mtime
+		}
+
+		p.step(time.Now())
 	}
 
-	return workouts, nil
-}
+	// The first and last weeks of each month overlap with the adjacent ones
+	for i := range groups {
+		groups[i] = dedupeWorkouts(groups[i])
+	}
 
-func main() {
-	flag.Parse()
+	return groups, mtimes, months, nil
+}
 
-	var r io.Reader
-	var err error
+// buildCalendars processes each group of workouts into a calendar, see
+// fetchGroups.
+func buildCalendars(config *Config, groups [][]*Workout, mtimes, months []time.Time) ([]*Calendar, error) {
+	var cals []*Calendar
 
-	if *testFile != "" {
-		r, err = os.Open(*testFile)
+	for i, workouts := range groups {
+		cal, err := process(config, workouts)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-	} else {
-		log.Printf("downloading %s", CalendarURL)
 
-		resp, err := http.Get(CalendarURL)
+		cal.Year, cal.Month = months[i].Year(), months[i].Month()
+
+		cal.Stamp, err = dtstamp(*stampMode, mtimes[i])
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != 200 {
-			log.Fatalf("unable to fetch calendar, status code: %d", resp.StatusCode)
+		cals = append(cals, cal)
+	}
+
+	return cals, nil
+}
+
+// process applies the config, shifts, filters, and decorations to the parsed
+// workouts and builds the calendar from them.
+func process(config *Config, workouts []*Workout) (*Calendar, error) {
+	if *planFile != "" {
+		plan, err := loadPlan(*planFile)
+		if err != nil {
+			return nil, err
 		}
 
-		r = resp.Body
+		workouts = mergePlan(workouts, plan, config.Precedence)
+	}
+
+	if err := config.apply(workouts); err != nil {
+		return nil, err
+	}
+
+	extractCapacity(workouts)
+
+	if *contentUIDs {
+		setContentKeys(workouts)
 	}
 
-	root, err := fixHTML(r)
+	durations, err := parseDurations(*durationsFlag)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("invalid -durations: %v", err)
 	}
 
-	workouts, err := parseCalendar(root)
+	setDurations(workouts, durations)
+
+	if !config.seasonStart.IsZero() {
+		numberWorkouts(workouts, config.seasonStart)
+
+		if *numbering == NumberSession {
+			checkNumbering(workouts, config.seasonStart)
+		}
+	}
+
+	shifter, err := newShifter(*shiftStart, config.ShiftStart)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	log.Printf("parsed %d workouts", len(workouts))
+	shifter.Locale = config.Locale
+	shifter.shift(workouts)
 
-	if err := writeCalendar(*outFile, workouts); err != nil {
-		log.Fatal(err)
+	if *lights {
+		noteLights(workouts, config.Daylight, config.Locale)
 	}
+
+	filter, err := newFilter(matches.Values, drops.Values, includes.Values, excludes.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	workouts = filter.filter(workouts)
+
+	if *within != "" {
+		km, err := parseDistance(*within)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -within: %v", err)
+		}
+
+		workouts, err = filterWithin(workouts, config.Home, config.Venues, km)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("%d workouts after filtering", len(workouts))
+
+	switch *numbering {
+	case "", NumberWeek, NumberSession:
+	default:
+		return nil, fmt.Errorf("invalid -number, must be week or session: %s", *numbering)
+	}
+
+	if *numbering != "" && config.seasonStart.IsZero() {
+		return nil, errors.New("-number requires season_start in the config")
+	}
+
+	decorator := &Decorator{
+		Template: *summaryTmpl,
+		Number:   *numbering,
+		Locale:   config.Locale,
+		Prefix:   *summaryPrefix,
+		Suffix:   *summarySuffix,
+	}
+	if *badges {
+		decorator.Badges = config.Badges
+	}
+	if err := decorator.decorate(workouts); err != nil {
+		return nil, err
+	}
+
+	var namespace []byte
+	if *uuidUIDs {
+		namespace = config.uidNamespace
+	}
+
+	if *calColor != "" && !colorName.MatchString(*calColor) {
+		return nil, fmt.Errorf("invalid -cal-color, must be a CSS color name: %s", *calColor)
+	}
+
+	for _, w := range workouts {
+		w.UID = uidFor(w, namespace)
+
+		if w.Color == "" {
+			w.Color = strings.ToLower(*calColor)
+		}
+	}
+
+	if err := config.expandEventProperties(workouts); err != nil {
+		return nil, err
+	}
+
+	cal, err := config.calendar(workouts)
+	if err != nil {
+		return nil, err
+	}
+
+	cal.Name = *calName
+	cal.Description = *calDesc
+	cal.Color = strings.ToLower(*calColor)
+
+	return cal, nil
 }
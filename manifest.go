@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestSuffix is appended to the name of an output to name its manifest.
+const ManifestSuffix = ".manifest.json"
+
+// Manifest describes a published output so that copies of it on mirrors can
+// be checked with verify.
+type Manifest struct {
+	File      string    `json:"file"`
+	SHA256    string    `json:"sha256"`
+	Size      int       `json:"size"`
+	Generated time.Time `json:"generated"`
+
+	// Signature is the hex HMAC-SHA256 of the other fields, see -manifest-key
+	Signature string `json:"signature,omitempty"`
+}
+
+// newManifest describes the output b, signing it with key if set.
+func newManifest(fname string, b []byte, now time.Time, key string) *Manifest {
+	sum := sha256.Sum256(b)
+
+	m := &Manifest{
+		File:      filepath.Base(fname),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      len(b),
+		Generated: now.UTC().Truncate(time.Second),
+	}
+
+	if key != "" {
+		m.Signature = m.sign(key)
+	}
+
+	return m
+}
+
+// sign returns the signature of the manifest with key.
+func (m *Manifest) sign(key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n", m.File, m.SHA256, m.Size, m.Generated.UTC().Format(time.RFC3339))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// write saves the manifest next to the output fname.
+func (m *Manifest) write(fname string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(fname+ManifestSuffix, append(b, '\n'), 0644)
+}
+
+// verify checks that b is the output described by the manifest. If key is
+// set, the manifest must be signed with it. If maxAge is set, the manifest
+// must have been generated within maxAge of now.
+func (m *Manifest) verify(b []byte, key string, maxAge time.Duration, now time.Time) error {
+	if key != "" {
+		if m.Signature == "" {
+			return errors.New("manifest is not signed")
+		}
+		if !hmac.Equal([]byte(m.Signature), []byte(m.sign(key))) {
+			return errors.New("manifest signature does not match, it was tampered with or signed with another key")
+		}
+	}
+
+	if maxAge > 0 && now.Sub(m.Generated) > maxAge {
+		return fmt.Errorf("manifest is stale, generated %s ago", now.Sub(m.Generated).Truncate(time.Second))
+	}
+
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != m.SHA256 {
+		return fmt.Errorf("SHA-256 is %s, expected %s", got, m.SHA256)
+	}
+
+	if len(b) != m.Size {
+		return fmt.Errorf("size is %d, expected %d", len(b), m.Size)
+	}
+
+	return nil
+}
+
+// readSource reads a local file or, for http and https URLs, downloads it.
+func readSource(client *http.Client, name string) ([]byte, error) {
+	if !strings.HasPrefix(name, "http://") && !strings.HasPrefix(name, "https://") {
+		return os.ReadFile(name)
+	}
+
+	resp, err := client.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s: status code: %d", name, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// runVerify checks the feed, a file or URL, against the manifest, also a file
+// or URL, printing the result.
+func runVerify(w io.Writer, client *http.Client, manifest, feed, key string, maxAge time.Duration) error {
+	b, err := readSource(client, manifest)
+	if err != nil {
+		return err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("unable to parse %s: %v", manifest, err)
+	}
+
+	out, err := readSource(client, feed)
+	if err != nil {
+		return err
+	}
+
+	if err := m.verify(out, key, maxAge, time.Now()); err != nil {
+		return fmt.Errorf("%s: %v", feed, err)
+	}
+
+	fmt.Fprintf(w, "%s: ok, matches %s generated %s\n", feed, m.File, m.Generated.Format(time.RFC3339))
+
+	return nil
+}
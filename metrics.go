@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// metrics renders the summary in the Prometheus text format. The time of the
+// last successful run is only included if the run succeeded, pushing with
+// POST keeps the previous value otherwise.
+func (s *RunSummary) metrics(now time.Time) []byte {
+	failed := 0
+	for _, t := range s.Targets {
+		if !t.OK {
+			failed++
+		}
+	}
+
+	success := 0
+	if s.Error == "" && failed == 0 {
+		success = 1
+	}
+
+	var buf bytes.Buffer
+
+	gauge := func(name, help string, v interface{}) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, v)
+	}
+
+	gauge("tvtccal_last_run_timestamp_seconds", "When the last run finished.", now.Unix())
+	gauge("tvtccal_last_run_success", "Whether the last run and all its targets succeeded.", success)
+	if success == 1 {
+		gauge("tvtccal_last_success_timestamp_seconds", "When the last successful run finished.", now.Unix())
+	}
+	gauge("tvtccal_run_duration_seconds", "Duration of the last run.", now.Sub(s.Start).Seconds())
+	gauge("tvtccal_workouts_parsed", "Workouts parsed by the last run.", s.Parsed)
+	gauge("tvtccal_events_written", "Events written by the last run.", s.Written)
+	gauge("tvtccal_events_synced", "Events pushed to sync targets by the last run.", s.Synced)
+	gauge("tvtccal_warnings", "Warnings logged by the last run.", len(s.Warnings))
+	gauge("tvtccal_targets_failed", "Targets that failed in the last run.", failed)
+	gauge("tvtccal_served_staleness_seconds", "Age of the calendar served by serve when the last refresh failed, zero otherwise.", s.Staleness)
+
+	return buf.Bytes()
+}
+
+// push sends the metrics to the Prometheus Pushgateway at gateway under job.
+// Noop if gateway is empty.
+func (s *RunSummary) push(gateway, job string) error {
+	if gateway == "" {
+		return nil
+	}
+
+	client, err := newHTTPClient(*proxy)
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+
+	resp, err := client.Post(u, "text/plain; version=0.0.4", bytes.NewReader(s.metrics(time.Now())))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unable to push metrics, status code: %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+
+	return nil
+}
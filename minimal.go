@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+)
+
+// minimalUpdate carries forward the events in prev that are unchanged in
+// cur, ignoring DTSTAMP, verbatim so that clients don't re-sync events that
+// didn't actually change. Returns the merged calendar and the number of
+// events that are new or changed.
+func minimalUpdate(prev, cur []byte) ([]byte, int, error) {
+	prevEvents, err := eventsByUID(prev)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	roots, err := parseICS(bytes.NewReader(cur))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(roots) == 0 {
+		return nil, 0, errors.New("rendered calendar is empty")
+	}
+
+	prevLines := bytes.SplitAfter(prev, []byte("\n"))
+	curLines := bytes.SplitAfter(cur, []byte("\n"))
+
+	var buf bytes.Buffer
+	changed := 0
+	next := 0 // index of the next line from cur to copy
+
+	for _, ev := range roots[0].Sub("VEVENT") {
+		old, ok := prevEvents[ev.Value("UID")]
+		if !ok || !old.equal(ev, "DTSTAMP") {
+			changed++
+			continue
+		}
+
+		for _, line := range curLines[next : ev.Line-1] {
+			buf.Write(line)
+		}
+		for _, line := range prevLines[old.Line-1 : old.EndLine] {
+			buf.Write(line)
+		}
+
+		next = ev.EndLine
+	}
+
+	for _, line := range curLines[next:] {
+		buf.Write(line)
+	}
+
+	// Outputs from before the line endings were CRLF are carried forward too
+	return foldLines(buf.Bytes()), changed, nil
+}
+
+// eventsByUID parses the events in an iCalendar file into a map keyed by UID.
+func eventsByUID(b []byte) (map[string]*Component, error) {
+	roots, err := parseICS(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	events := map[string]*Component{}
+	for _, root := range roots {
+		for _, ev := range root.Sub("VEVENT") {
+			events[ev.Value("UID")] = ev
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinimalUpdate(t *testing.T) {
+	event := func(uid, stamp, summary string) string {
+		return "BEGIN:VEVENT\r\nUID:" + uid + "\r\nDTSTAMP:" + stamp + "\r\nSUMMARY:" + summary + "\r\nEND:VEVENT\r\n"
+	}
+	calendar := func(events ...string) string {
+		return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+	}
+
+	const old, now = "20260301T000000Z", "20260308T000000Z"
+
+	prev := calendar(
+		event("swim", old, "Masters Swim"),
+		event("run", old, "Track"),
+		event("bike", old, "Ride"),
+	)
+	cur := calendar(
+		event("swim", now, "Masters Swim"),
+		event("run", now, "Track & Run"),
+		event("brick", now, "Brick"),
+	)
+
+	out, changed, err := minimalUpdate([]byte(prev), []byte(cur))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The swim is unchanged so it keeps the old DTSTAMP, the run changed, the
+	// brick is new, and the ride is gone
+	want := calendar(
+		event("swim", old, "Masters Swim"),
+		event("run", now, "Track & Run"),
+		event("brick", now, "Brick"),
+	)
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+	if changed != 2 {
+		t.Errorf("got %d changed events, want 2", changed)
+	}
+}
+
+func TestMinimalUpdateLF(t *testing.T) {
+	// A file written before the line endings were CRLF
+	prev := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:swim\nDTSTAMP:20260301T000000Z\nEND:VEVENT\nEND:VCALENDAR\n"
+	cur := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:swim\r\nDTSTAMP:20260308T000000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+	out, changed, err := minimalUpdate([]byte(prev), []byte(cur))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := strings.Replace(prev, "\n", "\r\n", -1); string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if changed != 0 {
+		t.Errorf("got %d changed events, want 0", changed)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModelConfidence is how sure the model must be of a type before it is used
+// instead of DefaultType.
+const ModelConfidence = 0.6
+
+// modelToken matches the words that the model learns from.
+var modelToken = regexp.MustCompile(`[a-z0-9]+`)
+
+// TypeModel is a naive Bayes classifier that learns the types of workouts
+// from the corrections made with `classify review`. It is only used for
+// workouts that the type rules don't match, corrections themselves always
+// win over the rules.
+type TypeModel struct {
+	// Examples are the corrected types, keyed by the normalized summary
+	Examples map[string]string `json:"examples"`
+
+	// words counts each word per type, totals the words per type, and docs
+	// the examples per type
+	words  map[string]map[string]int
+	totals map[string]int
+	docs   map[string]int
+	vocab  map[string]bool
+}
+
+// modelKey normalizes a summary for the model.
+func modelKey(summary string) string {
+	return strings.Join(modelToken.FindAllString(strings.ToLower(summary), -1), " ")
+}
+
+// loadModel reads the model from fname, an empty model if it doesn't exist
+// yet.
+func loadModel(fname string) (*TypeModel, error) {
+	m := &TypeModel{Examples: map[string]string{}}
+
+	b, err := os.ReadFile(fname)
+	if err == nil {
+		if err := json.Unmarshal(b, m); err != nil {
+			return nil, fmt.Errorf("unable to parse model %s: %v", fname, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if m.Examples == nil {
+		m.Examples = map[string]string{}
+	}
+
+	m.train()
+
+	return m, nil
+}
+
+// save writes the model to fname.
+func (m *TypeModel) save(fname string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(fname, append(b, '\n'), 0644)
+}
+
+// train counts the words of the examples.
+func (m *TypeModel) train() {
+	m.words = map[string]map[string]int{}
+	m.totals = map[string]int{}
+	m.docs = map[string]int{}
+	m.vocab = map[string]bool{}
+
+	for key, typ := range m.Examples {
+		if m.words[typ] == nil {
+			m.words[typ] = map[string]int{}
+		}
+
+		m.docs[typ]++
+		for _, word := range strings.Fields(key) {
+			m.words[typ][word]++
+			m.totals[typ]++
+			m.vocab[word] = true
+		}
+	}
+}
+
+// label records the type of the summary.
+func (m *TypeModel) label(summary, typ string) {
+	m.Examples[modelKey(summary)] = typ
+	m.train()
+}
+
+// corrected returns the type the summary was corrected to, if it was.
+func (m *TypeModel) corrected(summary string) (string, bool) {
+	typ, ok := m.Examples[modelKey(summary)]
+	return typ, ok
+}
+
+// predict returns the most likely type of the summary and its probability.
+// Returns "" if the model hasn't learned anything yet.
+func (m *TypeModel) predict(summary string) (string, float64) {
+	if len(m.docs) == 0 {
+		return "", 0
+	}
+
+	var types []string
+	for typ := range m.docs {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	// Log probabilities with add-one smoothing
+	words := strings.Fields(modelKey(summary))
+	scores := make([]float64, len(types))
+	for i, typ := range types {
+		scores[i] = math.Log(float64(m.docs[typ]) / float64(len(m.Examples)))
+		for _, word := range words {
+			scores[i] += math.Log(float64(m.words[typ][word]+1) / float64(m.totals[typ]+len(m.vocab)))
+		}
+	}
+
+	best := 0
+	for i := range scores {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s - scores[best])
+	}
+
+	return types[best], 1 / sum
+}
+
+// classifyWorkout returns the type of the summary and where it came from:
+// "corrected" for corrections, "rule" for the type rules, and "model" for
+// the model's guess.
+func (c *Config) classifyWorkout(summary string) (string, string) {
+	if c.model != nil {
+		if typ, ok := c.model.corrected(summary); ok {
+			return typ, "corrected"
+		}
+	}
+
+	typ := classify(c.Types, summary)
+	if typ != DefaultType || c.model == nil {
+		return typ, "rule"
+	}
+
+	if guess, p := c.model.predict(summary); guess != "" && p >= ModelConfidence {
+		return guess, "model"
+	}
+
+	return typ, "rule"
+}
+
+// review asks about the type of each workout that the type rules didn't
+// classify, recording the answers in the model. Returns the number of
+// corrections.
+func (c *Config) review(r io.Reader, w io.Writer, workouts []*Workout) int {
+	known := map[string]bool{DefaultType: true}
+	var names []string
+	for _, rule := range c.Types {
+		if !known[rule.Type] {
+			names = append(names, rule.Type)
+		}
+		known[rule.Type] = true
+	}
+	names = append(names, DefaultType)
+
+	seen := map[string]bool{}
+	var pending []*Workout
+	for _, wo := range workouts {
+		key := modelKey(wo.Summary)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if typ, source := c.classifyWorkout(wo.Summary); source == "model" || typ == DefaultType && source == "rule" {
+			pending = append(pending, wo)
+		}
+	}
+
+	if len(pending) == 0 {
+		fmt.Fprintln(w, "nothing to review, every workout matches a type rule or a correction")
+		return 0
+	}
+
+	fmt.Fprintf(w, "types: %s\n", strings.Join(names, ", "))
+	fmt.Fprintln(w, "enter a type, nothing to accept the suggestion, or - to skip")
+
+	scanner := bufio.NewScanner(r)
+	labeled := 0
+
+	for _, wo := range pending {
+		typ, _ := c.classifyWorkout(wo.Summary)
+
+		for {
+			fmt.Fprintf(w, "%s [%s]: ", wo.Summary, typ)
+			if !scanner.Scan() {
+				fmt.Fprintln(w)
+				return labeled
+			}
+
+			answer := strings.TrimSpace(scanner.Text())
+			if answer == "-" {
+				break
+			}
+			if answer == "" {
+				answer = typ
+			}
+
+			if !known[answer] {
+				fmt.Fprintf(w, "unknown type: %s\n", answer)
+				continue
+			}
+
+			c.model.label(wo.Summary, answer)
+			labeled++
+			break
+		}
+	}
+
+	return labeled
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Events that notifiers can subscribe to.
+const (
+	// NotifyChanges is sent when a run changes the published calendar
+	NotifyChanges = "changes"
+
+	// NotifyErrors is sent when a run, or some of its targets, failed
+	NotifyErrors = "errors"
+
+	// NotifyDigest is sent once a day, at digest_at, with the next day's
+	// workouts
+	NotifyDigest = "digest"
+)
+
+// DiscordMaxLength is the longest message Discord accepts.
+const DiscordMaxLength = 2000
+
+// Notification is a message about a run.
+type Notification struct {
+	Event string `json:"event"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+
+	// Changes are the changes to the calendar, for NotifyChanges
+	Changes []EventChange `json:"changes,omitempty"`
+}
+
+// Notifier sends notifications somewhere people will see them.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NotifierConfig configures a single notifier in the notifications section of
+// the config.
+type NotifierConfig struct {
+	// Type is slack, discord, ntfy, webhook, or email
+	Type string `json:"type"`
+
+	// Events are the events to notify about, defaults to changes and
+	// errors
+	Events []string `json:"events"`
+
+	// QuietHours, e.g. 21:00-07:00 in the club's timezone, holds the
+	// notifications until they are over and then sends them as one
+	QuietHours string `json:"quiet_hours"`
+
+	// DigestAt is when the digest is sent, e.g. 19:00, defaults to
+	// DefaultDigestAt
+	DigestAt string `json:"digest_at"`
+
+	// URL is the incoming webhook for slack, discord, and webhook, or the
+	// topic URL for ntfy
+	URL string `json:"url"`
+
+	// SMTP is the host:port of the mail server for email, From and To the
+	// addresses. Username and Password are optional.
+	SMTP     string   `json:"smtp"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+}
+
+// notifier is a Notifier along with the events it wants.
+type notifier struct {
+	Notifier
+
+	name   string
+	events map[string]bool
+
+	// key identifies the notifier in the -state, see HeldNotification
+	key string
+
+	// quiet are the quiet hours, nil if there are none
+	quiet *quietHours
+
+	// digestAt is the minute of the day that the digest is sent at
+	digestAt int
+}
+
+// notifiers are the configured notifiers, see notify.
+var notifiers []notifier
+
+// newNotifiers creates the notifiers from the config.
+func newNotifiers(configs []NotifierConfig, client *http.Client) ([]notifier, error) {
+	var res []notifier
+
+	for i, c := range configs {
+		n := notifier{name: c.Type, events: map[string]bool{}, key: fmt.Sprintf("%d:%s", i, c.Type)}
+
+		if len(c.Events) == 0 {
+			c.Events = []string{NotifyChanges, NotifyErrors}
+		}
+
+		for _, e := range c.Events {
+			if e != NotifyChanges && e != NotifyErrors && e != NotifyDigest {
+				return nil, fmt.Errorf("notification %d: invalid event: `%s`", i, e)
+			}
+			n.events[e] = true
+		}
+
+		if c.QuietHours != "" {
+			q, err := parseQuietHours(c.QuietHours)
+			if err != nil {
+				return nil, fmt.Errorf("notification %d: %v", i, err)
+			}
+			n.quiet = q
+		}
+
+		if c.DigestAt == "" {
+			c.DigestAt = DefaultDigestAt
+		}
+
+		at, err := parseClock(c.DigestAt)
+		if err != nil {
+			return nil, fmt.Errorf("notification %d: invalid digest_at, must be HH:MM: `%s`", i, c.DigestAt)
+		}
+		n.digestAt = at
+
+		switch c.Type {
+		case "slack", "discord", "ntfy", "webhook":
+			if c.URL == "" {
+				return nil, fmt.Errorf("notification %d: %s requires url", i, c.Type)
+			}
+			n.Notifier = &httpNotifier{kind: c.Type, url: c.URL, client: client}
+		case "email":
+			if c.SMTP == "" || c.From == "" || len(c.To) == 0 {
+				return nil, fmt.Errorf("notification %d: email requires smtp, from, and to", i)
+			}
+			n.Notifier = &emailNotifier{config: c}
+		default:
+			return nil, fmt.Errorf("notification %d: invalid type: `%s`", i, c.Type)
+		}
+
+		res = append(res, n)
+	}
+
+	return res, nil
+}
+
+// notify sends the notification to every notifier that wants it, unless it
+// is in its quiet hours, see hold. Failures are logged, they shouldn't fail
+// the run.
+func notify(n Notification) {
+	now := time.Now()
+
+	for _, t := range notifiers {
+		if !t.events[n.Event] {
+			continue
+		}
+
+		if t.quiet.contains(now) {
+			hold(t, n, now)
+			continue
+		}
+
+		if err := t.Notify(n); err != nil {
+			warnf("unable to notify %s: %v", t.name, err)
+		}
+	}
+}
+
+// flagNotifiers returns the notifiers for the -slack-webhook and
+// -discord-webhook flags, which only notify about changes.
+func flagNotifiers(slack, discord string) []NotifierConfig {
+	var res []NotifierConfig
+
+	if slack != "" {
+		res = append(res, NotifierConfig{Type: "slack", URL: slack, Events: []string{NotifyChanges}})
+	}
+	if discord != "" {
+		res = append(res, NotifierConfig{Type: "discord", URL: discord, Events: []string{NotifyChanges}})
+	}
+
+	return res
+}
+
+// changesNotification describes the changes to the calendar.
+func changesNotification(locale string, changes []EventChange) Notification {
+	return Notification{
+		Event:   NotifyChanges,
+		Title:   translate(locale, "Workout schedule changed"),
+		Body:    changesText(locale, changes),
+		Changes: changes,
+	}
+}
+
+// changesText describes the changes for people rather than diff, one line
+// per workout that is new, cancelled, moved, or changed. A workout that was
+// removed and added again with the same summary counts as moved, as
+// rescheduling changes the UID.
+func changesText(locale string, changes []EventChange) string {
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	when := func(v string) string {
+		t, err := time.Parse(ICalTimeFormat, v)
+		if err != nil {
+			return v
+		}
+		return formatDate(locale, "Mon Jan 2 3:04 PM", t.In(loc))
+	}
+
+	removed := map[string][]EventChange{}
+	for _, c := range changes {
+		if c.Kind == Removed {
+			removed[c.Summary] = append(removed[c.Summary], c)
+		}
+	}
+
+	var lines []string
+	moved := map[string]bool{}
+
+	// Signup links go on their own line so chat apps make them clickable
+	signup := func(c EventChange) {
+		if c.URL != "" {
+			lines = append(lines, "  "+translate(locale, "Sign up")+": "+c.URL)
+		}
+	}
+
+	for _, c := range changes {
+		switch c.Kind {
+		case Added:
+			if prev := removed[c.Summary]; len(prev) > 0 {
+				removed[c.Summary] = prev[1:]
+				moved[prev[0].UID] = true
+				lines = append(lines, fmt.Sprintf(translate(locale, "Moved: %s from %s to %s"), c.Summary, when(prev[0].Start), when(c.Start)))
+				signup(c)
+				continue
+			}
+			lines = append(lines, fmt.Sprintf(translate(locale, "New: %s %s"), when(c.Start), c.Summary))
+			signup(c)
+		case Changed:
+			var fields []string
+			for _, f := range c.Fields {
+				if f.Name != "SEQUENCE" {
+					fields = append(fields, strings.ToLower(f.Name))
+				}
+			}
+			lines = append(lines, fmt.Sprintf(translate(locale, "Changed: %s %s (%s)"), when(c.Start), c.Summary, strings.Join(fields, ", ")))
+			signup(c)
+		}
+	}
+
+	// Cancelled workouts are listed last
+	for _, c := range changes {
+		if c.Kind == Removed && !moved[c.UID] {
+			lines = append(lines, fmt.Sprintf(translate(locale, "Cancelled: %s %s"), when(c.Start), c.Summary))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// errorNotification describes a failed run.
+func errorNotification(err error) Notification {
+	return Notification{
+		Event: NotifyErrors,
+		Title: "tvtccal failed",
+		Body:  err.Error(),
+	}
+}
+
+// httpNotifier posts notifications to a chat service's incoming webhook, an
+// ntfy topic, or, for webhook, any URL as JSON.
+type httpNotifier struct {
+	kind   string
+	url    string
+	client *http.Client
+}
+
+func (t *httpNotifier) Notify(n Notification) error {
+	var body []byte
+	var err error
+
+	contentType := "application/json"
+
+	switch t.kind {
+	case "slack":
+		body, err = json.Marshal(map[string]string{"text": "*" + n.Title + "*\n" + n.Body})
+	case "discord":
+		msg := []rune("**" + n.Title + "**\n" + n.Body)
+		if len(msg) > DiscordMaxLength {
+			msg = append(msg[:DiscordMaxLength-3], []rune("...")...)
+		}
+		body, err = json.Marshal(map[string]string{"content": string(msg)})
+	case "ntfy":
+		body, contentType = []byte(n.Body), "text/plain"
+	default:
+		body, err = json.Marshal(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if t.kind == "ntfy" {
+		req.Header.Set("Title", n.Title)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status code: %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+
+	return nil
+}
+
+// emailNotifier mails notifications through an SMTP server.
+type emailNotifier struct {
+	config NotifierConfig
+}
+
+func (t *emailNotifier) Notify(n Notification) error {
+	c := t.config
+
+	if strings.ContainsAny(c.From+strings.Join(c.To, "")+n.Title, "\r\n") {
+		return errors.New("invalid header in email")
+	}
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		host := c.SMTP
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", c.Username, c.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", n.Title)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(n.Body, "\n", "\r\n", -1))
+	msg.WriteString("\r\n")
+
+	return smtp.SendMail(c.SMTP, auth, c.From, c.To, msg.Bytes())
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestChangesText(t *testing.T) {
+	changes := []EventChange{
+		{Kind: Removed, UID: "swim-1", Summary: "Masters Swim", Start: "20261012T130000Z"},
+		{Kind: Added, UID: "swim-2", Summary: "Masters Swim", Start: "20261013T130000Z", URL: "https://example.com/swim"},
+		{Kind: Added, UID: "run-1", Summary: "Track Run", Start: "20261014T010000Z"},
+		{Kind: Changed, UID: "ride-1", Summary: "Group Ride", Start: "20261017T150000Z", Fields: []FieldChange{{Name: "LOCATION"}, {Name: "SEQUENCE"}}},
+		{Kind: Removed, UID: "brick-1", Summary: "Brick", Start: "20261018T150000Z"},
+	}
+
+	for _, tc := range []struct {
+		locale, title, body string
+	}{
+		{
+			"", "Workout schedule changed",
+			"Moved: Masters Swim from Mon Oct 12 6:00 AM to Tue Oct 13 6:00 AM\n" +
+				"  Sign up: https://example.com/swim\n" +
+				"New: Tue Oct 13 6:00 PM Track Run\n" +
+				"Changed: Sat Oct 17 8:00 AM Group Ride (location)\n" +
+				"Cancelled: Sun Oct 18 8:00 AM Brick",
+		},
+		{
+			"es", "Cambios en el calendario de entrenamientos",
+			"Movido: Masters Swim del lun 12 oct 06:00 al mar 13 oct 06:00\n" +
+				"  Inscribirse: https://example.com/swim\n" +
+				"Nuevo: mar 13 oct 18:00 Track Run\n" +
+				"Modificado: sáb 17 oct 08:00 Group Ride (location)\n" +
+				"Cancelado: dom 18 oct 08:00 Brick",
+		},
+	} {
+		n := changesNotification(tc.locale, changes)
+		if n.Title != tc.title {
+			t.Errorf("%q: got title %q, want %q", tc.locale, n.Title, tc.title)
+		}
+		if n.Body != tc.body {
+			t.Errorf("%q: got:\n%s\nwant:\n%s", tc.locale, n.Body, tc.body)
+		}
+	}
+}
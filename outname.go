@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// outNameData is what templated -out names are executed against.
+type outNameData struct {
+	// Year and Month of the calendar page, or the current date if the
+	// calendar isn't from a page
+	Year  int
+	Month time.Month
+
+	// Fixture is the name of the -test fixture, with -per-fixture
+	Fixture string
+}
+
+// isOutTemplate reports whether the -out name is a template.
+func isOutTemplate(name string) bool {
+	return strings.Contains(name, "{{")
+}
+
+// expandOutName executes the -out name as a template, e.g.
+// tvtc-{{.Year}}-{{printf "%02d" .Month}}.ics. Names that aren't templates
+// are returned as is.
+func expandOutName(name string, cal *Calendar, fixture string) (string, error) {
+	if !isOutTemplate(name) {
+		return name, nil
+	}
+
+	year, month := cal.Year, cal.Month
+	if year == 0 || month == 0 {
+		now := time.Now()
+		year, month = now.Year(), now.Month()
+	}
+
+	tmpl, err := template.New("out").Funcs(template.FuncMap{
+		"now": time.Now,
+	}).Parse(name)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, outNameData{
+		Year:    year,
+		Month:   month,
+		Fixture: fixture,
+	})
+	return buf.String(), err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcrussell/tvtccal/tvtccal"
+)
+
+// octoberPage is a calendar page for October 2026 whose first week starts on
+// Sunday, September 27.
+const octoberPage = `<html><body><div id="main"><table><caption>October 2026</caption>
+<tr><td>Sun 27</td><td>Mon 28</td><td>Tue 29</td><td>Wed 30</td><td>Thu 1</td></tr>
+<tr><td>
+Masters Swim
+
+Pool
+
+Dublin
+
+CA
+
+6:00 AM
+</td><td></td><td></td><td></td><td>
+Track Run
+
+Track
+
+Dublin
+
+CA
+
+6:00 PM
+</td></tr>
+</table></div></body></html>`
+
+// TestExpandOutNamePage checks that templated -out names get the month of the
+// page, not of the first workout, from the parsed caption or the overrides.
+func TestExpandOutNamePage(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "october.html")
+	if err := os.WriteFile(fname, []byte(octoberPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved string) { *testFile = saved }(*testFile)
+	*testFile = fname
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		opts tvtccal.ParseOptions
+		want string
+	}{
+		{tvtccal.ParseOptions{Year: 2026}, "tvtc-2026-10-October.ics"},
+		{tvtccal.ParseOptions{Year: 2027, Month: time.October}, "tvtc-2027-10-October.ics"},
+	} {
+		groups, mtimes, months, err := fetchGroups([]fixture{{fname: fname, opts: tc.opts}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cals, err := buildCalendars(config, groups, mtimes, months)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w := cals[0].Workouts; len(w) == 0 || w[0].Start.Month() != time.September {
+			t.Fatalf("got %d workouts, want the first in September", len(w))
+		}
+
+		got, err := expandOutName(`tvtc-{{.Year}}-{{printf "%02d" .Month}}-{{.Month}}.ics`, cals[0], "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.opts, got, tc.want)
+		}
+	}
+
+	if got, _ := expandOutName("tvtc.ics", &Calendar{}, ""); got != "tvtc.ics" {
+		t.Errorf("got %s for a name that isn't a template", got)
+	}
+}
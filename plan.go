@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jcrussell/tvtccal/tvtccal"
+)
+
+// PlanCategory is the CATEGORIES of the events from the -plan, along with
+// their type.
+const PlanCategory = "Planned"
+
+// planColumns are the columns of a -plan file, date, start, and summary are
+// required.
+var planColumns = []string{"date", "start", "end", "duration", "summary", "location", "description", "type"}
+
+// loadPlan reads the season plan from fname, a CSV file with a header row
+// naming its columns, see planColumns. Dates are YYYY-MM-DD and times are
+// 24-hour HH:MM in the club's timezone. Workouts without an end or duration
+// get the default duration, or the one from -durations. The type is optional,
+// planned workouts without one are classified like the rest.
+func loadPlan(fname string) ([]*Workout, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to read header: %v", fname, err)
+	}
+
+	cols := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		known := false
+		for _, c := range planColumns {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: unknown column, must be one of %s: `%s`", fname, strings.Join(planColumns, ", "), name)
+		}
+
+		cols[name] = i
+	}
+
+	for _, name := range []string{"date", "start", "summary"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("%s: missing %s column", fname, name)
+		}
+	}
+
+	var workouts []*Workout
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", fname, err)
+		}
+
+		line, _ := r.FieldPos(0)
+
+		get := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		w, err := planWorkout(get, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fname, line, err)
+		}
+
+		if w != nil {
+			workouts = append(workouts, w)
+		}
+	}
+
+	return workouts, nil
+}
+
+// planWorkout creates the workout for a row of the plan, nil if the row is
+// blank.
+func planWorkout(get func(string) string, loc *time.Location) (*Workout, error) {
+	if get("date") == "" && get("summary") == "" {
+		return nil, nil
+	}
+
+	if get("summary") == "" {
+		return nil, fmt.Errorf("missing summary")
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", get("date")+" "+get("start"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date or start, must be YYYY-MM-DD and HH:MM: `%s %s`", get("date"), get("start"))
+	}
+
+	w := &Workout{
+		Summary:     get("summary"),
+		Location:    get("location"),
+		Description: get("description"),
+		Start:       start,
+		End:         start.Add(tvtccal.DefaultDuration),
+		Type:        get("type"),
+		Planned:     true,
+	}
+
+	switch {
+	case get("end") != "":
+		end, err := time.ParseInLocation("2006-01-02 15:04", get("date")+" "+get("end"), loc)
+		if err != nil || !end.After(start) {
+			return nil, fmt.Errorf("invalid end, must be HH:MM after the start: `%s`", get("end"))
+		}
+
+		w.End = end
+		w.HasDuration = true
+	case get("duration") != "":
+		d, err := time.ParseDuration(get("duration"))
+		if err != nil || d < tvtccal.MinDuration || d > tvtccal.MaxDuration {
+			return nil, fmt.Errorf("invalid duration, must be between %v and %v: `%s`", tvtccal.MinDuration, tvtccal.MaxDuration, get("duration"))
+		}
+
+		w.End = start.Add(d)
+		w.HasDuration = true
+	}
+
+	return w, nil
+}
+
+// mergePlan adds the planned workouts to the ones from the club's site, in
+// order of their start. Planned workouts that are also on the site, with the
+// same summary on the same day, are reconciled with it into a single workout,
+// see reconcile.
+func mergePlan(workouts, plan []*Workout, precedence map[string][]string) []*Workout {
+	type key struct {
+		y       int
+		m       time.Month
+		d       int
+		summary string
+	}
+
+	keyOf := func(w *Workout) key {
+		y, m, d := w.Start.Date()
+		return key{y, m, d, sessionKey(w)}
+	}
+
+	// Index of the workout from the site with each key
+	index := map[key]int{}
+	for i := len(workouts) - 1; i >= 0; i-- {
+		index[keyOf(workouts[i])] = i
+	}
+
+	res := append([]*Workout{}, workouts...)
+	added, merged := 0, 0
+
+	for _, w := range plan {
+		i, ok := index[keyOf(w)]
+		if !ok {
+			res = append(res, w)
+			added++
+			continue
+		}
+
+		// Only the first planned version is merged
+		delete(index, keyOf(w))
+
+		res[i] = reconcile(map[string]*Workout{OriginSite: res[i], OriginPlan: w}, precedence)
+		res[i].Planned = false
+		merged++
+	}
+
+	log.Printf("added %d workouts from the plan and merged %d with the site", added, merged)
+
+	// Outputs such as markdown expect the workouts in order
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Start.Before(res[j].Start)
+	})
+
+	return res
+}
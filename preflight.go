@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+// preflight renders the calendar as iCalendar and checks it before anything
+// is published, so that a broken template doesn't reach every subscriber.
+// The output must pass lintICS without errors and contain an event for every
+// workout. Problems are logged, the error summarizes them.
+func preflight(cal *Calendar, templates *Templates) error {
+	out, err := templates.render(cal, FormatICal)
+	if err != nil {
+		return fmt.Errorf("preflight: %v", err)
+	}
+
+	var problems []Problem
+	for _, p := range lintICS(out) {
+		if p.Severity == Error {
+			problems = append(problems, p)
+		}
+	}
+
+	if roots, err := parseICS(bytes.NewReader(out)); err == nil && len(roots) > 0 {
+		if n := len(roots[0].Sub("VEVENT")); n != len(cal.Workouts) {
+			problems = append(problems, Problem{
+				Severity: Error,
+				Message:  fmt.Sprintf("calendar has %d events but there are %d workouts", n, len(cal.Workouts)),
+			})
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, p := range problems {
+		log.Printf("preflight: %v", p)
+	}
+
+	return fmt.Errorf("preflight: output has %d errors, not publishing", len(problems))
+}
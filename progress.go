@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// ProgressInterval is how often the progress of a long operation is logged.
+const ProgressInterval = 5 * time.Second
+
+// progress logs how far a long operation got, e.g. "fetched 3 of 24 pages",
+// so that fetching many months or pushing hundreds of events doesn't look
+// hung. It logs at most every ProgressInterval, and once more when the
+// operation is done if it logged before.
+type progress struct {
+	verb, noun  string
+	done, total int
+
+	// last is when the progress was last logged, or when it started
+	last   time.Time
+	logged bool
+}
+
+// newProgress starts an operation of total steps at now.
+func newProgress(verb, noun string, total int, now time.Time) *progress {
+	return &progress{verb: verb, noun: noun, total: total, last: now}
+}
+
+// step records that one more step was done at now.
+func (p *progress) step(now time.Time) {
+	p.done++
+
+	if p.done == p.total && !p.logged || p.done < p.total && now.Sub(p.last) < ProgressInterval {
+		return
+	}
+
+	log.Printf("%s %d of %d %s", p.verb, p.done, p.total, p.noun)
+	p.last = now
+	p.logged = true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	start := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	// Quick operations don't log their progress at all
+	p := newProgress("fetched", "pages", 3, start)
+	for i := 0; i < 3; i++ {
+		p.step(start.Add(time.Duration(i) * time.Second))
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %q for a quick operation", buf.String())
+	}
+
+	p = newProgress("pushed", "events", 4, start)
+	for _, sec := range []int{1, 6, 8, 9} {
+		p.step(start.Add(time.Duration(sec) * time.Second))
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		got = append(got, line[strings.Index(line, "pushed"):])
+	}
+
+	want := []string{"pushed 2 of 4 events", "pushed 4 of 4 events"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
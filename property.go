@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Property is an extra property injected into the output.
+type Property struct {
+	Name  string
+	Value string
+}
+
+// xPropName matches valid experimental property names, see RFC 5545 Sec 3.8.8.2
+var xPropName = regexp.MustCompile(`^X-[A-Za-z0-9-]+$`)
+
+// PropertyTemplate is a property whose value is a template executed against
+// a single workout.
+type PropertyTemplate struct {
+	Name string
+
+	tmpl *template.Template
+}
+
+// compileProperties validates the property names and parses the values as
+// templates, with templateFuncs. The results are sorted by name so that the
+// output is stable.
+func compileProperties(props map[string]string) ([]PropertyTemplate, error) {
+	var res []PropertyTemplate
+
+	for name, val := range props {
+		name = strings.ToUpper(name)
+		if !xPropName.MatchString(name) {
+			return nil, fmt.Errorf("invalid property name, must start with X-: `%s`", name)
+		}
+
+		tmpl, err := template.New(name).Funcs(templateFuncs).Parse(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %v", name, err)
+		}
+
+		res = append(res, PropertyTemplate{Name: name, tmpl: tmpl})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res, nil
+}
+
+// expandProperties executes each property template with data. Properties that
+// expand to an empty value are omitted.
+func expandProperties(props []PropertyTemplate, data interface{}) ([]Property, error) {
+	var res []Property
+
+	for _, p := range props {
+		var buf bytes.Buffer
+		if err := p.tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("unable to expand %s: %v", p.Name, err)
+		}
+
+		// Newlines are not allowed in content lines
+		val := strings.Replace(strings.TrimSpace(buf.String()), "\n", `\n`, -1)
+		if val != "" {
+			res = append(res, Property{Name: p.Name, Value: val})
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// Minimal QR code encoder, enough for subscription URLs on the landing page.
+// Only byte mode and error correction level M are supported, with versions 1
+// to 10 (up to 213 bytes). See ISO/IEC 18004.
+
+// qrVersion describes the error correction blocks of a version at level M.
+type qrVersion struct {
+	// ecLen is the number of error correction codewords per block
+	ecLen int
+	// blocks is the number of data codewords in each block
+	blocks []int
+	// align are the centers of the alignment patterns
+	align []int
+}
+
+var qrVersions = []qrVersion{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+// dataLen is the total number of data codewords.
+func (v qrVersion) dataLen() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// qrCode is the module matrix, true is dark.
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+
+	// mask is the mask pattern applied to the data modules
+	mask int
+}
+
+// encodeQR encodes data as a QR code using the smallest version that fits.
+func encodeQR(data []byte) (*qrCode, error) {
+	ver := 0
+	for v := 1; v < len(qrVersions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+
+		if 4+countBits+8*len(data) <= 8*qrVersions[v].dataLen() {
+			ver = v
+			break
+		}
+	}
+
+	if ver == 0 {
+		return nil, errors.New("data too long for QR code")
+	}
+
+	codewords := qrCodewords(data, ver)
+
+	size := 17 + 4*ver
+	q := &qrCode{size: size}
+	for i := 0; i < size; i++ {
+		q.modules = append(q.modules, make([]bool, size))
+		q.function = append(q.function, make([]bool, size))
+	}
+
+	q.drawFunctionPatterns(ver)
+	q.drawCodewords(codewords)
+
+	// Pick the mask with the lowest penalty
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // undo, masks are XOR
+	}
+
+	q.applyMask(best)
+	q.drawFormat(best)
+	q.mask = best
+
+	return q, nil
+}
+
+// qrCodewords encodes the data in byte mode, adds error correction, and
+// interleaves the blocks.
+func qrCodewords(data []byte, ver int) []byte {
+	v := qrVersions[ver]
+
+	var bits []bool
+	appendBits := func(val, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (val>>uint(i))&1 == 1)
+		}
+	}
+
+	countBits := 8
+	if ver >= 10 {
+		countBits = 16
+	}
+
+	appendBits(0x4, 4) // byte mode
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	// Terminator and padding to a byte boundary
+	capacity := v.dataLen() * 8
+	for i := 0; i < 4 && len(bits) < capacity; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	var buf []byte
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << uint(7-j)
+			}
+		}
+		buf = append(buf, b)
+	}
+
+	for pad := byte(0xEC); len(buf) < v.dataLen(); pad ^= 0xEC ^ 0x11 {
+		buf = append(buf, pad)
+	}
+
+	// Split into blocks and compute the error correction for each
+	var blocks, ecBlocks [][]byte
+	for _, n := range v.blocks {
+		blocks = append(blocks, buf[:n])
+		ecBlocks = append(ecBlocks, reedSolomon(buf[:n], v.ecLen))
+		buf = buf[n:]
+	}
+
+	var res []byte
+	for i := 0; i < v.blocks[len(v.blocks)-1]; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				res = append(res, b[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecLen; i++ {
+		for _, b := range ecBlocks {
+			res = append(res, b[i])
+		}
+	}
+
+	return res
+}
+
+// gfMul multiplies in GF(2^8) with the QR primitive polynomial 0x11D.
+func gfMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		carry := z&0x80 != 0
+		z <<= 1
+		if carry {
+			z ^= 0x1D
+		}
+		if (y>>uint(i))&1 == 1 {
+			z ^= x
+		}
+	}
+	return z
+}
+
+// reedSolomon computes n error correction codewords for data.
+func reedSolomon(data []byte, n int) []byte {
+	// Generator polynomial, product of (x - 2^i) for i in [0, n), with the
+	// leading coefficient omitted
+	gen := make([]byte, n)
+	gen[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			gen[j] = gfMul(gen[j], root)
+			if j+1 < n {
+				gen[j] ^= gen[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+
+	res := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ res[0]
+		copy(res, res[1:])
+		res[n-1] = 0
+		for i := range res {
+			res[i] ^= gfMul(gen[i], factor)
+		}
+	}
+
+	return res
+}
+
+// set sets a function module, x is the column and y the row.
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrCode) drawFunctionPatterns(ver int) {
+	// Timing patterns
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns, with separators
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || x >= q.size || y < 0 || y >= q.size {
+					continue
+				}
+
+				d := chebyshev(dx, dy)
+				q.set(x, y, d != 2 && d != 4)
+			}
+		}
+	}
+
+	// Alignment patterns, except where they overlap the finders
+	align := qrVersions[ver].align
+	for i, cx := range align {
+		for j, cy := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == len(align)-1) || (i == len(align)-1 && j == 0) {
+				continue
+			}
+
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(cx+dx, cy+dy, chebyshev(dx, dy) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas, drawn for real once the mask is picked
+	q.drawFormat(0)
+
+	// Version information
+	if ver >= 7 {
+		rem := ver
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := ver<<12 | rem
+
+		for i := 0; i < 18; i++ {
+			dark := (bits>>uint(i))&1 == 1
+			a, b := q.size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format information for level M and the
+// given mask.
+func (q *qrCode) drawFormat(mask int) {
+	data := 0<<3 | mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	bit := func(i int) bool {
+		return (bits>>uint(i))&1 == 1
+	}
+
+	// First copy, around the top left finder
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+
+	// Second copy, split between the other two finders
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true) // always dark
+}
+
+// drawCodewords places the codewords in the zigzag pattern.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>uint(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask XORs the mask pattern with the data modules.
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol for mask selection using the run, block, and
+// balance rules. The finder-like pattern rule is omitted, it only affects which
+// mask is picked and not whether the code can be read.
+func (q *qrCode) penalty() int {
+	p := 0
+
+	// Runs of five or more modules of the same color in rows and columns
+	for y := 0; y < q.size; y++ {
+		for _, row := range []bool{true, false} {
+			run := 0
+			for x := 0; x < q.size; x++ {
+				cur, prev := q.at(x, y, row), x > 0 && q.at(x-1, y, row)
+				if x > 0 && cur == prev {
+					run++
+				} else {
+					run = 1
+				}
+
+				if run == 5 {
+					p += 3
+				} else if run > 5 {
+					p++
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					p += 3
+				}
+			}
+		}
+	}
+
+	// Balance of dark and light modules
+	total := q.size * q.size
+	if k := (abs(dark*20-total*10)+total-1)/total - 1; k > 0 {
+		p += k * 10
+	}
+
+	return p
+}
+
+// at returns the module at (x, y) or, if row is false, the transposed module.
+func (q *qrCode) at(x, y int, row bool) bool {
+	if row {
+		return q.modules[y][x]
+	}
+	return q.modules[x][y]
+}
+
+// png renders the code with a four module quiet zone and scale pixels per
+// module.
+func (q *qrCode) png(scale int) ([]byte, error) {
+	n := (q.size + 8) * scale
+	img := image.NewGray(image.Rect(0, 0, n, n))
+
+	for py := 0; py < n; py++ {
+		for px := 0; px < n; px++ {
+			x, y := px/scale-4, py/scale-4
+
+			c := color.Gray{Y: 255}
+			if x >= 0 && x < q.size && y >= 0 && y < q.size && q.modules[y][x] {
+				c = color.Gray{Y: 0}
+			}
+			img.SetGray(px, py, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// chebyshev is the distance from the center of a pattern.
+func chebyshev(dx, dy int) int {
+	if abs(dx) > abs(dy) {
+		return abs(dx)
+	}
+	return abs(dy)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
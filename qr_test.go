@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestQRReference compares the module matrix with the one from a reference
+// encoder, Kazuhiko Arase's QRCode as vendored by qrcode-terminal. Each file
+// in testdata has the data, the version and mask, and the rows, X is dark.
+//
+// The reference scores the masks differently, see penalty, so the matrix is
+// compared with the reference's mask.
+func TestQRReference(t *testing.T) {
+	for _, fname := range []string{
+		// Single block, no version information
+		"testdata/qr-version3.txt",
+		// Blocks of two sizes, version information, and a 16 bit count
+		"testdata/qr-version10.txt",
+	} {
+		b, err := os.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		data, want := lines[0], lines[2:]
+
+		var ver, mask int
+		if _, err := fmt.Sscanf(lines[1], "version %d, mask %d", &ver, &mask); err != nil {
+			t.Fatalf("%s: %v", fname, err)
+		}
+
+		q, err := encodeQR([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", fname, err)
+		}
+
+		if q.size != 17+4*ver {
+			t.Fatalf("%s: got size %d, want version %d", fname, q.size, ver)
+		}
+
+		q.applyMask(q.mask)
+		q.applyMask(mask)
+		q.drawFormat(mask)
+
+		for y, row := range want {
+			var got strings.Builder
+			for x := 0; x < q.size; x++ {
+				if q.modules[y][x] {
+					got.WriteByte('X')
+				} else {
+					got.WriteByte('.')
+				}
+			}
+
+			if got.String() != row {
+				t.Errorf("%s: row %d:\ngot  %s\nwant %s", fname, y, got.String(), row)
+			}
+		}
+	}
+}
+
+// TestReedSolomon checks the error correction of version 1-M for HELLO WORLD,
+// the example in Thonky's QR code tutorial.
+func TestReedSolomon(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := reedSolomon(data, 10); !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestQRTooLong(t *testing.T) {
+	if _, err := encodeQR(bytes.Repeat([]byte("x"), 214)); err == nil {
+		t.Error("got no error for 214 bytes")
+	}
+
+	q, err := encodeQR(bytes.Repeat([]byte("x"), 213))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.size != 57 {
+		t.Errorf("got size %d, want 57 for version 10", q.size)
+	}
+}
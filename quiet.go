@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDigestAt is when the digest is sent if digest_at isn't set.
+const DefaultDigestAt = "18:00"
+
+// quietHours are the minutes of the day, in the club's timezone, during which
+// a notifier isn't sent anything. Start may be after end for quiet hours that
+// span midnight.
+type quietHours struct {
+	start, end int
+}
+
+// HeldNotification is a notification held during quiet hours, kept in the
+// -state until it can be sent.
+type HeldNotification struct {
+	Notifier     string       `json:"notifier"`
+	Time         time.Time    `json:"time"`
+	Notification Notification `json:"notification"`
+}
+
+// held are the notifications held by this run, see State.deliver.
+var held []HeldNotification
+
+// parseClock parses a time of day such as 07:30 into minutes.
+func parseClock(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time: `%s`", s)
+	}
+
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("invalid time: `%s`", s)
+	}
+
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time: `%s`", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// parseQuietHours parses quiet hours such as 21:00-07:00.
+func parseQuietHours(s string) (*quietHours, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid quiet_hours, must be HH:MM-HH:MM: `%s`", s)
+	}
+
+	start, err := parseClock(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet_hours, must be HH:MM-HH:MM: `%s`", s)
+	}
+
+	end, err := parseClock(strings.TrimSpace(parts[1]))
+	if err != nil || end == start {
+		return nil, fmt.Errorf("invalid quiet_hours, must be HH:MM-HH:MM: `%s`", s)
+	}
+
+	return &quietHours{start, end}, nil
+}
+
+// minuteOfDay returns the minute of the day of t in the club's timezone.
+func minuteOfDay(t time.Time) int {
+	if loc, err := time.LoadLocation(Timezone); err == nil {
+		t = t.In(loc)
+	}
+
+	return t.Hour()*60 + t.Minute()
+}
+
+// contains reports whether t is during the quiet hours. Always false if q is
+// nil.
+func (q *quietHours) contains(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+
+	m := minuteOfDay(t)
+	if q.start < q.end {
+		return m >= q.start && m < q.end
+	}
+
+	return m >= q.start || m < q.end
+}
+
+// hold keeps the notification for t until its quiet hours are over.
+func hold(t notifier, n Notification, now time.Time) {
+	log.Printf("quiet hours for %s, holding %q", t.name, n.Title)
+
+	held = append(held, HeldNotification{Notifier: t.key, Time: now, Notification: n})
+}
+
+// checkQuietHours returns an error if any notifier has quiet hours or wants
+// the digest without a -state to remember them in, or while serving.
+func checkQuietHours(serving bool) error {
+	for _, t := range notifiers {
+		if (t.quiet != nil || t.events[NotifyDigest]) && *stateFile == "" {
+			return fmt.Errorf("notification %s: quiet_hours and the digest event require -state", t.key)
+		}
+	}
+
+	if serving {
+		for _, t := range notifiers {
+			if t.quiet != nil || t.events[NotifyDigest] {
+				return fmt.Errorf("notification %s: quiet_hours and the digest event can't be used with serve", t.key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// persistHeld saves the notifications held by a run that failed before it
+// saved its state, so they are still sent after the quiet hours.
+func persistHeld() {
+	if len(held) == 0 || *stateFile == "" || *dryRun {
+		return
+	}
+
+	state, err := loadState(*stateFile)
+	if err != nil {
+		log.Printf("unable to hold notifications: %v", err)
+		return
+	}
+
+	state.Held = append(state.Held, held...)
+	held = nil
+
+	if err := state.save(*stateFile); err != nil {
+		log.Printf("unable to hold notifications: %v", err)
+	}
+}
+
+// deliver sends the notifications held by this and previous runs to the
+// notifiers whose quiet hours are over, combined into one message each, and
+// sends the digest of the next day's workouts once a day after digest_at, in
+// the locale. Noop if the state is nil.
+func (s *State) deliver(locale string, cals []*Calendar, now time.Time) {
+	if s == nil {
+		return
+	}
+
+	pending := append(s.Held, held...)
+	s.Held, held = nil, nil
+
+	if s.Digests == nil {
+		s.Digests = map[string]string{}
+	}
+
+	var workouts []*Workout
+	for _, cal := range cals {
+		workouts = append(workouts, cal.Workouts...)
+	}
+
+	today := now.Format("2006-01-02")
+	if loc, err := time.LoadLocation(Timezone); err == nil {
+		today = now.In(loc).Format("2006-01-02")
+	}
+
+	known := map[string]bool{}
+
+	for _, t := range notifiers {
+		known[t.key] = true
+
+		var mine []HeldNotification
+		for _, h := range pending {
+			if h.Notifier == t.key {
+				mine = append(mine, h)
+			}
+		}
+
+		if t.quiet.contains(now) {
+			s.Held = append(s.Held, mine...)
+			continue
+		}
+
+		if len(mine) > 0 {
+			var ns []Notification
+			for _, h := range mine {
+				ns = append(ns, h.Notification)
+			}
+
+			if err := t.Notify(batchNotifications(locale, ns)); err != nil {
+				warnf("unable to notify %s: %v", t.name, err)
+			}
+		}
+
+		if t.events[NotifyDigest] && minuteOfDay(now) >= t.digestAt && s.Digests[t.key] != today {
+			s.Digests[t.key] = today
+
+			if n, ok := digestNotification(locale, workouts, now); ok {
+				if err := t.Notify(n); err != nil {
+					warnf("unable to notify %s: %v", t.name, err)
+				}
+			}
+		}
+	}
+
+	// Notifications for notifiers that were removed from the config are
+	// dropped
+	for _, h := range pending {
+		if !known[h.Notifier] {
+			log.Printf("dropping notification held for %s: %q", h.Notifier, h.Notification.Title)
+		}
+	}
+}
+
+// batchNotifications combines the notifications into one, with the event of
+// the first.
+func batchNotifications(locale string, ns []Notification) Notification {
+	if len(ns) == 1 {
+		return ns[0]
+	}
+
+	res := Notification{
+		Event: ns[0].Event,
+		Title: fmt.Sprintf(translate(locale, "%d updates during quiet hours"), len(ns)),
+	}
+
+	var parts []string
+	for _, n := range ns {
+		parts = append(parts, n.Title+"\n"+n.Body)
+		res.Changes = append(res.Changes, n.Changes...)
+	}
+	res.Body = strings.Join(parts, "\n\n")
+
+	return res
+}
+
+// digestNotification lists the workouts of the day after now. Returns false
+// if there are none.
+func digestNotification(locale string, workouts []*Workout, now time.Time) (Notification, bool) {
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	tomorrow := now.In(loc).AddDate(0, 0, 1)
+
+	var lines []string
+	for _, w := range workouts {
+		if !sameDay(w.Start.In(loc), tomorrow) {
+			continue
+		}
+
+		line := formatDate(locale, "3:04 PM", w.Start.In(loc)) + " " + w.Summary
+		if w.Location != "" {
+			line += ", " + w.Location
+		}
+		lines = append(lines, line)
+
+		if w.SignupURL != "" {
+			lines = append(lines, "  "+translate(locale, "Sign up")+": "+w.SignupURL)
+		}
+	}
+
+	if len(lines) == 0 {
+		return Notification{}, false
+	}
+
+	return Notification{
+		Event: NotifyDigest,
+		Title: fmt.Sprintf(translate(locale, "Workouts tomorrow, %s"), formatDate(locale, "Mon Jan 2", tomorrow)),
+		Body:  strings.Join(lines, "\n"),
+	}, true
+}
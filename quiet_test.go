@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// recorder is a Notifier that keeps what it was sent.
+type recorder struct {
+	sent []Notification
+}
+
+func (r *recorder) Notify(n Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestParseQuietHours(t *testing.T) {
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(h, m int) time.Time {
+		return time.Date(2026, time.March, 1, h, m, 0, 0, loc)
+	}
+
+	for _, tc := range []struct {
+		quiet string
+		t     time.Time
+		want  bool
+	}{
+		{"21:00-07:00", at(22, 0), true},
+		{"21:00-07:00", at(3, 0), true},
+		{"21:00-07:00", at(7, 0), false},
+		{"21:00-07:00", at(12, 0), false},
+		{"12:00-13:30", at(13, 29), true},
+		{"12:00-13:30", at(11, 59), false},
+		{" 12:00 - 13:30 ", at(12, 0), true},
+	} {
+		q, err := parseQuietHours(tc.quiet)
+		if err != nil {
+			t.Errorf("%s: %v", tc.quiet, err)
+			continue
+		}
+
+		if got := q.contains(tc.t); got != tc.want {
+			t.Errorf("%s: got %v for %s, want %v", tc.quiet, got, tc.t.Format("15:04"), tc.want)
+		}
+	}
+
+	for _, s := range []string{"", "21:00", "21:00-21:00", "24:00-07:00", "21:60-07:00", "9pm-7am"} {
+		if _, err := parseQuietHours(s); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+
+	if (*quietHours)(nil).contains(at(3, 0)) {
+		t.Error("nil quiet hours contain 03:00")
+	}
+}
+
+// TestDeliver checks that notifications held during quiet hours are sent
+// batched once they are over, and that the digest is sent once a day.
+func TestDeliver(t *testing.T) {
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved []notifier) { notifiers = saved }(notifiers)
+
+	r := &recorder{}
+	q, _ := parseQuietHours("21:00-07:00")
+	digestAt, _ := parseClock(DefaultDigestAt)
+	notifiers = []notifier{{
+		Notifier: r,
+		name:     "test",
+		events:   map[string]bool{NotifyChanges: true, NotifyDigest: true},
+		key:      "0:test",
+		quiet:    q,
+		digestAt: digestAt,
+	}}
+
+	start := time.Date(2026, time.March, 3, 5, 30, 0, 0, loc)
+	cals := []*Calendar{{Workouts: []*Workout{{
+		Summary:   "Masters Swim",
+		Location:  "Dublin",
+		Start:     start,
+		End:       start.Add(time.Hour),
+		SignupURL: "https://example.com/signup",
+	}}}}
+
+	s := &State{Held: []HeldNotification{
+		{Notifier: "0:test", Notification: Notification{Event: NotifyChanges, Title: "first", Body: "a"}},
+		{Notifier: "1:removed", Notification: Notification{Event: NotifyChanges, Title: "dropped"}},
+	}}
+	held = []HeldNotification{{Notifier: "0:test", Notification: Notification{Event: NotifyChanges, Title: "second", Body: "b"}}}
+
+	// During the quiet hours everything stays held, except for the removed
+	// notifier's
+	s.deliver("", cals, time.Date(2026, time.March, 1, 23, 0, 0, 0, loc))
+	if len(r.sent) != 0 || len(s.Held) != 2 || len(held) != 0 {
+		t.Fatalf("got %d sent and %d held during quiet hours, want 0 and 2", len(r.sent), len(s.Held))
+	}
+
+	s.deliver("", cals, time.Date(2026, time.March, 2, 8, 0, 0, 0, loc))
+	if len(r.sent) != 1 || len(s.Held) != 0 {
+		t.Fatalf("got %d sent and %d held after quiet hours, want 1 and 0", len(r.sent), len(s.Held))
+	}
+	if n := r.sent[0]; n.Title != "2 updates during quiet hours" || n.Body != "first\na\n\nsecond\nb" {
+		t.Errorf("got batch %q: %q", n.Title, n.Body)
+	}
+
+	// The digest is sent after digest_at, once
+	r.sent = nil
+	s.deliver("", cals, time.Date(2026, time.March, 2, 17, 0, 0, 0, loc))
+	if len(r.sent) != 0 {
+		t.Errorf("got %d sent before digest_at", len(r.sent))
+	}
+
+	for i := 0; i < 2; i++ {
+		s.deliver("", cals, time.Date(2026, time.March, 2, 18, 30, 0, 0, loc))
+	}
+	if len(r.sent) != 1 {
+		t.Fatalf("got %d sent after digest_at, want the digest", len(r.sent))
+	}
+
+	want := Notification{
+		Event: NotifyDigest,
+		Title: "Workouts tomorrow, Tue Mar 3",
+		Body:  "5:30 AM Masters Swim, Dublin\n  Sign up: https://example.com/signup",
+	}
+	if n := r.sent[0]; n.Event != want.Event || n.Title != want.Title || n.Body != want.Body {
+		t.Errorf("got digest %+v, want %+v", n, want)
+	}
+}
+
+func TestDigestNotificationEmpty(t *testing.T) {
+	if _, ok := digestNotification("", nil, time.Now()); ok {
+		t.Error("got a digest without workouts")
+	}
+}
+
+func TestQuietNotificationsLocale(t *testing.T) {
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, time.March, 3, 17, 30, 0, 0, loc)
+	workouts := []*Workout{{Summary: "Masters Swim", Start: start, End: start.Add(time.Hour), SignupURL: "https://example.com/signup"}}
+
+	n, ok := digestNotification("es", workouts, time.Date(2026, time.March, 2, 18, 0, 0, 0, loc))
+	if !ok {
+		t.Fatal("got no digest")
+	}
+	if n.Title != "Entrenamientos de mañana, mar 3 mar" || n.Body != "17:30 Masters Swim\n  Inscribirse: https://example.com/signup" {
+		t.Errorf("got digest %q: %q", n.Title, n.Body)
+	}
+
+	b := batchNotifications("es", []Notification{{Title: "a"}, {Title: "b"}})
+	if b.Title != "2 novedades durante las horas de silencio" {
+		t.Errorf("got batch %q", b.Title)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Where workouts come from, for reconciling the same workout from several of
+// them, see Config.Precedence.
+const (
+	OriginSite = "site"
+	OriginPlan = "plan"
+)
+
+// DefaultPrecedence is the order the origins are tried in for fields that
+// the precedence in the config doesn't list.
+var DefaultPrecedence = []string{OriginSite, OriginPlan}
+
+// reconcileField is a field of a workout that reconcile picks a value for.
+// has reports whether the workout has a value for the field and set copies
+// it.
+type reconcileField struct {
+	has func(w *Workout) bool
+	set func(dst, src *Workout)
+}
+
+// reconcileFields are the fields that are picked separately. time is the
+// start and end together, so that a workout can't end up ending before it
+// starts, and a workout only has one if its duration is known.
+var reconcileFields = map[string]reconcileField{
+	"time": {
+		has: func(w *Workout) bool { return w.HasDuration },
+		set: func(dst, src *Workout) { dst.Start, dst.End, dst.HasDuration = src.Start, src.End, src.HasDuration },
+	},
+	"location": {
+		has: func(w *Workout) bool { return w.Location != "" },
+		set: func(dst, src *Workout) { dst.Location = src.Location },
+	},
+	"description": {
+		has: func(w *Workout) bool { return w.Description != "" },
+		set: func(dst, src *Workout) { dst.Description = src.Description },
+	},
+	"signup_url": {
+		has: func(w *Workout) bool { return w.SignupURL != "" },
+		set: func(dst, src *Workout) { dst.SignupURL = src.SignupURL },
+	},
+	"type": {
+		has: func(w *Workout) bool { return w.Type != "" },
+		set: func(dst, src *Workout) { dst.Type = src.Type },
+	},
+}
+
+// checkPrecedence returns an error if the precedence names unknown fields or
+// origins.
+func checkPrecedence(precedence map[string][]string) error {
+	var fields []string
+	for name := range reconcileFields {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	for name, origins := range precedence {
+		if _, ok := reconcileFields[name]; !ok {
+			return fmt.Errorf("invalid precedence, unknown field, must be one of %s: `%s`", strings.Join(fields, ", "), name)
+		}
+
+		for _, o := range origins {
+			if o != OriginSite && o != OriginPlan {
+				return fmt.Errorf("invalid precedence for %s, unknown source, must be %s or %s: `%s`", name, OriginSite, OriginPlan, o)
+			}
+		}
+	}
+
+	return nil
+}
+
+// reconcile merges the versions of the same workout from each origin into
+// one. For each field, the origins are tried in order of precedence and the
+// first one with a value wins, falling back to the first origin if none has
+// one. Origins that the precedence leaves out are tried last, in the order
+// of DefaultPrecedence.
+func reconcile(versions map[string]*Workout, precedence map[string][]string) *Workout {
+	var res Workout
+	for _, o := range DefaultPrecedence {
+		if w := versions[o]; w != nil {
+			res = *w
+			break
+		}
+	}
+
+	for name, field := range reconcileFields {
+		order := append(append([]string{}, precedence[name]...), DefaultPrecedence...)
+
+		var first, best *Workout
+		for _, o := range order {
+			w := versions[o]
+			if w == nil {
+				continue
+			}
+			if first == nil {
+				first = w
+			}
+			if field.has(w) {
+				best = w
+				break
+			}
+		}
+
+		if best == nil {
+			best = first
+		}
+		field.set(&res, best)
+	}
+
+	return &res
+}
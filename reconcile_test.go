@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 6, 0, 0, 0, time.UTC)
+
+	// The site has the time and location, the plan has the duration, the
+	// description and the type
+	site := &Workout{Summary: "Track", Location: "Dublin High School", Start: start, End: start.Add(90 * time.Minute), SignupURL: "https://example.com/signup"}
+	plan := &Workout{Summary: "Track intervals", Start: start.Add(-time.Hour), End: start.Add(30 * time.Minute), HasDuration: true, Description: "6x800m", Type: "run"}
+
+	for _, tc := range []struct {
+		name       string
+		versions   map[string]*Workout
+		precedence map[string][]string
+		want       Workout
+	}{
+		{
+			"default precedence",
+			map[string]*Workout{OriginSite: site, OriginPlan: plan},
+			nil,
+			// The site has no duration, so the plan's time wins
+			Workout{Summary: "Track", Location: "Dublin High School", Start: plan.Start, End: plan.End, HasDuration: true, Description: "6x800m", SignupURL: site.SignupURL, Type: "run"},
+		},
+		{
+			"plan first",
+			map[string]*Workout{OriginSite: site, OriginPlan: plan},
+			map[string][]string{"location": {OriginPlan}, "signup_url": {OriginPlan}},
+			// The plan has no location or signup, so they fall back to the site
+			Workout{Summary: "Track", Location: "Dublin High School", Start: plan.Start, End: plan.End, HasDuration: true, Description: "6x800m", SignupURL: site.SignupURL, Type: "run"},
+		},
+		{
+			"site time",
+			map[string]*Workout{OriginSite: withDuration(site), OriginPlan: plan},
+			nil,
+			Workout{Summary: "Track", Location: "Dublin High School", Start: site.Start, End: site.End, HasDuration: true, Description: "6x800m", SignupURL: site.SignupURL, Type: "run"},
+		},
+		{
+			"plan time over the site's",
+			map[string]*Workout{OriginSite: withDuration(site), OriginPlan: plan},
+			map[string][]string{"time": {OriginPlan, OriginSite}},
+			Workout{Summary: "Track", Location: "Dublin High School", Start: plan.Start, End: plan.End, HasDuration: true, Description: "6x800m", SignupURL: site.SignupURL, Type: "run"},
+		},
+		{
+			"neither has a duration",
+			map[string]*Workout{OriginSite: site, OriginPlan: &Workout{Summary: "Track", Start: start, End: start.Add(time.Hour)}},
+			map[string][]string{"time": {OriginPlan}},
+			// The first origin in the precedence is used
+			Workout{Summary: "Track", Location: "Dublin High School", Start: start, End: start.Add(time.Hour), SignupURL: site.SignupURL},
+		},
+		{
+			"only the plan",
+			map[string]*Workout{OriginPlan: plan},
+			nil,
+			*plan,
+		},
+	} {
+		got := reconcile(tc.versions, tc.precedence)
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *got, tc.want)
+		}
+	}
+}
+
+func withDuration(w *Workout) *Workout {
+	res := *w
+	res.HasDuration = true
+	return &res
+}
+
+func TestCheckPrecedence(t *testing.T) {
+	if err := checkPrecedence(map[string][]string{"time": {OriginPlan}, "type": {OriginPlan, OriginSite}}); err != nil {
+		t.Error(err)
+	}
+
+	for _, precedence := range []map[string][]string{
+		{"summary": {OriginPlan}},
+		{"time": {"calendar"}},
+	} {
+		if err := checkPrecedence(precedence); err == nil {
+			t.Errorf("%v: got no error", precedence)
+		}
+	}
+}
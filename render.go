@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Output formats.
+const (
+	FormatICal     = "ical"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// formatExtensions maps file extensions to output formats.
+var formatExtensions = map[string]string{
+	".ical":     FormatICal,
+	".ics":      FormatICal,
+	".json":     FormatJSON,
+	".jsonld":   FormatJSONLD,
+	".md":       FormatMarkdown,
+	".markdown": FormatMarkdown,
+	".html":     FormatHTML,
+	".htm":      FormatHTML,
+	".csv":      FormatGoogleCSV,
+}
+
+// Template for the markdown output, a schedule grouped by day
+const MarkdownTemplate = `{{block "title" .}}# {{with .Name}}{{.}}{{else}}{{t "Tri-Valley Triathlon Club Workouts"}}{{end}}
+{{end}}{{range .Days}}
+## {{ldate "Monday, January 2" .Date}}
+{{range .Workouts}}{{block "workout" .}}
+- {{ldate "3:04 PM" .Start}} **{{.Summary}}**{{if .Location}}, {{.Location}}{{end}}{{with .SignupURL}} ([{{t "Sign up"}}]({{.}})){{end}}{{end}}{{end}}
+{{end}}`
+
+// Template for the HTML output, a standalone schedule page. Workouts are marked
+// up as h-event microformats.
+const HTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{block "title" .}}{{with .Name}}{{.}}{{else}}{{t "Tri-Valley Triathlon Club Workouts"}}{{end}}{{end}}</title>
+<style>
+{{block "style" .}}body { font-family: sans-serif; }
+.day { margin-bottom: 1em; }
+.time { font-weight: bold; }
+{{end}}</style>
+</head>
+<body>
+<h1>{{template "title" .}}</h1>
+{{range .Days}}<section class="day">
+<h2>{{ldate "Monday, January 2" .Date}}</h2>
+<ul>
+{{range .Workouts}}{{block "workout" .}}<li class="h-event"><time class="time dt-start" datetime="{{.Start.Format "2006-01-02T15:04:05-07:00"}}">{{ldate "3:04 PM" .Start}}</time><time class="dt-end" datetime="{{.End.Format "2006-01-02T15:04:05-07:00"}}"></time> <span class="p-name">{{.Summary}}</span>{{if .Location}}, <span class="p-location">{{.Location}}</span>{{end}}{{with .SignupURL}} <a class="u-url" href="{{.}}">{{t "Sign up"}}</a>{{end}}{{if .Description}}
+<p class="p-description">{{.Description}}</p>{{end}}</li>
+{{end}}{{end}}</ul>
+</section>
+{{end}}</body>
+</html>
+`
+
+// defaultTemplates are the built-in templates for each format.
+var defaultTemplates = map[string]string{
+	FormatICal:     ICalTemplate,
+	FormatMarkdown: MarkdownTemplate,
+	FormatHTML:     HTMLTemplate,
+}
+
+// Templates renders calendars using the default templates, layered with the
+// overrides from Dir. An override is named after the format (e.g.
+// ical.tmpl) and may either replace the whole template or only redefine some
+// of its blocks.
+type Templates struct {
+	Dir string
+
+	// File overrides the iCalendar template in the same way, instead of
+	// ical.tmpl in Dir
+	File string
+
+	// Config is used by the classification functions, see funcs
+	Config *Config
+
+	// Encoding is the encoding of the output and BOM whether it starts with
+	// a byte order mark, see encode
+	Encoding string
+	BOM      bool
+}
+
+// newTemplates returns the templates set by the flags.
+func newTemplates(config *Config) *Templates {
+	return &Templates{
+		Dir:      *tmplDir,
+		File:     *tmplFile,
+		Config:   config,
+		Encoding: *encoding,
+		BOM:      *bom,
+	}
+}
+
+// formatFor returns the output format for fname. That is format, if it is
+// set, otherwise it is based on the extension. The FormatCSV alias is
+// returned as FormatGoogleCSV.
+func formatFor(fname, format string) (string, error) {
+	if format == FormatCSV {
+		format = FormatGoogleCSV
+	}
+
+	if format != "" {
+		if !knownFormat(format) {
+			return "", fmt.Errorf("unknown format: %s", format)
+		}
+
+		return format, nil
+	}
+
+	format, ok := formatExtensions[strings.ToLower(filepath.Ext(fname))]
+	if !ok {
+		return "", fmt.Errorf("unknown output format for %s", fname)
+	}
+
+	return format, nil
+}
+
+// knownFormat reports whether format is the name of an output format.
+func knownFormat(format string) bool {
+	_, tmpl := defaultTemplates[format]
+	_, csv := csvFormats[format]
+	return tmpl || csv || format == FormatCSV || format == FormatJSON || format == FormatJSONLD
+}
+
+// splitOut splits an -out into its format, if it has one, and the file name,
+// e.g. gcal-csv:members.csv. The prefix must be a known format so that names
+// such as C:\tvtc.ics are left alone.
+func splitOut(out string) (format, fname string) {
+	if i := strings.IndexByte(out, ':'); i > 0 && knownFormat(out[:i]) {
+		return out[:i], out[i+1:]
+	}
+
+	return "", out
+}
+
+// render renders the calendar in the given format and encoding.
+func (t *Templates) render(cal *Calendar, format string) ([]byte, error) {
+	out, err := t.renderUTF8(cal, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.encode(out, format)
+}
+
+// renderUTF8 renders the calendar in the given format.
+func (t *Templates) renderUTF8(cal *Calendar, format string) ([]byte, error) {
+	if format == FormatJSON {
+		b, err := json.MarshalIndent(cal.Workouts, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+
+	if format == FormatJSONLD {
+		return renderJSONLD(cal)
+	}
+
+	if f, ok := csvFormats[format]; ok {
+		return renderCSV(cal, f)
+	}
+
+	text, ok := defaultTemplates[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+
+	override, err := t.override(format)
+	if err != nil {
+		return nil, err
+	}
+
+	fns := t.funcs()
+	if !cal.Stamp.IsZero() {
+		fns["now"] = func() string {
+			return cal.Stamp.UTC().Format(ICalTimeFormat)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if format == FormatHTML {
+		tmpl, err := htmltemplate.New(format).Funcs(htmltemplate.FuncMap(fns)).Parse(text)
+		if err == nil && override != "" {
+			tmpl, err = tmpl.Parse(override)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = tmpl.Execute(&buf, cal)
+		return buf.Bytes(), err
+	}
+
+	tmpl, err := template.New(format).Funcs(fns).Parse(text)
+	if err == nil && override != "" {
+		tmpl, err = tmpl.Parse(override)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tmpl.Execute(&buf, cal); err != nil {
+		return nil, err
+	}
+
+	if format == FormatICal {
+		return foldLines(buf.Bytes()), nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// override reads the override template for the format, if there is one.
+func (t *Templates) override(format string) (string, error) {
+	if t != nil && t.File != "" && format == FormatICal {
+		b, err := os.ReadFile(t.File)
+		return string(b), err
+	}
+
+	if t == nil || t.Dir == "" {
+		return "", nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(t.Dir, format+".tmpl"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return string(b), err
+}
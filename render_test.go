@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatFor(t *testing.T) {
+	for _, tc := range []struct {
+		fname, flag, format string
+	}{
+		{"tvtc.ical", "", FormatICal},
+		{"tvtc.ics", "", FormatICal},
+		{"TVTC.ICS", "", FormatICal},
+		{"out/tvtc.json", "", FormatJSON},
+		{"tvtc.md", "", FormatMarkdown},
+		{"tvtc.markdown", "", FormatMarkdown},
+		{"tvtc.txt", "", ""},
+		{"tvtc", "", ""},
+
+		// -format overrides the extension
+		{"tvtc.txt", FormatGoogleCSV, FormatGoogleCSV},
+		{"tvtc.ics", FormatJSON, FormatJSON},
+		{"tvtc.ics", "pdf", ""},
+	} {
+		format, err := formatFor(tc.fname, tc.flag)
+		if format != tc.format || (err == nil) != (tc.format != "") {
+			t.Errorf("%s, %s: got %s, %v, want %s", tc.fname, tc.flag, format, err, tc.format)
+		}
+	}
+}
+
+// testCalendar returns a calendar with two workouts on one day and one on the
+// next.
+func testCalendar(t *testing.T) *Calendar {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, time.March, day, hour, min, 0, 0, loc)
+	}
+
+	return &Calendar{
+		Workouts: []*Workout{
+			{Summary: "Track & Run", Location: "Dublin High School", Start: at(2, 6, 0), End: at(2, 7, 0), Type: "run"},
+			{Summary: "Masters Swim", Start: at(2, 17, 30), End: at(2, 18, 30), Type: "swim"},
+			{Summary: "Ride", Location: "Shannon Park", Start: at(3, 9, 0), End: at(3, 11, 0), Type: "bike"},
+		},
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	out, err := (&Templates{}).render(testCalendar(t), FormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Tri-Valley Triathlon Club Workouts
+
+## Monday, March 2
+
+- 6:00 AM **Track & Run**, Dublin High School
+- 5:30 PM **Masters Swim**
+
+## Tuesday, March 3
+
+- 9:00 AM **Ride**, Shannon Park
+`
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	out, err := (&Templates{}).render(testCalendar(t), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		`"summary": "Ride"`,
+		`"start": "2026-03-02T06:00:00-08:00"`,
+		`"type": "swim"`,
+	} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("missing %s in:\n%s", s, out)
+		}
+	}
+	if strings.Contains(string(out), "priority") {
+		t.Errorf("got a priority for workouts without one:\n%s", out)
+	}
+}
+
+func TestRenderUnknown(t *testing.T) {
+	if _, err := (&Templates{}).render(testCalendar(t), "pdf"); err == nil {
+		t.Error("got no error for an unknown format")
+	}
+}
+
+// TestRenderICalText checks that the text properties of events and alarms are
+// escaped, so that commas and semicolons survive a round trip.
+func TestRenderICalText(t *testing.T) {
+	cal := testCalendar(t)
+	for i, w := range cal.Workouts {
+		w.UID = fmt.Sprintf("%d@example.com", i)
+	}
+
+	w := cal.Workouts[2]
+	w.Summary = "Ride; hills, repeats"
+	w.Location = "Shannon Park, Dublin"
+	w.Alarms = []Alarm{{Action: "EMAIL", Trigger: "-PT1H", Description: "Ride, in an hour", Attendee: "a@example.com"}}
+
+	out, err := (&Templates{}).render(cal, FormatICal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`SUMMARY:Ride\; hills\, repeats`,
+		`LOCATION:Shannon Park\, Dublin`,
+		`DESCRIPTION:Ride\, in an hour`,
+		`SUMMARY:Ride\, in an hour`,
+	} {
+		if !strings.Contains(string(out), want+"\r\n") {
+			t.Errorf("missing %s", want)
+		}
+	}
+
+	// And notifications show the summary as it was
+	changes, err := diffCalendars([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes[2].Summary != w.Summary {
+		t.Errorf("got summary `%s` in the changes, want `%s`", changes[2].Summary, w.Summary)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// weekStart returns the date of the Monday of t's week, e.g. 2015-01-05.
+func weekStart(t time.Time) string {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location()).Format("2006-01-02")
+}
+
+// reportVolume aggregates the planned hours per workout type per week, as a
+// CSV with a row for each week (by its Monday) and a column for each type.
+// The columns are ordered like the config's type rules, followed by the types
+// that have no rule. Time added by -shift-start isn't counted, it is spent
+// getting to the workout.
+func reportVolume(workouts []*Workout, config *Config) ([]byte, error) {
+	hours := map[string]map[string]float64{}
+	seen := map[string]bool{}
+
+	for _, w := range workouts {
+		start := w.Start.Add(-w.shifted)
+
+		week := weekStart(start)
+		if hours[week] == nil {
+			hours[week] = map[string]float64{}
+		}
+
+		hours[week][w.Type] += w.End.Sub(start).Hours()
+		seen[w.Type] = true
+	}
+
+	var types []string
+	for _, rule := range config.Types {
+		if seen[rule.Type] {
+			types = append(types, rule.Type)
+			delete(seen, rule.Type)
+		}
+	}
+
+	// Types that have no rule, e.g. DefaultType or types from the -plan
+	var rest []string
+	for typ := range seen {
+		rest = append(rest, typ)
+	}
+	sort.Strings(rest)
+	types = append(types, rest...)
+
+	var weeks []string
+	for week := range hours {
+		weeks = append(weeks, week)
+	}
+	sort.Strings(weeks)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(append(append([]string{"week"}, types...), "total"))
+
+	for _, week := range weeks {
+		row := []string{week}
+
+		total := 0.0
+		for _, typ := range types {
+			row = append(row, fmt.Sprintf("%.2f", hours[week][typ]))
+			total += hours[week][typ]
+		}
+
+		w.Write(append(row, fmt.Sprintf("%.2f", total)))
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportVolume(t *testing.T) {
+	monday := time.Date(2026, time.March, 2, 6, 0, 0, 0, time.UTC)
+	workout := func(typ string, start time.Time, d time.Duration) *Workout {
+		return &Workout{Type: typ, Start: start, End: start.Add(d)}
+	}
+
+	workouts := []*Workout{
+		workout("run", monday, time.Hour),
+		workout("swim", monday.AddDate(0, 0, 1), 90*time.Minute),
+		workout("race", monday.AddDate(0, 0, 6), 4*time.Hour),
+		workout(DefaultType, monday.AddDate(0, 0, 7), 30*time.Minute),
+		workout("brick", monday.AddDate(0, 0, 8), 2*time.Hour),
+	}
+
+	// Shifted 15 minutes earlier, still an hour of running
+	shifter := &Shifter{ByType: map[string]time.Duration{"run": -15 * time.Minute}}
+	shifter.shift(workouts)
+
+	config := &Config{Types: []TypeRule{{Type: "swim"}, {Type: "run"}, {Type: "bike"}}}
+
+	b, err := reportVolume(workouts, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "week,swim,run,brick,other,race,total\n" +
+		"2026-03-02,1.50,1.00,0.00,0.00,4.00,6.50\n" +
+		"2026-03-09,0.00,0.00,2.00,0.50,0.00,2.50\n"
+	if string(b) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b, want)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Rule rewrites the workouts that it matches. Rules are applied in order after
+// classification and before filtering, so later rules see the changes made by
+// earlier ones.
+type Rule struct {
+	Match RuleMatch `json:"match"`
+	Set   RuleSet   `json:"set"`
+
+	// Properties are extra X- properties added to matching workouts, values
+	// are templates like event_properties
+	Properties map[string]string `json:"properties"`
+
+	summary, location *regexp.Regexp
+	set               map[string]*template.Template
+	duration          time.Duration
+	props             []PropertyTemplate
+}
+
+// RuleMatch selects workouts, all the non-empty fields must match. Summary and
+// Location are regular expressions.
+type RuleMatch struct {
+	Type     string `json:"type"`
+	Summary  string `json:"summary"`
+	Location string `json:"location"`
+}
+
+// RuleSet are the rewrites for matching workouts. Summary, Location, and
+// Description are templates executed against the Workout. Duration replaces
+// the length of the workout.
+type RuleSet struct {
+	Summary     string `json:"summary"`
+	Location    string `json:"location"`
+	Description string `json:"description"`
+	Duration    string `json:"duration"`
+}
+
+// compile prepares the rule for use.
+func (r *Rule) compile() error {
+	var err error
+
+	if r.Match.Summary != "" {
+		if r.summary, err = regexp.Compile(r.Match.Summary); err != nil {
+			return err
+		}
+	}
+	if r.Match.Location != "" {
+		if r.location, err = regexp.Compile(r.Match.Location); err != nil {
+			return err
+		}
+	}
+
+	r.set = map[string]*template.Template{}
+	for name, text := range map[string]string{
+		"summary":     r.Set.Summary,
+		"location":    r.Set.Location,
+		"description": r.Set.Description,
+	} {
+		if text == "" {
+			continue
+		}
+
+		if r.set[name], err = template.New(name).Funcs(templateFuncs).Parse(text); err != nil {
+			return err
+		}
+	}
+
+	if r.Set.Duration != "" {
+		if r.duration, err = parseDuration(r.Set.Duration); err != nil {
+			return err
+		}
+		if r.duration <= 0 {
+			return fmt.Errorf("duration must be positive: `%s`", r.Set.Duration)
+		}
+	}
+
+	r.props, err = compileProperties(r.Properties)
+	return err
+}
+
+// matches returns true if the workout matches all the conditions.
+func (r *Rule) matches(w *Workout) bool {
+	if r.Match.Type != "" && r.Match.Type != w.Type {
+		return false
+	}
+	if r.summary != nil && !r.summary.MatchString(w.Summary) {
+		return false
+	}
+	if r.location != nil && !r.location.MatchString(w.Location) {
+		return false
+	}
+
+	return true
+}
+
+// apply rewrites the workout. All the templates are executed before any field
+// is changed so that they all see the original values.
+func (r *Rule) apply(w *Workout) error {
+	vals := map[string]string{}
+	for name, tmpl := range r.set {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, w); err != nil {
+			return err
+		}
+		vals[name] = strings.TrimSpace(buf.String())
+	}
+
+	props, err := expandProperties(r.props, w)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := vals["summary"]; ok {
+		w.Summary = v
+	}
+	if v, ok := vals["location"]; ok {
+		w.Location = v
+	}
+	if v, ok := vals["description"]; ok {
+		w.Description = v
+	}
+	if r.duration > 0 {
+		// Like a duration from the calendar, -durations must not replace it
+		w.End = w.Start.Add(r.duration)
+		w.HasDuration = true
+	}
+
+	w.Properties = append(w.Properties, props...)
+
+	return nil
+}
+
+// applyRules applies every matching rule to each workout.
+func applyRules(rules []Rule, workouts []*Workout) error {
+	for _, w := range workouts {
+		for i := range rules {
+			if !rules[i].matches(w) {
+				continue
+			}
+
+			if err := rules[i].apply(w); err != nil {
+				return fmt.Errorf("rule %d: %v", i, err)
+			}
+		}
+	}
+
+	return nil
+}
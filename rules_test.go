@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyRules(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 6, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name  string
+		rules []Rule
+		in    Workout
+		want  Workout
+	}{
+		{
+			name:  "no match",
+			rules: []Rule{{Match: RuleMatch{Type: "swim"}, Set: RuleSet{Summary: "Swim"}}},
+			in:    Workout{Summary: "Track", Type: "run"},
+			want:  Workout{Summary: "Track", Type: "run"},
+		},
+		{
+			name:  "type",
+			rules: []Rule{{Match: RuleMatch{Type: "run"}, Set: RuleSet{Location: "Dublin High School"}}},
+			in:    Workout{Summary: "Track", Type: "run"},
+			want:  Workout{Summary: "Track", Location: "Dublin High School", Type: "run"},
+		},
+		{
+			name:  "all conditions must match",
+			rules: []Rule{{Match: RuleMatch{Type: "run", Summary: "(?i)trail"}, Set: RuleSet{Summary: "Trail Run"}}},
+			in:    Workout{Summary: "Track", Type: "run"},
+			want:  Workout{Summary: "Track", Type: "run"},
+		},
+		{
+			name:  "templates see the original values",
+			rules: []Rule{{Match: RuleMatch{Summary: "^Swim$", Location: "Pool"}, Set: RuleSet{Summary: "{{.Summary}} at {{.Location}}", Location: "{{.Summary}}, {{.Location}}", Description: " Bring fins "}}},
+			in:    Workout{Summary: "Swim", Location: "Pool"},
+			want:  Workout{Summary: "Swim at Pool", Location: "Swim, Pool", Description: "Bring fins"},
+		},
+		{
+			name:  "later rules see earlier changes",
+			rules: []Rule{{Set: RuleSet{Summary: "Open Water"}}, {Match: RuleMatch{Summary: "Open Water"}, Set: RuleSet{Summary: "{{.Summary}} Swim"}}},
+			in:    Workout{Summary: "OWS"},
+			want:  Workout{Summary: "Open Water Swim"},
+		},
+		{
+			name:  "duration",
+			rules: []Rule{{Match: RuleMatch{Type: "bike"}, Set: RuleSet{Duration: "1h30m"}}},
+			in:    Workout{Summary: "Ride", Type: "bike", Start: start, End: start.Add(time.Hour)},
+			want:  Workout{Summary: "Ride", Type: "bike", Start: start, End: start.Add(90 * time.Minute), HasDuration: true},
+		},
+		{
+			name:  "properties",
+			rules: []Rule{{Match: RuleMatch{Type: "swim"}, Properties: map[string]string{"x-pool": "{{.Location}}", "X-EMPTY": ""}}},
+			in:    Workout{Summary: "Swim", Location: "Pool", Type: "swim", Properties: []Property{{"X-CLUB", "TVTC"}}},
+			want:  Workout{Summary: "Swim", Location: "Pool", Type: "swim", Properties: []Property{{"X-CLUB", "TVTC"}, {"X-POOL", "Pool"}}},
+		},
+	} {
+		for i := range tc.rules {
+			if err := tc.rules[i].compile(); err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+		}
+
+		w := tc.in
+		if err := applyRules(tc.rules, []*Workout{&w}); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(w, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, w, tc.want)
+		}
+	}
+}
+
+func TestRuleCompileInvalid(t *testing.T) {
+	for _, r := range []Rule{
+		{Match: RuleMatch{Summary: "(swim"}},
+		{Match: RuleMatch{Location: "[pool"}},
+		{Set: RuleSet{Summary: "{{.Summary"}},
+		{Set: RuleSet{Duration: "an hour"}},
+		{Set: RuleSet{Duration: "-1h"}},
+		{Properties: map[string]string{"POOL": "{{.Location}}"}},
+	} {
+		if err := r.compile(); err == nil {
+			t.Errorf("%+v: got no error", r)
+		}
+	}
+}
+
+func TestApplyRulesError(t *testing.T) {
+	rules := []Rule{{}, {Set: RuleSet{Summary: "{{.Missing}}"}}}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := applyRules(rules, []*Workout{{Summary: "Swim"}})
+	if err == nil || !strings.HasPrefix(err.Error(), "rule 1:") {
+		t.Errorf("got %v, want an error for rule 1", err)
+	}
+}
+
+// TestRuleDurationKept checks that -durations doesn't replace the duration
+// set by a rule.
+func TestRuleDurationKept(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 6, 0, 0, 0, time.UTC)
+	workouts := []*Workout{
+		{Summary: "Ride", Type: "bike", Start: start, End: start.Add(time.Hour)},
+		{Summary: "Run", Type: "run", Start: start, End: start.Add(time.Hour)},
+	}
+
+	rules := []Rule{{Match: RuleMatch{Type: "bike"}, Set: RuleSet{Duration: "2h"}}}
+	if err := rules[0].compile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyRules(rules, workouts); err != nil {
+		t.Fatal(err)
+	}
+
+	setDurations(workouts, map[string]time.Duration{DefaultDurationKey: 45 * time.Minute})
+
+	for i, want := range []time.Duration{2 * time.Hour, 45 * time.Minute} {
+		if d := workouts[i].End.Sub(start); d != want {
+			t.Errorf("%s: got %v, want %v", workouts[i].Summary, d, want)
+		}
+	}
+}
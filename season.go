@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Annotations added to summaries by -number.
+const (
+	NumberWeek    = "week"
+	NumberSession = "session"
+)
+
+// parseSeasonStart parses season_start, a date such as 2026-01-05, as
+// midnight in the club's timezone.
+func parseSeasonStart(s string) (time.Time, error) {
+	loc, err := time.LoadLocation(Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid season_start, must be YYYY-MM-DD: `%s`", s)
+	}
+
+	return t, nil
+}
+
+// sessionKey identifies the workouts that are the same session on different
+// days, such as every Track workout.
+func sessionKey(w *Workout) string {
+	return strings.ToLower(strings.Join(strings.Fields(w.Summary), " "))
+}
+
+// numberWorkouts sets the week of the season and the session number of every
+// workout on or after start. Week 1 is the seven days starting at start and
+// each session is numbered by how many workouts with the same summary came
+// before it, counting from start. Only the workouts given are counted.
+func numberWorkouts(workouts []*Workout, start time.Time) {
+	sorted := append([]*Workout{}, workouts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	sessions := map[string]int{}
+
+	for _, w := range sorted {
+		if w.Start.Before(start) {
+			continue
+		}
+
+		// Count calendar days in the club's timezone, in UTC so that DST
+		// doesn't make any day shorter or longer
+		y, m, d := w.Start.In(start.Location()).Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+		w.Week = int(day.Sub(first).Hours()/24)/7 + 1
+
+		key := sessionKey(w)
+		sessions[key]++
+		w.Session = sessions[key]
+	}
+}
+
+// checkNumbering warns when session numbers can't be right because the
+// calendar doesn't reach back to the start of the season.
+func checkNumbering(workouts []*Workout, start time.Time) {
+	var first time.Time
+	for _, w := range workouts {
+		if first.IsZero() || w.Start.Before(first) {
+			first = w.Start
+		}
+	}
+
+	if !first.IsZero() && first.After(start.AddDate(0, 0, 7)) {
+		warnf("session numbers only count the workouts since %s, use -back to fetch the months since season_start", first.Format("Jan 2"))
+	}
+}
+
+// number annotates the summary with the week or session number, if set.
+func number(w *Workout, mode, locale string) string {
+	switch {
+	case mode == NumberWeek && w.Week > 0:
+		return fmt.Sprintf(translate(locale, "Week %d: %s"), w.Week, w.Summary)
+	case mode == NumberSession && w.Session > 0:
+		return fmt.Sprintf("%s #%d", w.Summary, w.Session)
+	}
+
+	return w.Summary
+}
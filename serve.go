@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ServePath is where serve serves the calendar.
+const ServePath = "/tvtc.ics"
+
+// calendarServer serves the iCalendar output over HTTP, regenerating it from
+// the club's calendar every interval.
+type calendarServer struct {
+	config    *Config
+	templates *Templates
+	interval  time.Duration
+
+	// admin is set if serve_auth covers the admin routes, which are
+	// served only then
+	admin bool
+
+	// refreshing is held during a refresh, so that one asked for on
+	// AdminRefreshPath waits for the one from run
+	refreshing sync.Mutex
+
+	mu       sync.RWMutex
+	ics      []byte
+	modified time.Time
+	workouts int
+
+	// refreshed is when the last refresh finished, and err its error. good
+	// is when the last successful one did, the calendar served is as old as
+	// that while the refreshes fail
+	refreshed time.Time
+	err       error
+	good      time.Time
+}
+
+// refresh fetches the calendar and regenerates the output. Modified is only
+// bumped when the events change, not just their DTSTAMP, so that clients
+// polling with If-Modified-Since don't download the same calendar again. With
+// -state, the SEQUENCE of changed events is bumped and the number of workouts
+// is checked against the previous runs, like fetch.
+func (s *calendarServer) refresh() error {
+	*runSummary = *newRunSummary()
+
+	pages, err := loadPages()
+	if err != nil {
+		return err
+	}
+
+	groups, mtimes, months, err := fetchGroups(pages)
+	if err != nil {
+		return err
+	}
+
+	state, err := openState()
+	if err != nil {
+		return err
+	}
+
+	cals, err := buildCalendars(s.config, groups, mtimes, months)
+	if err != nil {
+		return err
+	}
+
+	if state != nil {
+		state.sequence(cals[0].Workouts, runSummary.Start)
+	}
+
+	if err := preflight(cals[0], s.templates); err != nil {
+		return err
+	}
+
+	out, err := s.templates.render(cals[0], FormatICal)
+	if err != nil {
+		return err
+	}
+
+	state.saveRun()
+
+	s.mu.RLock()
+	prev := s.ics
+	s.mu.RUnlock()
+
+	if prev != nil {
+		changes, err := diffCalendars(prev, out)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			log.Printf("no changes to %s", ServePath)
+			return nil
+		}
+
+		notify(changesNotification(s.config.Locale, changes))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ics = out
+	s.modified = time.Now()
+	s.workouts = len(cals[0].Workouts)
+
+	runSummary.Written = len(cals[0].Workouts)
+
+	return nil
+}
+
+// update refreshes the calendar and records the outcome for AdminStatusPath.
+func (s *calendarServer) update() error {
+	s.refreshing.Lock()
+	defer s.refreshing.Unlock()
+
+	err := s.refresh()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshed = time.Now()
+	s.err = err
+	if err == nil {
+		s.good = s.refreshed
+	}
+
+	runSummary.Staleness = s.staleness(s.refreshed).Seconds()
+
+	return err
+}
+
+// staleness returns how long ago the last successful refresh finished, zero if
+// the last refresh succeeded. Callers must hold mu.
+func (s *calendarServer) staleness(now time.Time) time.Duration {
+	if s.err == nil {
+		return 0
+	}
+
+	return now.Sub(s.good)
+}
+
+// run refreshes the calendar every interval until the process exits. Failures
+// are logged and the previous calendar is served until the next refresh.
+func (s *calendarServer) run() {
+	for range time.Tick(s.interval) {
+		if err := s.update(); err != nil {
+			warnf("unable to refresh calendar: %v", err)
+			notify(errorNotification(err))
+		}
+
+		if err := runSummary.write(*summaryOut); err != nil {
+			log.Printf("unable to write summary: %v", err)
+		}
+
+		if err := runSummary.push(*pushgateway, *pushgatewayJob); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+func (s *calendarServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == ServePath:
+	case s.admin && r.URL.Path == AdminRefreshPath:
+		s.serveRefresh(w, r)
+		return
+	case s.admin && r.URL.Path == AdminStatusPath:
+		s.serveStatus(w, r)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	ics, modified := s.ics, s.modified
+	staleness := s.staleness(time.Now())
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+
+	// The last good calendar is served while the refreshes fail, so that
+	// the events don't vanish from the members' calendars during an outage
+	if staleness > 0 {
+		w.Header().Set("X-Staleness", strconv.Itoa(int(staleness.Seconds())))
+	}
+
+	// Handles Last-Modified, If-Modified-Since, and HEAD
+	http.ServeContent(w, r, ServePath, modified, bytes.NewReader(ics))
+}
+
+// serve generates the calendar and serves it on addr, regenerating it every
+// interval. See listen for addr.
+func serve(addr string, interval time.Duration, config *Config, templates *Templates) error {
+	s := &calendarServer{
+		config:    config,
+		templates: templates,
+		interval:  interval,
+		admin:     authRule(config.ServeAuth, AdminRefreshPath) != nil,
+	}
+
+	// Fail fast if the calendar can't be generated at all
+	if err := s.update(); err != nil {
+		return err
+	}
+
+	tlsConf, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	l, err := listen(addr)
+	if err != nil {
+		return err
+	}
+
+	if tlsConf != nil {
+		l = tls.NewListener(l, tlsConf)
+	}
+
+	go s.run()
+
+	log.Printf("serving %s on %s, refreshing every %v", ServePath, addr, interval)
+
+	return http.Serve(l, requireAuth(config.ServeAuth, s))
+}
+
+// listen listens on addr, which is a TCP address such as :8080, or unix:
+// followed by the path of a socket such as unix:/run/tvtccal.sock for a
+// reverse proxy on the same host.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// Left behind by a server that didn't exit cleanly, anything else at
+	// the path is kept so that a typo doesn't delete a file
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// tlsConfig returns the TLS config of the server, which uses the -tls-cert
+// and -tls-key or gets certificates for the -tls-domain from Let's Encrypt.
+// Returns nil if the server doesn't use HTTPS.
+func tlsConfig() (*tls.Config, error) {
+	switch {
+	case *tlsDomains != "" && (*tlsCert != "" || *tlsKey != ""):
+		return nil, errors.New("-tls-domain can't be used with -tls-cert or -tls-key")
+	case *tlsDomains != "":
+		dir := filepath.Join(*cacheDir, "autocert")
+		if *cacheDir == "" {
+			cache, err := os.UserCacheDir()
+			if err != nil {
+				return nil, err
+			}
+			dir = filepath.Join(cache, "tvtccal", "autocert")
+		}
+
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(*tlsDomains, ",")...),
+			Cache:      autocert.DirCache(dir),
+		}
+
+		// Answers the tls-alpn-01 challenge on the same port, so port
+		// 80 doesn't have to be open
+		return m.TLSConfig(), nil
+	case *tlsCert != "" || *tlsKey != "":
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -tls-cert or -tls-key: %v", err)
+		}
+
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeRefreshState checks that refreshing the served calendar records
+// the run in the -state and refuses anomalous counts.
+func TestServeRefreshState(t *testing.T) {
+	dir := t.TempDir()
+
+	page := filepath.Join(dir, "october.html")
+	if err := os.WriteFile(page, []byte(octoberPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(test, state string, deviation float64, refuse bool) {
+		*testFile, *stateFile, *maxDeviation, *refuseAnomaly = test, state, deviation, refuse
+	}(*testFile, *stateFile, *maxDeviation, *refuseAnomaly)
+
+	*testFile = page
+	*stateFile = filepath.Join(dir, "state.json")
+	*maxDeviation = 20
+	*refuseAnomaly = true
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &calendarServer{config: config, templates: newTemplates(config)}
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := loadState(*stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Runs) != 1 || state.Runs[0].Parsed != 2 || len(state.Events) != 2 {
+		t.Fatalf("got %d runs and %d events in the state, want 1 run of 2", len(state.Runs), len(state.Events))
+	}
+
+	// The previous runs found many more workouts
+	state.Runs[0].Parsed = 20
+	if err := state.save(*stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	served := s.ics
+	if err := s.refresh(); err == nil || !strings.HasPrefix(err.Error(), "refusing to publish") {
+		t.Errorf("got %v, want the anomaly refused", err)
+	}
+	if string(s.ics) != string(served) {
+		t.Error("the calendar changed after a refused refresh")
+	}
+}
+
+// TestServeStale checks that the last good calendar is served, marked
+// stale, while the refreshes fail.
+func TestServeStale(t *testing.T) {
+	dir := t.TempDir()
+
+	page := filepath.Join(dir, "october.html")
+	if err := os.WriteFile(page, []byte(octoberPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved string) { *testFile = saved }(*testFile)
+	*testFile = page
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &calendarServer{config: config, templates: newTemplates(config)}
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", ServePath, nil))
+		return w
+	}
+
+	if err := s.update(); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := get()
+	if got := fresh.Header().Get("X-Staleness"); got != "" {
+		t.Errorf("got X-Staleness %q after a refresh", got)
+	}
+
+	// The site is down an hour after the last refresh
+	*testFile = filepath.Join(dir, "missing.html")
+	if err := s.update(); err == nil {
+		t.Fatal("got no error")
+	}
+	s.good = s.good.Add(-time.Hour)
+
+	stale := get()
+	if stale.Code != http.StatusOK || stale.Body.String() != fresh.Body.String() {
+		t.Errorf("got %d, want the last good calendar", stale.Code)
+	}
+	if got := stale.Header().Get("X-Staleness"); got != "3600" {
+		t.Errorf("got X-Staleness %q, want 3600", got)
+	}
+
+	if runSummary.Staleness <= 0 {
+		t.Errorf("got staleness %v in the summary", runSummary.Staleness)
+	}
+	if m := string(runSummary.metrics(time.Now())); !strings.Contains(m, "\ntvtccal_served_staleness_seconds ") {
+		t.Errorf("got metrics:\n%s", m)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "tvtccal.sock")
+
+	// A stale socket from a previous server is replaced
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listen("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := &calendarServer{ics: []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"), modified: time.Now()}
+	go http.Serve(l, s)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	resp, err := client.Get("http://tvtccal" + ServePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if b, _ := io.ReadAll(resp.Body); string(b) != string(s.ics) {
+		t.Errorf("got %q", b)
+	}
+
+	// Anything else at the path is kept
+	fname := filepath.Join(t.TempDir(), "tvtc.ics")
+	if err := os.WriteFile(fname, s.ics, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen("unix:" + fname); err == nil {
+		t.Error("listened over a regular file")
+	}
+	if _, err := os.Stat(fname); err != nil {
+		t.Error(err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key to
+// dir.
+func writeTestCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tvtccal"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile, cert
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	defer func(cert, key, domains, cache string) {
+		*tlsCert, *tlsKey, *tlsDomains, *cacheDir = cert, key, domains, cache
+	}(*tlsCert, *tlsKey, *tlsDomains, *cacheDir)
+
+	if conf, err := tlsConfig(); conf != nil || err != nil {
+		t.Errorf("got %v, %v without any -tls flags", conf, err)
+	}
+
+	certFile, keyFile, cert := writeTestCert(t, dir)
+	*tlsCert, *tlsKey = certFile, keyFile
+
+	conf, err := tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := &calendarServer{ics: []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"), modified: time.Now()}
+	go http.Serve(tls.NewListener(l, conf), s)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	resp, err := client.Get("https://" + l.Addr().String() + ServePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d over HTTPS", resp.StatusCode)
+	}
+
+	// A certificate without its key
+	*tlsKey = ""
+	if _, err := tlsConfig(); err == nil {
+		t.Error("got no error for -tls-cert without -tls-key")
+	}
+
+	*tlsDomains = "cal.trivalleytriclub.com"
+	if _, err := tlsConfig(); err == nil {
+		t.Error("got no error for -tls-domain with -tls-cert")
+	}
+
+	*tlsCert, *cacheDir = "", dir
+	if conf, err := tlsConfig(); err != nil || !slices.Contains(conf.NextProtos, "acme-tls/1") {
+		t.Errorf("got %v, %v for -tls-domain, want the tls-alpn-01 challenge answered", conf, err)
+	}
+}
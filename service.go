@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ServiceName is the name of the Windows service that service install
+// creates, and ServiceDescription how the Services console describes it.
+const (
+	ServiceName        = "tvtccal"
+	ServiceDescription = "Publishes the Tri-Valley Triathlon Club calendar every -interval, see tvtccal -daemon."
+)
+
+// errNoService is returned by the service subcommands where there is no
+// service manager to run under.
+var errNoService = errors.New("services are only supported on Windows, use -daemon under systemd or launchd instead")
+
+// serviceArgs returns the arguments that the service manager starts tvtccal
+// with: service run, the flags set on the command line, and dir. The paths
+// that are read before service run changes to dir are made absolute.
+func serviceArgs(sources map[string]string, dir string) ([]string, error) {
+	var names []string
+	for name, source := range sources {
+		if source == SourceFlag {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	args := []string{"service", "run"}
+
+	for _, name := range names {
+		f := options.Lookup(name)
+
+		vals := []string{f.Value.String()}
+		if v, ok := f.Value.(*stringsFlag); ok {
+			vals = v.Values
+		}
+
+		for _, v := range vals {
+			switch name {
+			case "config", "log-file", "model":
+				var err error
+				if v, err = filepath.Abs(v); err != nil {
+					return nil, err
+				}
+			}
+
+			args = append(args, fmt.Sprintf("-%s=%s", name, v))
+		}
+	}
+
+	return append(args, dir), nil
+}
+
+// serviceInstallCmd installs fetch -daemon as a service that starts with the
+// machine, with the flags given to it. The environment isn't passed on, use
+// the -config instead.
+func serviceInstallCmd(config *Config, args []string) error {
+	if *logFile == "" {
+		return errors.New("service install requires -log-file, the service has no console to log to")
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	args, err = serviceArgs(config.sources, dir)
+	if err != nil {
+		return err
+	}
+
+	if err := installService(args); err != nil {
+		return err
+	}
+
+	log.Printf("installed service %s, start it with tvtccal service start", ServiceName)
+	return nil
+}
+
+// serviceRunCmd is what the service manager starts. It changes to the
+// directory that service install was run in, so that the relative paths in
+// the flags still work, and runs the daemon until the service is stopped.
+func serviceRunCmd(config *Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tvtccal service run [OPTION]... DIR")
+	}
+
+	if err := os.Chdir(args[0]); err != nil {
+		return err
+	}
+
+	interval, err := parseDuration(*daemonInterval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid -interval: %s", *daemonInterval)
+	}
+
+	return runService(config, interval)
+}
+
+func serviceStartCmd(config *Config, args []string) error {
+	return startService()
+}
+
+func serviceStopCmd(config *Config, args []string) error {
+	return stopService()
+}
+
+func serviceRemoveCmd(config *Config, args []string) error {
+	return removeService()
+}
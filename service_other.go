@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "time"
+
+func installService(args []string) error {
+	return errNoService
+}
+
+func removeService() error {
+	return errNoService
+}
+
+func startService() error {
+	return errNoService
+}
+
+func stopService() error {
+	return errNoService
+}
+
+func runService(config *Config, interval time.Duration) error {
+	return errNoService
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServiceArgs(t *testing.T) {
+	defer func(conf string, badge bool, out []string) {
+		*confFile, *badges, outFiles.Values = conf, badge, out
+	}(*confFile, *badges, outFiles.Values)
+
+	*confFile = "tvtc.json"
+	*badges = true
+	outFiles.Values = []string{"tvtc.ics", "gcal-csv:members.csv"}
+
+	sources := map[string]string{
+		"config": SourceFlag,
+		"out":    SourceFlag,
+		"badges": SourceFlag,
+		// Read from the config, or the environment, when the service runs
+		"interval": SourceConfig,
+		"state":    SourceEnv,
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := serviceArgs(sources, `C:\tvtc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"service", "run",
+		"-badges=true",
+		"-config=" + filepath.Join(wd, "tvtc.json"),
+		"-out=tvtc.ics",
+		"-out=gcal-csv:members.csv",
+		`C:\tvtc`,
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
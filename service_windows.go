@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// ServiceStopTimeout is how long service stop waits for a cycle in progress
+// to finish.
+const ServiceStopTimeout = 2 * time.Minute
+
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(ServiceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed, see service remove", ServiceName)
+	}
+
+	s, err := m.CreateService(ServiceName, exe, mgr.Config{
+		DisplayName: ServiceName,
+		Description: ServiceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+
+	return s.Close()
+}
+
+// openService opens the installed service, close the manager when done.
+func openService() (*mgr.Mgr, *mgr.Service, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := m.OpenService(ServiceName)
+	if err != nil {
+		m.Disconnect()
+		return nil, nil, fmt.Errorf("service %s isn't installed, see service install: %v", ServiceName, err)
+	}
+
+	return m, s, nil
+}
+
+func removeService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+
+	return s.Delete()
+}
+
+func startService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+
+	return s.Start()
+}
+
+// stopService stops the service and waits for it to finish the cycle in
+// progress.
+func stopService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+
+	for deadline := time.Now().Add(ServiceStopTimeout); status.State != svc.Stopped; {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %s didn't stop within %v", ServiceName, ServiceStopTimeout)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serviceHandler runs the daemon under the service manager.
+type serviceHandler struct {
+	config   *Config
+	interval time.Duration
+}
+
+// Execute runs the daemon until the service manager stops the service or
+// the machine shuts down.
+func (h *serviceHandler) Execute(args []string, reqs <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(h.config, h.interval, stop)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("service failed: %v", err)
+				fail(err)
+				return true, 1
+			}
+			return false, 0
+		case req := <-reqs:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: uint32(ServiceStopTimeout / time.Millisecond)}
+
+				// Already stopping if asked twice
+				select {
+				case stop <- os.Interrupt:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func runService(config *Config, interval time.Duration) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return errors.New("service run is started by the service manager, see service install and service start")
+	}
+
+	return svc.Run(ServiceName, &serviceHandler{config: config, interval: interval})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Shifter moves the start of workouts earlier so that the calendar block
+// includes warm-up or transit time. The real start time is noted in the
+// description.
+type Shifter struct {
+	// Default shift for all workouts, negative moves the start earlier
+	Default time.Duration
+
+	// ByType overrides Default for specific workout types
+	ByType map[string]time.Duration
+
+	// Locale of the note, see translate
+	Locale string
+}
+
+// newShifter parses the default and per-type shifts.
+func newShifter(def string, byType map[string]string) (*Shifter, error) {
+	s := &Shifter{ByType: map[string]time.Duration{}}
+
+	if def != "" {
+		d, err := parseDuration(def)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -shift-start: %v", err)
+		}
+		s.Default = d
+	}
+
+	for typ, v := range byType {
+		d, err := parseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shift_start for %s: %v", typ, err)
+		}
+		s.ByType[typ] = d
+	}
+
+	return s, nil
+}
+
+// shift applies the shifts to the workouts.
+func (s *Shifter) shift(workouts []*Workout) {
+	for _, w := range workouts {
+		d, ok := s.ByType[w.Type]
+		if !ok {
+			d = s.Default
+		}
+
+		if d == 0 || !w.Start.Add(d).Before(w.End) {
+			continue
+		}
+
+		note := fmt.Sprintf(translate(s.Locale, "Starts at %s"), formatDate(s.Locale, "3:04 PM", w.Start))
+		if w.Description != "" {
+			note += "\n" + w.Description
+		}
+
+		w.Description = note
+		w.Start = w.Start.Add(d)
+		w.shifted = d
+	}
+}
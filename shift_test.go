@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShift(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 6, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	s, err := newShifter("-15m", map[string]string{"swim": "-30m", "run": "0m", "race": "-1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		in          Workout
+		start       time.Time
+		description string
+	}{
+		{"default", Workout{Type: "bike", Start: start, End: end}, start.Add(-15 * time.Minute), "Starts at 6:00 AM"},
+		{"by type", Workout{Type: "swim", Start: start, End: end}, start.Add(-30 * time.Minute), "Starts at 6:00 AM"},
+		{"no shift for the type", Workout{Type: "run", Start: start, End: end}, start, ""},
+		{"description is kept", Workout{Type: "bike", Start: start, End: end, Description: "Bring lights"}, start.Add(-15 * time.Minute), "Starts at 6:00 AM\nBring lights"},
+		// A shift that doesn't leave the workout any time is ignored
+		{"too long", Workout{Type: "race", Start: start, End: start.Add(-time.Hour)}, start, ""},
+	} {
+		w := tc.in
+		s.shift([]*Workout{&w})
+
+		if !w.Start.Equal(tc.start) {
+			t.Errorf("%s: got start %v, want %v", tc.name, w.Start, tc.start)
+		}
+		if !w.End.Equal(tc.in.End) {
+			t.Errorf("%s: got end %v, want %v", tc.name, w.End, tc.in.End)
+		}
+		if w.shifted != tc.start.Sub(tc.in.Start) {
+			t.Errorf("%s: got shifted %v, want %v", tc.name, w.shifted, tc.start.Sub(tc.in.Start))
+		}
+		if w.Description != tc.description {
+			t.Errorf("%s: got description %q, want %q", tc.name, w.Description, tc.description)
+		}
+	}
+}
+
+func TestNewShifterInvalid(t *testing.T) {
+	if _, err := newShifter("15 minutes", nil); err == nil {
+		t.Error("got no error for an invalid -shift-start")
+	}
+	if _, err := newShifter("", map[string]string{"swim": "half an hour"}); err == nil {
+		t.Error("got no error for an invalid shift_start")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Modes for -dtstamp.
+const (
+	StampNow         = "now"
+	StampFixed       = "fixed"
+	StampSourceMtime = "source-mtime"
+)
+
+// dtstamp returns the DTSTAMP for the events according to mode. A zero time
+// means the current time. mtime is when the source was last modified, zero
+// if unknown.
+//
+// The fixed stamp is SOURCE_DATE_EPOCH, if it is set, or the Unix epoch so
+// that repeated runs over the same input produce identical files.
+func dtstamp(mode string, mtime time.Time) (time.Time, error) {
+	switch mode {
+	case "", StampNow:
+		return time.Time{}, nil
+	case StampFixed:
+		if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+			secs, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %s", v)
+			}
+			return time.Unix(secs, 0).UTC(), nil
+		}
+		return time.Unix(0, 0).UTC(), nil
+	case StampSourceMtime:
+		if mtime.IsZero() {
+			warnf("source modification time unknown, using the current time for DTSTAMP")
+		}
+		return mtime, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid -dtstamp: %s", mode)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// StateRuns is the number of past runs kept in the state.
+const StateRuns = 10
+
+// StateEventsMaxAge is how long the state remembers events that are no longer
+// in the calendar.
+const StateEventsMaxAge = 90 * 24 * time.Hour
+
+// State is persisted between runs in the -state file.
+type State struct {
+	// Runs are the most recent runs, oldest first
+	Runs []RunRecord `json:"runs"`
+
+	// Events are the last seen version of each event, keyed by UID
+	Events map[string]*EventVersion `json:"events,omitempty"`
+
+	// Held are the notifications held during quiet hours and Digests the
+	// day the last digest was sent, by notifier, see deliver
+	Held    []HeldNotification `json:"held,omitempty"`
+	Digests map[string]string  `json:"digests,omitempty"`
+}
+
+// EventVersion is what the state remembers about an event to tell when it
+// changed, see State.sequence.
+type EventVersion struct {
+	Hash     string    `json:"hash"`
+	Sequence int       `json:"sequence"`
+	Seen     time.Time `json:"seen"`
+}
+
+// RunRecord is what the state remembers about a single run.
+type RunRecord struct {
+	Time   time.Time `json:"time"`
+	Parsed int       `json:"parsed"`
+}
+
+// loadState reads the state from fname, a missing file is an empty state.
+func loadState(fname string) (*State, error) {
+	state := &State{}
+
+	b, err := os.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("unable to parse state %s: %v", fname, err)
+	}
+
+	return state, nil
+}
+
+// openState loads the -state, if set, and checks the number of workouts
+// parsed by this run against the previous runs, see -max-deviation. Returns
+// nil if -state isn't set.
+func openState() (*State, error) {
+	if *stateFile == "" {
+		return nil, nil
+	}
+
+	state, err := loadState(*stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := state.checkCount(runSummary.Parsed, *maxDeviation); err != nil {
+		if *refuseAnomaly {
+			return nil, fmt.Errorf("refusing to publish: %v", err)
+		}
+		warnf("%v", err)
+	}
+
+	return state, nil
+}
+
+// saveRun records this run in the state and saves it to the -state. Noop if
+// the state is nil or with -dry-run, which mustn't bump the SEQUENCE of
+// events that the next real run publishes.
+func (s *State) saveRun() {
+	if s == nil || *dryRun {
+		return
+	}
+
+	// Notifications held since deliver
+	s.Held = append(s.Held, held...)
+	held = nil
+
+	s.record(RunRecord{Time: runSummary.Start, Parsed: runSummary.Parsed})
+	if err := s.save(*stateFile); err != nil {
+		warnf("unable to save state: %v", err)
+	}
+}
+
+// save writes the state to fname, see writeAtomic.
+func (s *State) save(fname string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(fname, append(b, '\n'), 0600)
+}
+
+// record adds the run, dropping the oldest ones past StateRuns.
+func (s *State) record(r RunRecord) {
+	s.Runs = append(s.Runs, r)
+	if len(s.Runs) > StateRuns {
+		s.Runs = s.Runs[len(s.Runs)-StateRuns:]
+	}
+}
+
+// versionHash hashes the parts of the workout that are significant to
+// calendar clients, see RFC 5546 Sec 2.1.4.
+func versionHash(w *Workout) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n%s", w.Start.UTC().Format(ICalTimeFormat), w.End.UTC().Format(ICalTimeFormat), w.Summary, w.Location, w.Description, w.Status)
+
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// sequence sets the Sequence of each workout, bumping it whenever the
+// workout changed since the last run so that clients pick up the update.
+// Events not seen for StateEventsMaxAge are forgotten.
+func (s *State) sequence(workouts []*Workout, now time.Time) {
+	if s.Events == nil {
+		s.Events = map[string]*EventVersion{}
+	}
+
+	for _, w := range workouts {
+		hash := versionHash(w)
+
+		v, ok := s.Events[w.UID]
+		if !ok {
+			v = &EventVersion{Hash: hash}
+			s.Events[w.UID] = v
+		} else if v.Hash != hash {
+			v.Hash = hash
+			v.Sequence++
+		}
+
+		v.Seen = now
+		w.Sequence = v.Sequence
+	}
+
+	for uid, v := range s.Events {
+		if now.Sub(v.Seen) > StateEventsMaxAge {
+			delete(s.Events, uid)
+		}
+	}
+}
+
+// checkCount compares the number of parsed workouts to the average of the
+// recent runs and returns an error if it deviates by more than threshold
+// percent. A partial parse failure often still produces some workouts, this
+// catches it before they are published.
+func (s *State) checkCount(parsed int, threshold float64) error {
+	if threshold <= 0 || len(s.Runs) == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, r := range s.Runs {
+		total += r.Parsed
+	}
+
+	avg := float64(total) / float64(len(s.Runs))
+	if avg == 0 {
+		return nil
+	}
+
+	deviation := math.Abs(float64(parsed)-avg) / avg * 100
+	if deviation > threshold {
+		return fmt.Errorf("parsed %d workouts, %.0f%% off the average of %.1f over the last %d runs", parsed, deviation, avg, len(s.Runs))
+	}
+
+	return nil
+}
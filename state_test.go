@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCount(t *testing.T) {
+	state := &State{}
+	for _, n := range []int{100, 90, 110, 100} {
+		state.record(RunRecord{Parsed: n})
+	}
+
+	for _, tc := range []struct {
+		parsed    int
+		threshold float64
+		err       string
+	}{
+		{100, 20, ""},
+		{80, 20, ""},
+		{120, 20, ""},
+		{121, 20, "parsed 121 workouts, 21% off the average of 100.0 over the last 4 runs"},
+		{50, 20, "parsed 50 workouts, 50% off the average of 100.0 over the last 4 runs"},
+		{150, 20, "parsed 150 workouts, 50% off the average of 100.0 over the last 4 runs"},
+		{0, 20, "parsed 0 workouts, 100% off the average of 100.0 over the last 4 runs"},
+		// Disabled
+		{0, 0, ""},
+	} {
+		err := state.checkCount(tc.parsed, tc.threshold)
+		if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%d, %.0f%%: got %v, want %s", tc.parsed, tc.threshold, err, tc.err)
+		}
+	}
+
+	// Nothing to compare against yet
+	if err := (&State{}).checkCount(0, 20); err != nil {
+		t.Errorf("empty state: got %v", err)
+	}
+	if err := (&State{Runs: []RunRecord{{Parsed: 0}}}).checkCount(10, 20); err != nil {
+		t.Errorf("no workouts in past runs: got %v", err)
+	}
+}
+
+func TestStateRecord(t *testing.T) {
+	state := &State{}
+	for i := 1; i <= StateRuns+2; i++ {
+		state.record(RunRecord{Parsed: i})
+	}
+
+	if len(state.Runs) != StateRuns {
+		t.Fatalf("got %d runs, want %d", len(state.Runs), StateRuns)
+	}
+	if first, last := state.Runs[0].Parsed, state.Runs[StateRuns-1].Parsed; first != 3 || last != StateRuns+2 {
+		t.Errorf("got runs %d to %d, want 3 to %d", first, last, StateRuns+2)
+	}
+}
+
+func TestStateSave(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := loadState(fname)
+	if err != nil {
+		t.Fatalf("missing state: %v", err)
+	}
+	if len(state.Runs) != 0 {
+		t.Errorf("missing state: got %d runs", len(state.Runs))
+	}
+
+	state.record(RunRecord{Time: time.Date(2026, time.March, 1, 6, 0, 0, 0, time.UTC), Parsed: 42})
+	if err := state.save(fname); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadState(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("got %+v, want %+v", loaded, state)
+	}
+
+	if err := state.save(filepath.Join(fname, "state.json")); err == nil {
+		t.Error("got no error saving under a file")
+	}
+	if _, err := loadState(filepath.Join(fname, "state.json")); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("got %v, want an error loading from under a file", err)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 6, 0, 0, 0, time.UTC)
+	now := start.AddDate(0, -1, 0)
+
+	swim := &Workout{UID: "swim", Summary: "Swim", Start: start, End: start.Add(time.Hour)}
+	run := &Workout{UID: "run", Summary: "Run", Start: start, End: start.Add(time.Hour)}
+
+	state := &State{}
+	state.sequence([]*Workout{swim, run}, now)
+	if swim.Sequence != 0 || run.Sequence != 0 {
+		t.Errorf("got sequences %d and %d for new events, want 0", swim.Sequence, run.Sequence)
+	}
+
+	// Only the changed workout is bumped, and again for every change
+	for i, summary := range []string{"Track", "Track & Run"} {
+		swim = &Workout{UID: "swim", Summary: "Swim", Start: start, End: start.Add(time.Hour)}
+		run = &Workout{UID: "run", Summary: summary, Start: start, End: start.Add(time.Hour)}
+
+		state.sequence([]*Workout{swim, run}, now)
+		if swim.Sequence != 0 || run.Sequence != i+1 {
+			t.Errorf("%s: got sequences %d and %d, want 0 and %d", summary, swim.Sequence, run.Sequence, i+1)
+		}
+	}
+
+	// Events that haven't been seen in a while are forgotten
+	state.sequence([]*Workout{swim}, now.Add(StateEventsMaxAge))
+	if _, ok := state.Events["run"]; !ok {
+		t.Error("forgot the run too early")
+	}
+	state.sequence([]*Workout{swim}, now.Add(StateEventsMaxAge+time.Hour))
+	if _, ok := state.Events["run"]; ok {
+		t.Error("didn't forget the run")
+	}
+}
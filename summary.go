@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// RunSummary is the machine-readable summary of a run written to
+// -summary-out so that CI and monitoring can check on run health.
+type RunSummary struct {
+	Start time.Time `json:"start"`
+
+	// Durations of each phase of the run, in seconds
+	Durations map[string]float64 `json:"durations"`
+
+	// Counts of pages fetched, workouts parsed, events written, and events
+	// synced
+	Fetched int `json:"fetched"`
+	Parsed  int `json:"parsed"`
+	Written int `json:"written"`
+	Synced  int `json:"synced"`
+
+	Warnings []string `json:"warnings"`
+
+	// Stale lists the pages that couldn't be fetched and were parsed from
+	// -cache-dir instead
+	Stale []string `json:"stale,omitempty"`
+
+	// Staleness is how many seconds old the calendar served by serve is,
+	// set when the refresh failed and the last good calendar is served
+	Staleness float64 `json:"staleness,omitempty"`
+
+	// Targets is the status of each target published to
+	Targets []TargetStatus `json:"targets"`
+
+	// Error is set if the run failed
+	Error string `json:"error,omitempty"`
+}
+
+// runSummary is the summary for the current run.
+var runSummary = newRunSummary()
+
+// newRunSummary returns an empty summary for a run starting now.
+func newRunSummary() *RunSummary {
+	return &RunSummary{
+		Start:     time.Now(),
+		Durations: map[string]float64{},
+		Warnings:  []string{},
+		Targets:   []TargetStatus{},
+	}
+}
+
+// warningsMu guards runSummary.Warnings, warnf is called by the parsers
+// which may run concurrently.
+var warningsMu sync.Mutex
+
+// warnf logs a warning and records it in the run summary.
+func warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	log.Print(msg)
+
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+
+	runSummary.Warnings = append(runSummary.Warnings, msg)
+}
+
+// phase records the duration of the named phase that began at start.
+func (s *RunSummary) phase(name string, start time.Time) {
+	s.Durations[name] += time.Since(start).Seconds()
+}
+
+// write saves the summary to fname. Noop if fname is empty.
+func (s *RunSummary) write(fname string) error {
+	if fname == "" {
+		return nil
+	}
+
+	s.Durations["total"] = time.Since(s.Start).Seconds()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(fname, append(b, '\n'), 0644)
+}
+
+// fail notifies about the error, records it in the run summary, and writes
+// and pushes the summary. Notifications held for quiet hours are saved in the
+// -state, as the run won't get to save it.
+func fail(err error) {
+	notify(errorNotification(err))
+	persistHeld()
+
+	runSummary.Error = err.Error()
+	if err := runSummary.write(*summaryOut); err != nil {
+		log.Print(err)
+	}
+
+	if err := runSummary.push(*pushgateway, *pushgatewayJob); err != nil {
+		log.Print(err)
+	}
+}
+
+// fatal records the error in the run summary, writes the summary, and exits.
+func fatal(err error) {
+	fail(err)
+
+	log.Fatal(err)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Coordinates used for sunset times when the config doesn't set them, the
+// middle of the Tri-Valley. Sunset varies by well under a minute across the
+// area, so one location is good enough for every venue.
+const (
+	DefaultLatitude  = 37.6624
+	DefaultLongitude = -121.8747
+)
+
+// DefaultOutdoorTypes are the workout types that need lights after sunset.
+var DefaultOutdoorTypes = []string{"bike", "run"}
+
+// Daylight configures the sunset notes added by -lights.
+type Daylight struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Types     []string `json:"types"`
+}
+
+// zenith of the sun at sunset, accounting for refraction and its radius
+const sunsetZenith = 90.833
+
+// sunset returns the time of sunset on date's day at the coordinates, using
+// the algorithm from the Almanac for Computers (1990). Returns false if the
+// sun doesn't set that day.
+func sunset(date time.Time, lat, lon float64) (time.Time, bool) {
+	rad := math.Pi / 180
+
+	lngHour := lon / 15
+	t := float64(date.YearDay()) + (18-lngHour)/24
+
+	// Sun's mean anomaly and true longitude
+	m := 0.9856*t - 3.289
+	l := math.Mod(m+1.916*math.Sin(m*rad)+0.020*math.Sin(2*m*rad)+282.634+360, 360)
+
+	// Right ascension, in the same quadrant as l, in hours
+	ra := math.Mod(math.Atan(0.91764*math.Tan(l*rad))/rad+360, 360)
+	ra += math.Floor(l/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	// Declination and local hour angle
+	sinDec := 0.39782 * math.Sin(l*rad)
+	cosDec := math.Cos(math.Asin(sinDec))
+	cosH := (math.Cos(sunsetZenith*rad) - sinDec*math.Sin(lat*rad)) / (cosDec * math.Cos(lat*rad))
+	if cosH < -1 || cosH > 1 {
+		return time.Time{}, false
+	}
+
+	h := math.Acos(cosH) / rad / 15
+
+	ut := math.Mod(h+ra-0.06571*t-6.622-lngHour+48, 24)
+
+	// ut is the time of day in UTC, find the one that falls on date's day
+	// in its own timezone
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	res := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC).Add(time.Duration(ut * float64(time.Hour)))
+	for res.Before(day) {
+		res = res.Add(24 * time.Hour)
+	}
+	for !res.Before(day.AddDate(0, 0, 1)) {
+		res = res.Add(-24 * time.Hour)
+	}
+
+	return res.In(date.Location()), true
+}
+
+// noteLights adds a note to the description of outdoor workouts that end
+// after sunset.
+func noteLights(workouts []*Workout, daylight Daylight, locale string) {
+	lat, lon := daylight.Latitude, daylight.Longitude
+	if lat == 0 && lon == 0 {
+		lat, lon = DefaultLatitude, DefaultLongitude
+	}
+
+	types := daylight.Types
+	if len(types) == 0 {
+		types = DefaultOutdoorTypes
+	}
+
+	outdoor := map[string]bool{}
+	for _, typ := range types {
+		outdoor[typ] = true
+	}
+
+	for _, w := range workouts {
+		if !outdoor[w.Type] {
+			continue
+		}
+
+		set, ok := sunset(w.Start, lat, lon)
+		if !ok || !w.End.After(set) {
+			continue
+		}
+
+		log.Printf("%s on %s ends after sunset", w.Summary, w.Start.Format("Mon Jan 2 3:04 PM"))
+
+		note := fmt.Sprintf(translate(locale, "Lights required, sunset at %s"), formatDate(locale, "3:04 PM", set))
+		if w.Description != "" {
+			note = w.Description + "\n" + note
+		}
+		w.Description = note
+	}
+}
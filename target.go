@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// ExitPartialFailure is the exit status when some, but not all, of the
+// targets failed.
+const ExitPartialFailure = 3
+
+// Target is somewhere the calendar is published to, such as an output file.
+type Target interface {
+	// Name identifies the target in logs and the run summary
+	Name() string
+
+	// Publish publishes the calendar, recording the number of events written
+	// and the checksum of the output in status, if applicable.
+	Publish(cal *Calendar, status *TargetStatus) error
+}
+
+// TargetStatus is the outcome of publishing to a single target.
+type TargetStatus struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+	Written  int    `json:"written"`
+	Checksum string `json:"checksum,omitempty"`
+
+	// Unchanged is set if the output was identical to what was already
+	// published, so nothing was written
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+// publish publishes the calendar to every target, continuing past failures.
+// The status of each target is recorded in the run summary. Returns the
+// number of targets that failed.
+func publish(targets []Target, cal *Calendar) int {
+	failed := 0
+
+	for _, t := range targets {
+		status := TargetStatus{Name: t.Name()}
+
+		if err := t.Publish(cal, &status); err != nil {
+			log.Printf("%s: %v", t.Name(), err)
+			status.Error = err.Error()
+			failed++
+
+			notify(errorNotification(fmt.Errorf("%s: %v", t.Name(), err)))
+		} else {
+			status.OK = true
+		}
+
+		runSummary.Written += status.Written
+		runSummary.Targets = append(runSummary.Targets, status)
+	}
+
+	return failed
+}
+
+// abandon records that none of the targets were published because of err.
+// Returns the number of targets.
+func abandon(targets []Target, err error) int {
+	log.Print(err)
+	notify(errorNotification(err))
+
+	for _, t := range targets {
+		runSummary.Targets = append(runSummary.Targets, TargetStatus{Name: t.Name(), Error: err.Error()})
+	}
+
+	return len(targets)
+}
+
+// fileTarget writes the calendar to a file.
+type fileTarget struct {
+	fname     string
+	format    string
+	templates *Templates
+
+	// minimal carries forward unchanged events, see minimalUpdate
+	minimal bool
+
+	// dryRun prints the differences from the existing file instead of
+	// writing it, using colors if color is set
+	dryRun bool
+	color  bool
+
+	// maxChanges is the percent of events that may be changed or removed
+	// from the existing file, unless force is set
+	maxChanges float64
+	force      bool
+
+	// changed is called with the changes to the file when it is written, if
+	// set
+	changed func(changes []EventChange)
+
+	// manifest writes a Manifest next to the file, signed with manifestKey
+	// if set
+	manifest    bool
+	manifestKey string
+}
+
+func (t *fileTarget) Name() string {
+	return t.fname
+}
+
+func (t *fileTarget) Publish(cal *Calendar, status *TargetStatus) error {
+	out, err := t.templates.render(cal, t.format)
+	if err != nil {
+		return err
+	}
+
+	if t.format != FormatICal {
+		if t.dryRun {
+			log.Printf("dry run, not writing %s", t.fname)
+			return nil
+		}
+
+		return t.write(out, len(cal.Workouts), status)
+	}
+
+	prev, err := os.ReadFile(t.fname)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if t.minimal && prev != nil {
+		merged, changed, err := minimalUpdate(prev, out)
+		if err != nil {
+			warnf("unable to carry forward events from %s: %v", t.fname, err)
+		} else {
+			log.Printf("%d events new or changed since last run", changed)
+			out = merged
+		}
+	}
+
+	if t.maxChanges > 0 && !t.force && prev != nil {
+		if err := checkChanges(prev, out, t.maxChanges); err != nil {
+			return err
+		}
+	}
+
+	if t.dryRun {
+		changes, err := diffCalendars(prev, out)
+		if err != nil {
+			return err
+		}
+
+		printDiff(os.Stdout, changes, t.color)
+		return nil
+	}
+
+	if err := t.write(out, len(cal.Workouts), status); err != nil {
+		return err
+	}
+
+	if t.changed != nil && !status.Unchanged {
+		changes, err := diffCalendars(prev, out)
+		if err != nil {
+			warnf("unable to diff %s: %v", t.fname, err)
+		} else if len(changes) > 0 {
+			t.changed(changes)
+		}
+	}
+
+	return nil
+}
+
+// write saves the output with writeFile along with its manifest. The manifest
+// is written even if the output is unchanged to record that it is current.
+func (t *fileTarget) write(out []byte, events int, status *TargetStatus) error {
+	if err := writeFile(t.fname, out, events, status); err != nil {
+		return err
+	}
+
+	if !t.manifest {
+		return nil
+	}
+
+	return newManifest(t.fname, out, time.Now(), t.manifestKey).write(t.fname)
+}
+
+// writeFile saves the rendered output and records the number of events
+// written. If the file already has the same content, it is left alone so
+// that its modification time, and anything watching it, isn't disturbed.
+func writeFile(fname string, out []byte, events int, status *TargetStatus) error {
+	sum := sha256.Sum256(out)
+	status.Checksum = fmt.Sprintf("%x", sum)
+
+	if prev, err := os.ReadFile(fname); err == nil && sha256.Sum256(prev) == sum {
+		log.Printf("%s: no change", fname)
+		status.Unchanged = true
+		return nil
+	}
+
+	if err := writeAtomic(fname, out, 0644); err != nil {
+		return err
+	}
+
+	status.Written = events
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteFile checks that outputs are replaced whole, without leaving the
+// temporary file behind, and are left alone when unchanged.
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "tvtc.ics")
+
+	for i, tc := range []struct {
+		out       string
+		unchanged bool
+	}{
+		{"BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", false},
+		{"BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", true},
+		{"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nEND:VCALENDAR\r\n", false},
+	} {
+		var status TargetStatus
+		if err := writeFile(fname, []byte(tc.out), 1, &status); err != nil {
+			t.Fatal(err)
+		}
+
+		if status.Unchanged != tc.unchanged {
+			t.Errorf("write %d: got unchanged %v, want %v", i, status.Unchanged, tc.unchanged)
+		}
+
+		b, err := os.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.out {
+			t.Errorf("write %d: got %q", i, b)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("write %d: got %d files, want only %s", i, len(entries), fname)
+		}
+	}
+
+	// The directory must exist, nothing is written on failure
+	if err := writeFile(filepath.Join(dir, "missing", "tvtc.ics"), []byte("x"), 1, &TargetStatus{}); err == nil {
+		t.Error("got no error for a missing directory")
+	}
+}
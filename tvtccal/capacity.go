@@ -0,0 +1,50 @@
+package tvtccal
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patterns for signup limits in the calendar text.
+var (
+	// capacityLimit matches e.g. "Limited to 20 riders", "Max 12", or
+	// "Capacity: 30"
+	capacityLimit = regexp.MustCompile(`(?i)\b(?:limited to|max(?:imum)?(?: of)?|capacity:?)\s+(\d+)\b`)
+
+	// capacityRemaining matches e.g. "5 spots remaining" or "no spaces left"
+	capacityRemaining = regexp.MustCompile(`(?i)\b(\d+|no)\s+(?:spots?|spaces?|places?|slots?)\s+(?:remaining|left|available|open)\b`)
+
+	// capacityFull matches sessions that are marked as full
+	capacityFull = regexp.MustCompile(`(?i)\b(?:sold out|waitlist only|session full|class full)\b|\(full\)`)
+)
+
+// isCapacityLine reports whether the line is about the signup limits of a
+// workout rather than the start of the next workout.
+func isCapacityLine(line string) bool {
+	return capacityLimit.MatchString(line) || capacityRemaining.MatchString(line)
+}
+
+// Capacity parses the signup limit and the number of spots remaining from the
+// text of a workout. The limit is zero if unlimited or unknown and remaining is
+// nil if unknown.
+func Capacity(text string) (int, *int) {
+	limit := 0
+	if m := capacityLimit.FindStringSubmatch(text); m != nil {
+		limit, _ = strconv.Atoi(m[1])
+	}
+
+	var remaining *int
+	if m := capacityRemaining.FindStringSubmatch(text); m != nil {
+		n := 0
+		if !strings.EqualFold(m[1], "no") {
+			n, _ = strconv.Atoi(m[1])
+		}
+		remaining = &n
+	} else if capacityFull.MatchString(text) {
+		n := 0
+		remaining = &n
+	}
+
+	return limit, remaining
+}
@@ -0,0 +1,108 @@
+package tvtccal
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Helpers for walking the html.Node tree of the calendar page.
+
+// isElement reports whether n is an element with the given tag.
+func isElement(n *html.Node, tag string) bool {
+	return n.Type == html.ElementNode && n.Data == tag
+}
+
+// attr returns the value of the attribute of n, or "" if it isn't set.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+// textContent returns the text of n and all its descendants.
+func textContent(n *html.Node) string {
+	var b bytes.Buffer
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		// Only the link matters, its text is usually just "Sign up"
+		if href := attr(n, "href"); isElement(n, "a") && signupLink.MatchString(href) {
+			b.WriteString(" " + href + " ")
+			return
+		}
+
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return b.String()
+}
+
+// blockElements start a new line in textLines.
+var blockElements = map[string]bool{
+	"br": true, "div": true, "p": true, "li": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// textLines returns the non-empty lines of text in n, split at newlines and
+// at <br> and block elements, with runs of whitespace (including non-breaking
+// spaces) collapsed to a single space. Inline elements such as spans don't
+// affect the lines. Signup links, see SignupURL, are replaced by their
+// href.
+func textLines(n *html.Node) []string {
+	var lines []string
+	var b bytes.Buffer
+
+	flush := func() {
+		if s := strings.Join(strings.Fields(b.String()), " "); s != "" {
+			lines = append(lines, s)
+		}
+		b.Reset()
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		block := n.Type == html.ElementNode && blockElements[n.Data]
+		if block {
+			flush()
+		}
+
+		// Only the link matters, its text is usually just "Sign up"
+		if href := attr(n, "href"); isElement(n, "a") && signupLink.MatchString(href) {
+			b.WriteString(" " + href + " ")
+			return
+		}
+
+		if n.Type == html.TextNode {
+			parts := strings.Split(n.Data, "\n")
+			for i, part := range parts {
+				if i > 0 {
+					flush()
+				}
+				b.WriteString(part)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if block {
+			flush()
+		}
+	}
+	walk(n)
+	flush()
+
+	return lines
+}
@@ -0,0 +1,54 @@
+package tvtccal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds for durations parsed from the calendar, anything outside is assumed
+// to be a typo.
+const (
+	MinDuration = 10 * time.Minute
+	MaxDuration = 12 * time.Hour
+)
+
+// durationLine matches the optional duration line of a workout.
+var durationLine = regexp.MustCompile(`(?i)^duration:`)
+
+// durationPart matches a single number and unit, e.g. "1.5 hours" or "30 min".
+var durationPart = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(hours?|hrs?|h|minutes?|mins?|m)\b`)
+
+// parseDurationLine parses lines such as "Duration: 2 hours" or "Duration: 1
+// hour 30 minutes".
+func parseDurationLine(line string) (time.Duration, error) {
+	v := strings.TrimSpace(line[len("duration:"):])
+
+	matches := durationPart.FindAllStringSubmatch(v, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("unable to parse duration: `%s`", line)
+	}
+
+	var d time.Duration
+	for _, m := range matches {
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse duration: `%s`", line)
+		}
+
+		unit := time.Minute
+		if strings.HasPrefix(strings.ToLower(m[2]), "h") {
+			unit = time.Hour
+		}
+
+		d += time.Duration(n * float64(unit))
+	}
+
+	if d < MinDuration || d > MaxDuration {
+		return 0, fmt.Errorf("duration out of bounds (%v to %v): `%s`", MinDuration, MaxDuration, line)
+	}
+
+	return d, nil
+}
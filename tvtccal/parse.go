@@ -0,0 +1,382 @@
+// Package tvtccal parses the workouts from the Tri-Valley Triathlon Club
+// calendar, see the tvtccal command for turning them into calendar files.
+package tvtccal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// CalendarURL is the club's calendar page
+	CalendarURL = "http://www.trivalleytriclub.com/calendar"
+
+	// Timezone for calendar, all events on Pacific time
+	Timezone = "America/Los_Angeles"
+
+	// Length of workouts without an explicit duration
+	DefaultDuration = 90 * time.Minute
+)
+
+// Workout is a single workout from the calendar.
+type Workout struct {
+	Summary  string    `json:"summary"`
+	Location string    `json:"location"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+
+	// Description is made up of the extra lines such as signup limits,
+	// optional
+	Description string `json:"description,omitempty"`
+
+	// HasDuration is set if the calendar gave the duration, otherwise End
+	// is DefaultDuration after Start
+	HasDuration bool `json:"has_duration,omitempty"`
+
+	// SignupURL is the registration link, see SignupURL, optional
+	SignupURL string `json:"signup_url,omitempty"`
+}
+
+// ParseOptions override what ParseNode would otherwise infer from the page
+// and the current date. Zero values are inferred.
+type ParseOptions struct {
+	Year  int        `json:"year"`
+	Month time.Month `json:"month"`
+
+	// Location is the timezone of the workouts, defaults to Timezone
+	Location *time.Location `json:"-"`
+
+	// Warnf is called with problems that don't stop the parse, such as
+	// lines that aren't understood, defaults to log.Printf
+	Warnf func(format string, args ...interface{}) `json:"-"`
+
+	// Selectors find the parts of the page, defaults to DefaultSelectors
+	Selectors Selectors `json:"-"`
+}
+
+// parser holds the state shared by a single parse.
+type parser struct {
+	opts ParseOptions
+	sel  *selectors
+}
+
+func (p *parser) warnf(format string, args ...interface{}) {
+	if p.opts.Warnf != nil {
+		p.opts.Warnf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Parse reads a calendar page and returns its workouts, inferring the month
+// and year.
+func Parse(r io.Reader) ([]Workout, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseNode(root, ParseOptions{})
+}
+
+// Fetch downloads the calendar page at url, usually CalendarURL, and returns
+// its workouts.
+func Fetch(ctx context.Context, url string) ([]Workout, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unable to fetch calendar, status code: %d", resp.StatusCode)
+	}
+
+	return Parse(resp.Body)
+}
+
+// calendarTables returns the main tables of the calendar page, by default the
+// tables directly inside <div id="main">.
+func (p *parser) calendarTables(root *html.Node) []*html.Node {
+	return p.sel.table.selectAll([]*html.Node{root})
+}
+
+// cells returns the TDs of a TR, or whatever the cell selector matches.
+func (p *parser) cells(n *html.Node) []*html.Node {
+	return p.sel.cell.selectAll([]*html.Node{n})
+}
+
+// parseMonth extracts the month from the caption inside the main table
+func (p *parser) parseMonth(root *html.Node) (time.Month, error) {
+	captions := p.sel.caption.selectAll(p.calendarTables(root))
+	if len(captions) == 0 {
+		return 0, errors.New("failed to find month")
+	}
+
+	val := textContent(captions[0])
+
+	month := strings.TrimSpace(strings.Split(val, " ")[0])
+	for i := 1; i <= 12; i++ {
+		if time.Month(i).String() == month {
+			return time.Month(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid month: `%s`", month)
+}
+
+// parseDayOfMonth finds the number in the first TD of a TR containing days of
+// the month.
+func (p *parser) parseDayOfMonth(n *html.Node) (int, error) {
+	tds := p.cells(n)
+	if len(tds) == 0 {
+		return 0, errors.New("failed to find day")
+	}
+
+	val := textContent(tds[0])
+
+	parts := strings.Fields(val)
+	if len(parts) == 0 {
+		return 0, errors.New("failed to find day")
+	}
+
+	d, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse day: `%s`", val)
+	}
+
+	return d, nil
+}
+
+// parseWorkoutRow handles a TR containing workouts. Advances base by one day
+// per TD as each TD contains all the workouts for a single day.
+//
+// days are the days of the month shown for each TD, if base doesn't match
+// them it is moved to the closest date that does.
+func (p *parser) parseWorkoutRow(base *time.Time, n *html.Node, days []int) []Workout {
+	workouts := []Workout{}
+
+	for i, td := range p.cells(n) {
+		if i < len(days) && days[i] != 0 && days[i] != base.Day() {
+			p.warnf("lost track of the days, expected %s but the calendar shows day %d", base.Format("Jan 2"), days[i])
+			*base = syncDay(*base, days[i])
+		}
+
+		workouts = append(workouts, p.parseWorkouts(*base, td)...)
+		*base = base.AddDate(0, 0, 1)
+	}
+
+	return workouts
+}
+
+// startTime matches the line with the start time of a workout, e.g. "6:30 PM".
+var startTime = regexp.MustCompile(`^(\d{1,2}):(\d{2}) (AM|PM)$`)
+
+// parseWorkouts handles all workouts for a single day. Each workout is a line
+// with the summary, three lines for the location, the start time and then
+// optional lines such as "Duration: 2 hours", "Limited to 20 riders", or a
+// signup link.
+func (p *parser) parseWorkouts(base time.Time, n *html.Node) []Workout {
+	var workouts []Workout
+
+	// Lines seen since the last start time, the extra lines of the previous
+	// workout followed by the summary and location of the next one
+	var pending []string
+
+	extras := func(w *Workout, lines []string) {
+		var notes []string
+		for _, extra := range lines {
+			// The rest of a line with a signup link is usually "Sign up
+			// here", unless it is also about the signup limits
+			if u := SignupURL(extra); u != "" {
+				if w.SignupURL == "" {
+					w.SignupURL = u
+				}
+				if extra, _ = cutSignupURL(extra); !isCapacityLine(extra) {
+					continue
+				}
+			}
+
+			if durationLine.MatchString(extra) {
+				d, err := parseDurationLine(extra)
+				if err != nil {
+					p.warnf("%v", err)
+				} else {
+					w.End = w.Start.Add(d)
+					w.HasDuration = true
+				}
+			} else if isCapacityLine(extra) {
+				notes = append(notes, extra)
+			} else {
+				p.warnf("ignoring unexpected line for %s: `%s`", w.Summary, extra)
+			}
+		}
+		w.Description = strings.Join(notes, "\n")
+	}
+
+	for _, line := range textLines(n) {
+		if !startTime.MatchString(line) {
+			pending = append(pending, line)
+			continue
+		}
+
+		if len(pending) < 4 {
+			p.warnf("expected a summary and location before: `%s`", line)
+			return nil
+		}
+
+		// Links in the summary or location, e.g. "Swim Clinic (sign up:
+		// https://...)", are kept out of them
+		var signup string
+		header := append([]string{}, pending[len(pending)-4:]...)
+		for i := range header {
+			var u string
+			if header[i], u = cutSignupURL(header[i]); signup == "" {
+				signup = u
+			}
+		}
+
+		if len(workouts) > 0 {
+			extras(&workouts[len(workouts)-1], pending[:len(pending)-4])
+		} else if len(pending) > 4 {
+			p.warnf("ignoring unexpected lines: `%s`", strings.Join(pending[:len(pending)-4], " / "))
+		}
+		pending = nil
+
+		m := startTime.FindStringSubmatch(line)
+		hour, _ := strconv.Atoi(m[1])
+		min, _ := strconv.Atoi(m[2])
+
+		// 12:00 AM is midnight and 12:00 PM is noon
+		hour %= 12
+		if m[3] == "PM" {
+			hour += 12
+		}
+
+		// Create the precise start date so that it should handle daylight savings
+		start := time.Date(
+			base.Year(), base.Month(), base.Day(), // Only care about date from base
+			hour, min, // Parsed from HTML
+			0, 0, // Seconds/nanoseconds
+			base.Location(), // and its timezone
+		)
+
+		workouts = append(workouts, Workout{
+			Summary:   header[0],
+			Location:  strings.Join(header[1:], ", "),
+			Start:     start,
+			End:       start.Add(DefaultDuration),
+			SignupURL: signup,
+		})
+	}
+
+	if len(workouts) > 0 {
+		extras(&workouts[len(workouts)-1], pending)
+	} else if len(pending) > 0 {
+		p.warnf("no start time found in: `%s`", strings.Join(pending, " / "))
+	}
+
+	return workouts
+}
+
+// Page is a parsed calendar page.
+type Page struct {
+	// Year and Month of the page, from ParseOptions or inferred. The first
+	// and last weeks may have workouts from the adjacent months.
+	Year  int
+	Month time.Month
+
+	Workouts []Workout
+}
+
+// ParseNode extracts all the workouts from the main table of a parsed
+// calendar page.
+func ParseNode(root *html.Node, opts ParseOptions) ([]Workout, error) {
+	page, err := ParsePage(root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Workouts, nil
+}
+
+// ParsePage is ParseNode that also returns the month and year of the page.
+func ParsePage(root *html.Node, opts ParseOptions) (*Page, error) {
+	sel, err := opts.Selectors.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{opts: opts, sel: sel}
+
+	var base time.Time
+	var workouts []Workout
+
+	now := time.Now()
+
+	month := opts.Month
+	if month == 0 {
+		if month, err = p.parseMonth(root); err != nil {
+			return nil, err
+		}
+	}
+
+	year := opts.Year
+	if year == 0 {
+		year = now.Year()
+		if month == time.December && now.Month() == time.January {
+			// On last week of the year
+			year -= 1
+		}
+	}
+
+	loc := opts.Location
+	if loc == nil {
+		loc, err = time.LoadLocation(Timezone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var days []int
+
+	rows := p.sel.row.selectAll(p.calendarTables(root))
+	for i, node := range rows {
+		if i == 0 {
+			day, err := p.parseDayOfMonth(node)
+			if err != nil {
+				return nil, err
+			}
+
+			base = time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+			// The first week may start with the last days of the previous month
+			if day > 21 {
+				base = base.AddDate(0, -1, 0)
+			}
+		}
+
+		if i%2 == 0 {
+			days = p.parseDayNumbers(node)
+		} else {
+			workouts = append(workouts, p.parseWorkoutRow(&base, node, days)...)
+		}
+	}
+
+	return &Page{Year: year, Month: month, Workouts: p.checkDates(workouts, year, month, loc)}, nil
+}
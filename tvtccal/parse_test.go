@@ -0,0 +1,198 @@
+package tvtccal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// calendarPage returns a calendar page with a single week, the days and the
+// workouts of each day, in the club's markup.
+func calendarPage(caption string, days []string, cells []string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<html><body><div id="main"><table><caption>%s</caption><tr>`, caption)
+	for _, day := range days {
+		fmt.Fprintf(&b, "<td>%s</td>", day)
+	}
+	b.WriteString("</tr><tr>")
+	for _, cell := range cells {
+		fmt.Fprintf(&b, "<td>%s</td>", cell)
+	}
+	b.WriteString("</tr></table></div></body></html>")
+
+	return b.String()
+}
+
+// workoutCell returns the lines of a workout in a day's cell.
+func workoutCell(summary, start string, extras ...string) string {
+	lines := append([]string{summary, "Pool", "Dublin", "CA", start}, extras...)
+	return "\n" + strings.Join(lines, "\n\n") + "\n"
+}
+
+func parsePage(t *testing.T, page string) []Workout {
+	t.Helper()
+
+	root, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workouts, err := ParseNode(root, ParseOptions{Year: 2026})
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+
+	return workouts
+}
+
+func TestParseNoonAndMidnight(t *testing.T) {
+	page := calendarPage("November 2026", []string{"Sun 1", "Mon 2"}, []string{
+		workoutCell("Noon Swim", "12:00 PM") + workoutCell("Lunch Run", "12:30 PM"),
+		workoutCell("Midnight Ride", "12:15 AM") + workoutCell("Early Swim", "1:00 AM"),
+	})
+
+	want := []string{
+		"2026-11-01 12:00 Noon Swim",
+		"2026-11-01 12:30 Lunch Run",
+		"2026-11-02 00:15 Midnight Ride",
+		"2026-11-02 01:00 Early Swim",
+	}
+
+	workouts := parsePage(t, page)
+	if len(workouts) != len(want) {
+		t.Fatalf("got %d workouts, want %d", len(workouts), len(want))
+	}
+
+	for i, w := range workouts {
+		if got := w.Start.Format("2006-01-02 15:04") + " " + w.Summary; got != want[i] {
+			t.Errorf("workout %d: got %q, want %q", i, got, want[i])
+		}
+		if w.Start.Location().String() != Timezone {
+			t.Errorf("workout %d: got location %v, want %s", i, w.Start.Location(), Timezone)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	page := calendarPage("March 2026", []string{"Sun 1"}, []string{
+		workoutCell("Track & Run", "6:00 AM", "Duration: 1 hour"),
+	})
+
+	workouts := parsePage(t, page)
+	if len(workouts) != 1 {
+		t.Fatalf("got %d workouts, want 1", len(workouts))
+	}
+
+	if d := workouts[0].End.Sub(workouts[0].Start); d != time.Hour || !workouts[0].HasDuration {
+		t.Errorf("got duration %v (has duration %v), want 1h", d, workouts[0].HasDuration)
+	}
+}
+
+// TestParsePage checks that a page whose first week starts in the previous
+// month has the page's month, not the first workout's.
+func TestParsePage(t *testing.T) {
+	page := calendarPage("October 2026", []string{"Sun 27", "Mon 28", "Thu 1"}, []string{
+		workoutCell("Masters Swim", "6:00 AM"),
+		"",
+		workoutCell("Track Run", "6:00 PM"),
+	})
+
+	root, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		opts  ParseOptions
+		year  int
+		month time.Month
+	}{
+		{ParseOptions{Year: 2026}, 2026, time.October},
+		{ParseOptions{Year: 2026, Month: time.November}, 2026, time.November},
+	} {
+		p, err := ParsePage(root, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Year != tc.year || p.Month != tc.month {
+			t.Errorf("%+v: got %d %v, want %d %v", tc.opts, p.Year, p.Month, tc.year, tc.month)
+		}
+	}
+
+	p, err := ParsePage(root, ParseOptions{Year: 2026})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Workouts) != 2 || p.Workouts[0].Start.Month() != time.September {
+		t.Errorf("got workouts %+v, want the first in September", p.Workouts)
+	}
+}
+
+// TestParseDST checks the weeks that daylight saving time starts and ends in,
+// every day after the transition on Sunday must keep its date and local start
+// time.
+func TestParseDST(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		first   string
+		offset  string
+	}{
+		// Starts at 2 AM on Sunday March 8
+		{"testdata/dst-march.html", "2026-03-08", "-0700"},
+		// Ends at 2 AM on Sunday November 1
+		{"testdata/dst-november.html", "2026-11-01", "-0800"},
+	} {
+		t.Run(tc.fixture, func(t *testing.T) {
+			f, err := os.Open(tc.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			root, err := html.Parse(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Losing track of the days is corrected, but with a warning
+			var warnings []string
+			workouts, err := ParseNode(root, ParseOptions{Year: 2026, Warnf: func(format string, args ...interface{}) {
+				warnings = append(warnings, fmt.Sprintf(format, args...))
+			}})
+			if err != nil {
+				t.Fatalf("unable to parse: %v", err)
+			}
+
+			if len(warnings) > 0 {
+				t.Errorf("got warnings: %s", strings.Join(warnings, "; "))
+			}
+
+			if len(workouts) != 7 {
+				t.Fatalf("got %d workouts, want 7", len(workouts))
+			}
+
+			first, _ := time.Parse("2006-01-02", tc.first)
+			for i, w := range workouts {
+				clock := "06:00"
+				if i%2 == 1 {
+					clock = "18:30"
+				}
+
+				want := first.AddDate(0, 0, i).Format("2006-01-02") + " " + clock + " " + tc.offset
+				if got := w.Start.Format("2006-01-02 15:04 -0700"); got != want {
+					t.Errorf("%s: got %s, want %s", w.Summary, got, want)
+				}
+			}
+
+			if d := workouts[1].End.Sub(workouts[1].Start); d != time.Hour {
+				t.Errorf("%s: got duration %v, want 1h", workouts[1].Summary, d)
+			}
+		})
+	}
+}
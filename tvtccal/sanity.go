@@ -0,0 +1,76 @@
+package tvtccal
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// MonthSlack is how far outside of the calendar's month workouts may fall,
+// the first and last weeks of the grid include days of the adjacent months.
+const MonthSlack = 7 * 24 * time.Hour
+
+// parseDayNumbers returns the day of the month shown in each TD of a TR
+// containing days of the month, zero if a TD doesn't have one.
+func (p *parser) parseDayNumbers(n *html.Node) []int {
+	var days []int
+
+	for _, td := range p.cells(n) {
+		parts := strings.Fields(textContent(td))
+
+		d := 0
+		if len(parts) > 0 {
+			d, _ = strconv.Atoi(parts[len(parts)-1])
+		}
+		days = append(days, d)
+	}
+
+	return days
+}
+
+// syncDay returns the date closest to base that falls on the given day of
+// the month, used to get back in step with the days shown in the calendar.
+func syncDay(base time.Time, day int) time.Time {
+	best := base
+	for _, months := range []int{-1, 0, 1} {
+		t := time.Date(base.Year(), base.Month()+time.Month(months), day, 0, 0, 0, 0, base.Location())
+		if t.Day() != day {
+			// e.g. the 31st of a shorter month
+			continue
+		}
+
+		if best == base || abs64(t.Sub(base)) < abs64(best.Sub(base)) {
+			best = t
+		}
+	}
+
+	return best
+}
+
+// checkDates drops workouts that are dated outside of the calendar's month,
+// give or take MonthSlack, with a warning.
+func (p *parser) checkDates(workouts []Workout, year int, month time.Month, loc *time.Location) []Workout {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	start := first.Add(-MonthSlack)
+	end := first.AddDate(0, 1, 0).Add(MonthSlack)
+
+	var res []Workout
+	for _, w := range workouts {
+		if w.Start.Before(start) || !w.Start.Before(end) {
+			p.warnf("dropping %s on %s, outside of %s %d", w.Summary, w.Start.Format("2006-01-02"), month, year)
+			continue
+		}
+		res = append(res, w)
+	}
+
+	return res
+}
+
+func abs64(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
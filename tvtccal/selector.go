@@ -0,0 +1,155 @@
+package tvtccal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Selectors are the CSS selectors that find the parts of the calendar page,
+// so that a change to the club's markup can be handled without a new
+// release. Empty selectors default to those in DefaultSelectors.
+//
+// Caption and Row are matched within each table and Cell within each row. A
+// selector that starts with > only matches children of the table or row,
+// e.g. "> td" doesn't match the cells of a table nested inside a cell.
+type Selectors struct {
+	// Table matches the tables of the calendar
+	Table string `json:"table,omitempty"`
+
+	// Caption matches the caption with the month, e.g. "March 2015"
+	Caption string `json:"caption,omitempty"`
+
+	// Row matches the rows of the calendar, which alternate between the
+	// days of the month and their workouts
+	Row string `json:"row,omitempty"`
+
+	// Cell matches the cells of a row, one per day
+	Cell string `json:"cell,omitempty"`
+}
+
+// DefaultSelectors match the club's calendar page.
+var DefaultSelectors = Selectors{
+	Table:   "div#main > table",
+	Caption: "> caption",
+	Row:     "> tbody > tr",
+	Cell:    "> td",
+}
+
+// selectors are the compiled Selectors of a parse.
+type selectors struct {
+	table, caption, row, cell *selector
+}
+
+// compile compiles the selectors, substituting the defaults for empty ones.
+func (s Selectors) compile() (*selectors, error) {
+	var res selectors
+
+	for _, v := range []struct {
+		name     string
+		src, def string
+		dst      **selector
+	}{
+		{"table", s.Table, DefaultSelectors.Table, &res.table},
+		{"caption", s.Caption, DefaultSelectors.Caption, &res.caption},
+		{"row", s.Row, DefaultSelectors.Row, &res.row},
+		{"cell", s.Cell, DefaultSelectors.Cell, &res.cell},
+	} {
+		src := v.src
+		if src == "" {
+			src = v.def
+		}
+
+		sel, err := compileSelector(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s selector: %v", v.name, err)
+		}
+
+		// The tables are matched within the page, there is nothing for a
+		// leading > to be relative to
+		if v.dst == &res.table && sel.doc == nil {
+			return nil, fmt.Errorf("invalid table selector: can't start with `>`: `%s`", src)
+		}
+		*v.dst = sel
+	}
+
+	return &res, nil
+}
+
+// Check returns an error if any of the selectors is invalid.
+func (s Selectors) Check() error {
+	_, err := s.compile()
+	return err
+}
+
+// scopeAttr marks the table or row that a selector is matched within, see
+// selectAll.
+const scopeAttr = "data-tvtccal-scope"
+
+// selector is a compiled CSS selector, see cascadia for the syntax. Within a
+// table or row, the selector only matches descendants and a leading > only
+// matches children, as if each selector in the list started with the scope.
+type selector struct {
+	// scoped is matched within an element, doc within the page. doc is nil
+	// if any selector in the list starts with >.
+	scoped, doc cascadia.Selector
+}
+
+// compileSelector parses a selector.
+func compileSelector(s string) (*selector, error) {
+	var scoped, doc []string
+	child := false
+
+	for _, alt := range strings.Split(s, ",") {
+		alt = strings.TrimSpace(alt)
+
+		scope := "[" + scopeAttr + "] "
+		if strings.HasPrefix(alt, ">") {
+			alt = strings.TrimSpace(alt[1:])
+			scope += "> "
+			child = true
+		}
+
+		if _, err := cascadia.Compile(alt); err != nil || alt == "" {
+			if err == nil {
+				err = errors.New("empty selector")
+			}
+			return nil, fmt.Errorf("%v: `%s`", err, s)
+		}
+
+		scoped = append(scoped, scope+alt)
+		doc = append(doc, alt)
+	}
+
+	res := &selector{scoped: cascadia.MustCompile(strings.Join(scoped, ", "))}
+	if !child {
+		res.doc = cascadia.MustCompile(strings.Join(doc, ", "))
+	}
+
+	return res, nil
+}
+
+// selectAll returns the descendants of each node that match the selector, in
+// document order. Element nodes are marked with scopeAttr while they are
+// matched within.
+func (s *selector) selectAll(nodes []*html.Node) []*html.Node {
+	var res []*html.Node
+
+	for _, scope := range nodes {
+		if scope.Type != html.ElementNode {
+			if s.doc != nil {
+				res = append(res, s.doc.MatchAll(scope)...)
+			}
+			continue
+		}
+
+		scope.Attr = append(scope.Attr, html.Attribute{Key: scopeAttr})
+		res = append(res, s.scoped.MatchAll(scope)...)
+		scope.Attr = scope.Attr[:len(scope.Attr)-1]
+	}
+
+	return res
+}
@@ -0,0 +1,178 @@
+package tvtccal
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// selectorPage is the DOM the selectors are tested against, every element
+// that a test expects to match has an id.
+const selectorPage = `<html><body>
+<div id="main" class="content wide">
+	<table id="t1" class="calendar" data-month="march">
+		<caption id="c1">March 2026</caption>
+		<tr id="r1"><td id="d1" class="day">Sun 1</td><td id="d2" class="day today">Mon 2</td></tr>
+		<tr id="r2"><td id="d3"><table id="t2"><tr id="r3"><td id="d4" class="day">nested</td></tr></table></td></tr>
+	</table>
+	<p id="p1" lang="en">Notes</p>
+</div>
+<div id="other"><table id="t3" data-month="april"><tr id="r4"><td id="d5">Sun 5</td></tr></table></div>
+</body></html>`
+
+// ids returns the ids of the nodes.
+func ids(nodes []*html.Node) string {
+	var res []string
+	for _, n := range nodes {
+		res = append(res, attr(n, "id"))
+	}
+
+	return strings.Join(res, " ")
+}
+
+func TestSelectors(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(selectorPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		selector string
+		want     string
+	}{
+		// Type, universal, id, class, and attribute selectors
+		{"table", "t1 t2 t3"},
+		{"TABLE", "t1 t2 t3"},
+		{"caption", "c1"},
+		{"#p1", "p1"},
+		{"td#d2", "d2"},
+		{".day", "d1 d2 d4"},
+		{"td.day.today", "d2"},
+		{"div.content.wide", "main"},
+		{".missing", ""},
+		{"[data-month]", "t1 t3"},
+		{"[data-month=april]", "t3"},
+		{`[data-month="march"]`, "t1"},
+		{"[data-month='march']", "t1"},
+		{"table[data-month=march].calendar", "t1"},
+		{"[lang=fr]", ""},
+		{"#r1 > *", "d1 d2"},
+		{"*.day", "d1 d2 d4"},
+
+		// Combinators
+		{"div#main table", "t1 t2"},
+		{"div#main > table", "t1"},
+		{"div#main > table > tbody > tr", "r1 r2"},
+		{"div#main > table td", "d1 d2 d3 d4"},
+		{"table > tbody > tr > td.day", "d1 d2 d4"},
+		{"div  >  p", "p1"},
+		{"#other td", "d5"},
+		{"body > table", ""},
+
+		// Lists, in document order
+		{"#p1, caption", "c1 p1"},
+		{"#d5,#d1", "d1 d5"},
+		{"td.day, .today", "d1 d2 d4"},
+
+		// Pseudo-classes and sibling combinators, from cascadia
+		{"td:first-child", "d1 d3 d4 d5"},
+		{"td + td", "d2"},
+		{"td:not(.day)", "d3 d5"},
+		{"#c1 ~ tbody > tr:nth-child(2)", "r2"},
+	} {
+		sel, err := compileSelector(tc.selector)
+		if err != nil {
+			t.Errorf("%s: unable to compile: %v", tc.selector, err)
+			continue
+		}
+
+		if got := ids(sel.selectAll([]*html.Node{root})); got != tc.want {
+			t.Errorf("%s: got `%s`, want `%s`", tc.selector, got, tc.want)
+		}
+	}
+}
+
+// TestSelectorsScoped checks the selectors that are matched within each table
+// or row, only looking at the ancestors inside them.
+func TestSelectorsScoped(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(selectorPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := compileSelector("div#main > table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := tables.selectAll([]*html.Node{root})
+
+	for _, tc := range []struct {
+		selector string
+		want     string
+	}{
+		{"> caption", "c1"},
+		{"> tbody > tr", "r1 r2"},
+		{"tr", "r1 r2 r3"},
+		{"> tbody > tr > td", "d1 d2 d3"},
+		{"td", "d1 d2 d3 d4"},
+		{"> td", ""},
+
+		// Ancestors outside of the scope are not matched
+		{"div td", ""},
+		{"table td", "d4"},
+		{"> tbody > tr > td table td", "d4"},
+
+		// Lists can mix both
+		{"> caption, table td", "c1 d4"},
+	} {
+		sel, err := compileSelector(tc.selector)
+		if err != nil {
+			t.Errorf("%s: unable to compile: %v", tc.selector, err)
+			continue
+		}
+
+		if got := ids(sel.selectAll(scope)); got != tc.want {
+			t.Errorf("%s: got `%s`, want `%s`", tc.selector, got, tc.want)
+		}
+	}
+}
+
+func TestSelectorsInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		">",
+		"table >",
+		"div,",
+		"#",
+		"td.",
+		"[data-month",
+		"[]",
+		"[=march]",
+		"[data month]",
+		"td:no-such-class",
+		"td +",
+		"div#main*",
+	} {
+		if _, err := compileSelector(s); err == nil {
+			t.Errorf("%s: got no error", s)
+		}
+	}
+}
+
+func TestSelectorsCheck(t *testing.T) {
+	if err := (Selectors{}).Check(); err != nil {
+		t.Errorf("default selectors: %v", err)
+	}
+
+	err := Selectors{Cell: "td:nth-child(x)"}.Check()
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid cell selector") {
+		t.Errorf("got %v, want an invalid cell selector error", err)
+	}
+
+	// The tables are matched within the page
+	err = Selectors{Table: "> html > body table"}.Check()
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid table selector") {
+		t.Errorf("got %v, want an invalid table selector error", err)
+	}
+}
@@ -0,0 +1,34 @@
+package tvtccal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// signupLink matches the registration links of the signup services the club
+// uses: Eventbrite, SignUpGenius, and Google Forms.
+var signupLink = regexp.MustCompile(`(?i)\bhttps?://(?:[a-z0-9-]+\.)*(?:eventbrite\.[a-z]+(?:\.[a-z]+)?|signupgenius\.com|forms\.gle|docs\.google\.com/forms)(?:/[^\s<>"]*)?`)
+
+// signupLead matches the words that introduce a signup link, e.g. "register
+// at" or "Sign up here:".
+var signupLead = regexp.MustCompile(`(?i)[\s,;:-]*(?:(?:to |please )?(?:register|sign ?up|rsvp|signups?)(?: (?:here|at|with|on|via))?)?[\s,;:-]*$`)
+
+// SignupURL returns the first registration link in the text of a workout, ""
+// if there isn't one.
+func SignupURL(text string) string {
+	return strings.TrimRight(signupLink.FindString(text), ".,;:)")
+}
+
+// cutSignupURL removes the registration link from the line, along with the
+// words and punctuation that introduced it.
+func cutSignupURL(line string) (string, string) {
+	u := SignupURL(line)
+	if u == "" {
+		return line, ""
+	}
+
+	i := strings.Index(line, u)
+	rest := signupLead.ReplaceAllString(line[:i], "") + " " + strings.TrimSpace(strings.TrimLeft(line[i+len(u):], ".,;:)"))
+
+	return strings.Trim(strings.TrimSpace(rest), " -:|()"), u
+}
@@ -0,0 +1,6 @@
+package main
+
+// Embed the timezone database so that time.LoadLocation works in scratch
+// containers and on minimal hosts without zoneinfo. The system database, or
+// the one pointed to by ZONEINFO, is still preferred when present.
+import _ "time/tzdata"
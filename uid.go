@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultUIDNamespace is the UUIDv5 of CalendarURL in the URL namespace,
+// used for -uuid unless the config sets uid_namespace.
+const DefaultUIDNamespace = "b9a4d3cd-4fdb-509a-8d60-b7eedf2a31b1"
+
+// parseUUID parses a UUID in its canonical form.
+func parseUUID(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 || len(s) != 36 {
+		return nil, fmt.Errorf("invalid UUID: %s", s)
+	}
+
+	return b, nil
+}
+
+// uuid5 returns the name-based (SHA-1) UUID of name in the namespace, see
+// RFC 4122 section 4.3.
+func uuid5(namespace []byte, name string) string {
+	h := sha1.New()
+	h.Write(namespace)
+	h.Write([]byte(name))
+	b := h.Sum(nil)[:16]
+
+	b[6] = b[6]&0x0f | 0x50 // version 5
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// eventKey is what identifies a workout across runs.
+func eventKey(w *Workout) string {
+	return w.Start.UTC().Format(ICalTimeFormat) + "-" + w.End.UTC().Format(ICalTimeFormat)
+}
+
+// setContentKeys identifies the workouts by their summary, location, and day
+// instead of their start and end, see -content-uids, so that a rescheduled
+// workout keeps its UID. Workouts with the same summary and location on the
+// same day are numbered in the order they start.
+func setContentKeys(workouts []*Workout) {
+	sorted := append([]*Workout{}, workouts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	seen := map[string]int{}
+
+	for _, w := range sorted {
+		sum := sha256.Sum256([]byte(w.Summary + "\n" + w.Location))
+		key := w.Start.Format("20060102") + "-" + hex.EncodeToString(sum[:8])
+
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key += fmt.Sprintf("-%d", n)
+		}
+
+		w.contentKey = key
+	}
+}
+
+// uidFor returns the UID of the workout. Without a namespace, it is the event
+// key (or content key, see setContentKeys) at the club's domain. With one, it
+// is the UUIDv5 of the key, which is globally unique and safe to use as an
+// object key by sync targets.
+func uidFor(w *Workout, namespace []byte) string {
+	key := eventKey(w)
+	if w.contentKey != "" {
+		key = w.contentKey
+	}
+
+	if namespace == nil {
+		return key + "@trivalleytriclub.com"
+	}
+
+	return uuid5(namespace, key)
+}
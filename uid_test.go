@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUUID5(t *testing.T) {
+	for _, tc := range []struct {
+		namespace, name, want string
+	}{
+		// The DNS and URL namespaces from RFC 4122 Appendix C
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "www.example.com", "2ed6657d-e927-568b-95e1-2665a8aea6a2"},
+		{"6ba7b811-9dad-11d1-80b4-00c04fd430c8", CalendarURL, DefaultUIDNamespace},
+	} {
+		ns, err := parseUUID(tc.namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := uuid5(ns, tc.name); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseUUIDInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"b9a4d3cd4fdb509a8d60b7eedf2a31b1",
+		"b9a4d3cd-4fdb-509a-8d60-b7eedf2a31b",
+		"b9a4d3cd-4fdb-509a-8d60-b7eedf2a31b1-",
+		"z9a4d3cd-4fdb-509a-8d60-b7eedf2a31b1",
+	} {
+		if _, err := parseUUID(s); err == nil {
+			t.Errorf("%s: got no error", s)
+		}
+	}
+}
+
+func TestUIDFor(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 6, 0, 0, 0, time.FixedZone("PST", -8*3600))
+	w := &Workout{Start: start, End: start.Add(time.Hour)}
+
+	if got, want := uidFor(w, nil), "20260302T140000Z-20260302T150000Z@trivalleytriclub.com"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	ns, err := parseUUID(DefaultUIDNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uidFor(w, ns), "be50d623-8c5a-553a-a5f7-f4bd96ce360a"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSetContentKeys(t *testing.T) {
+	loc := time.FixedZone("PST", -8*3600)
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, time.March, day, hour, 0, 0, 0, loc)
+	}
+
+	swim := &Workout{Summary: "Masters Swim", Location: "Pool", Start: at(2, 17), End: at(2, 18)}
+	early := &Workout{Summary: "Masters Swim", Location: "Pool", Start: at(2, 6), End: at(2, 7)}
+	run := &Workout{Summary: "Track", Location: "Pool", Start: at(2, 6), End: at(2, 7)}
+	tuesday := &Workout{Summary: "Masters Swim", Location: "Pool", Start: at(3, 17), End: at(3, 18)}
+
+	setContentKeys([]*Workout{swim, early, run, tuesday})
+
+	// Repeats on the same day are numbered in start order
+	if want := early.contentKey + "-2"; swim.contentKey != want {
+		t.Errorf("got %s for the second swim, want %s", swim.contentKey, want)
+	}
+	if !strings.HasPrefix(early.contentKey, "20260302-") || strings.Count(early.contentKey, "-") != 1 {
+		t.Errorf("got %s for the first swim", early.contentKey)
+	}
+	if run.contentKey == early.contentKey {
+		t.Errorf("got the same key for different summaries: %s", run.contentKey)
+	}
+	if tuesday.contentKey != "20260303"+strings.TrimPrefix(early.contentKey, "20260302") {
+		t.Errorf("got %s for the swim on another day, want the same hash as %s", tuesday.contentKey, early.contentKey)
+	}
+
+	// Rescheduling keeps the UID
+	moved := &Workout{Summary: "Masters Swim", Location: "Pool", Start: at(2, 7), End: at(2, 8)}
+	setContentKeys([]*Workout{moved})
+	if uidFor(moved, nil) != uidFor(early, nil) {
+		t.Errorf("got %s after moving, want %s", uidFor(moved, nil), uidFor(early, nil))
+	}
+	if !strings.HasSuffix(uidFor(moved, nil), "@trivalleytriclub.com") {
+		t.Errorf("got %s, want a UID at the club's domain", uidFor(moved, nil))
+	}
+}